@@ -0,0 +1,152 @@
+// Package admin serves the operational endpoints of a service, metrics,
+// health, profiling, and runtime configuration, from a single port.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/kzs0/kokoro/flags"
+	"github.com/kzs0/kokoro/health"
+	"github.com/kzs0/kokoro/telemetry/logs"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+	"github.com/kzs0/kokoro/telemetry/profiling"
+)
+
+type serverOpts struct {
+	config   any
+	handlers map[string]http.Handler
+}
+
+type Option func(*serverOpts)
+
+// WithConfig serves the provided value as JSON from /debug/config, which must
+// not hold secrets as the endpoint is not authenticated
+func WithConfig(config any) Option {
+	return func(opts *serverOpts) {
+		opts.config = config
+	}
+}
+
+// WithHandler mounts an additional handler on the admin server
+func WithHandler(pattern string, handler http.Handler) Option {
+	return func(opts *serverOpts) {
+		if opts.handlers == nil {
+			opts.handlers = make(map[string]http.Handler)
+		}
+
+		opts.handlers[pattern] = handler
+	}
+}
+
+// Server hosts the admin endpoints
+//
+//   - /metrics serves metrics in the prometheus exposition format
+//   - /healthz and /readyz serve the liveness and readiness checks
+//   - /debug/pprof serves runtime profiles
+//   - /loglevel and /debug/loglevel report or change the global log level at
+//     runtime, e.g. PUT /loglevel?level=debug
+//   - /debug/flags lists or overrides feature flags
+//   - /debug/config serves the configuration provided with WithConfig
+type Server struct {
+	server   *http.Server
+	listener net.Listener
+}
+
+// New creates an admin server listening on port
+func New(port int, opts ...Option) *Server {
+	opt := serverOpts{}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", health.LivenessHandler())
+	mux.Handle("/readyz", health.ReadinessHandler())
+	mux.Handle("/loglevel", logs.LevelHandler())
+	mux.Handle("/debug/loglevel", logs.LevelHandler())
+	mux.Handle("/debug/flags", flags.Handler())
+
+	mux.Handle(profiling.HandlerPattern, profiling.Handler())
+
+	if opt.config != nil {
+		mux.Handle("/debug/config", configHandler(opt.config))
+	}
+
+	for pattern, handler := range opt.handlers {
+		mux.Handle(pattern, handler)
+	}
+
+	return &Server{
+		server: &http.Server{
+			Addr:              fmt.Sprintf(":%d", port),
+			Handler:           mux,
+			ReadTimeout:       15 * time.Second,
+			IdleTimeout:       360 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			MaxHeaderBytes:    1 << 20, // 1 MB
+		},
+	}
+}
+
+// Start listens on the admin port and serves the admin endpoints in the
+// background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for admin server: %w", err)
+	}
+	s.listener = listener
+
+	go func() {
+		err := s.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("failed to serve/failed while serving admin endpoints",
+				slog.String("error", err.Error()), slog.String("addr", s.server.Addr))
+
+			panic(err)
+		}
+	}()
+
+	return nil
+}
+
+// Shutdown stops the admin server, waiting for requests in flight until ctx
+// is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to shutdown admin server: %w", err)
+	}
+
+	// the server only closes the listener once it has started serving
+	if s.listener != nil {
+		err = s.listener.Close()
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			return fmt.Errorf("failed to close admin listener: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func configHandler(config any) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		err := enc.Encode(config)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
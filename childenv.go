@@ -0,0 +1,91 @@
+package kokoro
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/kzs0/kokoro/telemetry/logs"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// envPropagator carries trace context and baggage through the TRACEPARENT,
+// TRACESTATE, and BAGGAGE environment variables. It is independent of the
+// global propagator so subprocesses correlate even when traces are disabled.
+var envPropagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+// envCarrier maps propagation keys, e.g. traceparent, to upper case
+// environment variables
+type envCarrier map[string]string
+
+func (c envCarrier) Get(key string) string {
+	return c[strings.ToUpper(key)]
+}
+
+func (c envCarrier) Set(key, value string) {
+	c[strings.ToUpper(key)] = value
+}
+
+func (c envCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, strings.ToLower(k))
+	}
+
+	return keys
+}
+
+// ChildEnv returns the environment variables to set on a subprocess so its
+// telemetry correlates with the operation in ctx: the trace context and
+// baggage, the environment, and the current log level. A subprocess using
+// kokoro continues the trace from the context returned by Init.
+//
+//	cmd.Env = append(os.Environ(), kokoro.ChildEnv(ctx)...)
+func ChildEnv(ctx context.Context) []string {
+	carrier := envCarrier{}
+	envPropagator.Inject(ctx, carrier)
+
+	loaded.mu.Lock()
+	environment := loaded.settings["ENVIRONMENT"].value
+	loaded.mu.Unlock()
+	if environment != "" {
+		carrier["ENVIRONMENT"] = environment
+	}
+
+	carrier["LOG_LEVEL"] = logs.Level().String()
+
+	vars := make([]string, 0, len(carrier))
+	for k, v := range carrier {
+		vars = append(vars, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(vars)
+
+	return vars
+}
+
+// parentContext extracts the trace context and baggage a parent process set
+// with ChildEnv, unless ctx already carries a span
+func parentContext(ctx context.Context) context.Context {
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+
+	carrier := envCarrier{}
+	for _, k := range []string{"TRACEPARENT", "TRACESTATE", "BAGGAGE"} {
+		if v, ok := os.LookupEnv(k); ok {
+			carrier[k] = v
+		}
+	}
+
+	if len(carrier) == 0 {
+		return ctx
+	}
+
+	return envPropagator.Extract(ctx, carrier)
+}
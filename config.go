@@ -1,8 +1,21 @@
 package kokoro
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/kzs0/kokoro/env"
 	"github.com/kzs0/kokoro/telemetry/logs"
 	"github.com/kzs0/kokoro/telemetry/metrics"
+	"github.com/kzs0/kokoro/telemetry/profiling"
 	"github.com/kzs0/kokoro/telemetry/traces"
 )
 
@@ -10,4 +23,236 @@ type Config struct {
 	logs.Logs
 	metrics.Metrics
 	traces.Traces
+	profiling.Profiling
+}
+
+// Validate reports every setting of the enabled subsystems that can't be used
+func (config Config) Validate() error {
+	var errs error
+
+	if config.Logs.IsEnabled() {
+		errs = errors.Join(errs, config.Logs.Validate())
+	}
+	if config.Metrics.IsEnabled() {
+		errs = errors.Join(errs, config.Metrics.Validate())
+	}
+	if config.Traces.IsEnabled() {
+		errs = errors.Join(errs, config.Traces.Validate())
+	}
+	if config.Profiling.Enabled {
+		errs = errors.Join(errs, config.Profiling.Validate())
+	}
+
+	if errs != nil {
+		return errors.Join(ErrInvalidConfig, errs)
+	}
+
+	return nil
+}
+
+const (
+	sourceDefault = "default"
+	sourceEnv     = "env"
+	sourceFile    = "file"
+	sourceEnvFile = "env_file"
+	sourceProfile = "profile"
+	sourceConfig  = "config"
+	sourceOption  = "option"
+)
+
+// redacted lists fragments of keys whose values are never logged
+var redacted = []string{"SECRET", "PASSWORD", "TOKEN", "KEY", "CREDENTIAL", "HEADERS"}
+
+type setting struct {
+	value  string
+	source string
+}
+
+// settings records the value of every config field and where it came from
+type settings map[string]setting
+
+// parseConfig parses the config from the environment, recording the source of
+// every setting
+func parseConfig(config *Config, profile string, files envFiles) (settings, error) {
+	environment, fromFiles, err := profileEnvironment(profile, files)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := env.GetFieldParams(config)
+	if err != nil {
+		return nil, err
+	}
+
+	loadFile := make(map[string]bool)
+	for _, p := range params {
+		loadFile[p.Key] = p.LoadFile
+	}
+
+	s := make(settings)
+	err = env.ParseWithOptions(config, env.Options{
+		Environment: environment,
+		OnSet: func(key string, value interface{}, isDefault bool) {
+			_, fromEnv := os.LookupEnv(key)
+
+			source := sourceEnv
+			switch {
+			case isDefault:
+				source = sourceDefault
+			case loadFile[key]:
+				source = sourceFile
+			case fromFiles[key]:
+				source = sourceEnvFile
+			case !fromEnv:
+				source = sourceProfile
+			}
+
+			s[key] = setting{value: fmt.Sprint(value), source: source}
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// configSettings records the value of every field of a config that was
+// provided directly
+func configSettings(config Config) settings {
+	s := make(settings)
+	collectSettings(reflect.ValueOf(config), s)
+
+	return s
+}
+
+func collectSettings(v reflect.Value, s settings) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			collectSettings(v.Field(i), s)
+			continue
+		}
+
+		key, _, _ := strings.Cut(field.Tag.Get("env"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+
+		value := v.Field(i)
+		if value.Kind() == reflect.Ptr {
+			// unset optional fields, such as Enabled, are left out
+			if value.IsNil() {
+				continue
+			}
+			value = value.Elem()
+		}
+
+		s[key] = setting{value: fmt.Sprint(value.Interface()), source: sourceConfig}
+	}
+}
+
+// override records a setting replaced by an Init option
+func (s settings) override(key string, value any) {
+	s[key] = setting{value: fmt.Sprint(value), source: sourceOption}
+}
+
+func (s settings) keys() []string {
+	keys := make([]string, 0, len(s))
+	for k := range s {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// redacted returns the value of the setting, hiding secrets
+func (s settings) redacted(key string) string {
+	value := s[key].value
+	if isSecret(key) && value != "" {
+		return "REDACTED"
+	}
+
+	return value
+}
+
+// dump returns the redacted value and source of every setting, keyed by the
+// name of its variable
+func (s settings) dump() map[string]map[string]string {
+	d := make(map[string]map[string]string, len(s))
+	for k := range s {
+		d[k] = map[string]string{
+			"value":  s.redacted(k),
+			"source": s[k].source,
+		}
+	}
+
+	return d
+}
+
+// fingerprint is a stable hash of the redacted value of every setting, which
+// differs between instances running with different configurations
+func (s settings) fingerprint() string {
+	h := sha256.New()
+	for _, k := range s.keys() {
+		fmt.Fprintf(h, "%s=%s\n", k, s.redacted(k))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// recordFingerprint exports the config_info gauge, 1 for the current
+// fingerprint and 0 for the previous one
+func recordFingerprint(ctx context.Context, fingerprint, previous string) error {
+	if Default().Metrics() == nil {
+		return nil
+	}
+
+	gauge, err := Default().Metrics().NewGauge("config_info",
+		metrics.WithDescription("1 for the fingerprint of the running configuration, 0 for those it replaced"),
+		metrics.WithLabelNames([]string{"fingerprint"}),
+	)
+	if err != nil {
+		return err
+	}
+
+	if previous != "" && previous != fingerprint {
+		err = gauge.Measure(ctx, 0, metrics.WithLabel("fingerprint", previous))
+		if err != nil {
+			return err
+		}
+	}
+
+	return gauge.Measure(ctx, 1, metrics.WithLabel("fingerprint", fingerprint))
+}
+
+// report logs every setting and its source as a single record so
+// misconfiguration is visible in the first lines of output
+func (s settings) report() {
+	keys := s.keys()
+
+	attrs := make([]any, 0, len(keys)+1)
+	attrs = append(attrs, slog.String("fingerprint", s.fingerprint()))
+	for _, k := range keys {
+		value := s.redacted(k)
+
+		attrs = append(attrs, slog.Group(k,
+			slog.String("value", value),
+			slog.String("source", s[k].source),
+		))
+	}
+
+	slog.Info("kokoro configuration", attrs...)
+}
+
+func isSecret(key string) bool {
+	key = strings.ToUpper(key)
+	for _, fragment := range redacted {
+		if strings.Contains(key, fragment) {
+			return true
+		}
+	}
+
+	return false
 }
@@ -0,0 +1,47 @@
+package kokoro
+
+import "testing"
+
+func TestConfigEnabled(t *testing.T) {
+	tests := []struct {
+		name     string
+		enabled  string
+		disabled string
+		want     bool
+	}{
+		{"unset", "", "", true},
+		{"enabled", "true", "", true},
+		{"not enabled", "false", "", false},
+		{"disabled", "", "true", false},
+		{"enabled and disabled", "true", "true", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, signal := range []string{"LOGS", "METRICS", "TRACES"} {
+				if tt.enabled != "" {
+					t.Setenv(signal+"_ENABLED", tt.enabled)
+				}
+				if tt.disabled != "" {
+					t.Setenv(signal+"_DISABLED", tt.disabled)
+				}
+			}
+
+			var config Config
+			if _, err := parseConfig(&config, "", envFiles{}); err != nil {
+				t.Fatal(err)
+			}
+
+			got := map[string]bool{
+				"logs":    config.Logs.IsEnabled(),
+				"metrics": config.Metrics.IsEnabled(),
+				"traces":  config.Traces.IsEnabled(),
+			}
+			for signal, enabled := range got {
+				if enabled != tt.want {
+					t.Errorf("%s enabled = %v, want %v", signal, enabled, tt.want)
+				}
+			}
+		})
+	}
+}
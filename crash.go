@@ -0,0 +1,100 @@
+package kokoro
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+	"github.com/kzs0/kokoro/telemetry/traces"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var crash struct {
+	mu       sync.Mutex
+	exit     bool
+	exitCode int
+	grace    time.Duration
+}
+
+// WithExitOnCrash makes Recover exit the process with the code provided
+// instead of re-panicking once the crash has been reported
+func WithExitOnCrash(code int) Option {
+	return func(o *options) {
+		o.exitOnCrash = true
+		o.exitCode = code
+	}
+}
+
+// Recover reports a panic before letting it continue. It must be deferred
+// directly, typically at the top of main and of every goroutine:
+//
+//	defer kokoro.Recover(ctx)
+//
+// The panic is logged with its stack, the active span is ended in error, the
+// crashes counter is incremented, and buffered spans are flushed. Logs and
+// spans carry the panic.type, panic.message, and panic.stack_hash attributes,
+// see koko.DescribePanic, and the counter is labeled with the panic type. The
+// panic is then re-raised, or the process exits when WithExitOnCrash was
+// provided to Init.
+func Recover(ctx context.Context) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	p := koko.DescribePanic(r)
+	stack := debug.Stack()
+	err := p.Err()
+
+	attrs := append(p.Attrs(), slog.String("stack", string(stack)))
+	slog.LogAttrs(ctx, slog.LevelError, "crashed", attrs...)
+
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err, trace.WithAttributes(p.KeyValues()...))
+	span.SetAttributes(p.KeyValues()...)
+	span.SetStatus(codes.Error, "panic")
+	span.End()
+
+	koko.ReportError(ctx, koko.ErrorReport{
+		Err:   err,
+		Stack: stack,
+		Attrs: p.Attrs(),
+		Panic: true,
+	})
+
+	counter, cerr := koko.Counter("crashes",
+		metrics.WithDescription("panics recovered by Recover"),
+		metrics.WithLabelNames([]string{"panic_type"}),
+	)
+	if cerr == nil {
+		_ = counter.Incr(context.WithoutCancel(ctx), metrics.WithLabel("panic_type", p.Type))
+	}
+
+	crash.mu.Lock()
+	exit, code, grace := crash.exit, crash.exitCode, crash.grace
+	crash.mu.Unlock()
+
+	if grace <= 0 {
+		grace = defaultGracePeriod
+	}
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+
+	ferr := traces.Flush(flushCtx)
+	if ferr != nil {
+		slog.Error("failed to flush telemetry after crash", slog.String("error", ferr.Error()))
+	}
+
+	if exit {
+		os.Exit(code)
+	}
+
+	panic(r)
+}
@@ -0,0 +1,171 @@
+package kokoro
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/kzs0/kokoro/health"
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+const dependencyOperation = "dependency_call"
+
+type dependencyOpts struct {
+	addr      string
+	optional  bool
+	checkOpts []health.CheckOption
+}
+
+type DependencyOption func(*dependencyOpts)
+
+// WithAddress describes where the dependency is reached, e.g. db:5432, which
+// is reported on the spans of calls to it
+func WithAddress(addr string) DependencyOption {
+	return func(opts *dependencyOpts) {
+		opts.addr = addr
+	}
+}
+
+// Optional reports the dependency in the readiness report without failing
+// readiness when it is unavailable, for dependencies the service degrades
+// gracefully without
+func Optional() DependencyOption {
+	return func(opts *dependencyOpts) {
+		opts.optional = true
+	}
+}
+
+// WithCheckOptions configures how the availability check is run, e.g. its
+// period and timeout
+func WithCheckOptions(opts ...health.CheckOption) DependencyOption {
+	return func(o *dependencyOpts) {
+		o.checkOpts = append(o.checkOpts, opts...)
+	}
+}
+
+// Dep is an external dependency registered with Dependency
+type Dep struct {
+	name     string
+	addr     string
+	optional bool
+}
+
+var dependencies struct {
+	mu   sync.Mutex
+	deps map[string]*Dep
+}
+
+// Dependency registers a named external dependency, such as a database or an
+// upstream service. Its availability is checked with check as a readiness
+// check and exported as the dependency_up gauge, and calls wrapped with Call
+// are operations whose latency and outcome are labeled with the dependency.
+// Registering a name again replaces the dependency.
+func Dependency(name string, check health.Check, opts ...DependencyOption) *Dep {
+	opt := dependencyOpts{}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	d := &Dep{
+		name:     name,
+		addr:     opt.addr,
+		optional: opt.optional,
+	}
+
+	checkOpts := opt.checkOpts
+	if opt.optional {
+		checkOpts = append(checkOpts, health.WithAdvisory())
+	}
+	health.RegisterReadiness(name, func(ctx context.Context) error {
+		err := check(ctx)
+		d.record(context.WithoutCancel(ctx), err == nil)
+		return err
+	}, checkOpts...)
+
+	dependencies.mu.Lock()
+	defer dependencies.mu.Unlock()
+
+	if dependencies.deps == nil {
+		dependencies.deps = make(map[string]*Dep)
+	}
+	dependencies.deps[name] = d
+
+	return d
+}
+
+// Name returns the name the dependency was registered with
+func (d *Dep) Name() string {
+	return d.name
+}
+
+// Call runs fn within a client operation labeled with the dependency, so the
+// dependency_call_millis histogram and outcome counters break down calls by
+// dependency
+func (d *Dep) Call(ctx context.Context, fn func(context.Context) error, opts ...koko.OperationOption) (err error) {
+	opOpts := []koko.OperationOption{
+		koko.WithSpanKind(koko.SpanKindClient),
+		koko.WithLabels("dependency"),
+	}
+	if d.addr != "" {
+		opOpts = append(opOpts, koko.WithPeer(d.name, d.addr))
+	}
+	opOpts = append(opOpts, opts...)
+
+	ctx, done := koko.Operation(ctx, dependencyOperation, opOpts...)
+	defer done(&ctx, &err)
+
+	ctx = koko.Register(ctx, koko.Str("dependency", d.name))
+
+	return fn(ctx)
+}
+
+func (d *Dep) record(ctx context.Context, up bool) {
+	if Default().Metrics() == nil {
+		return
+	}
+
+	gauge, err := Default().Metrics().NewGauge("dependency_up",
+		metrics.WithDescription("1 when the dependency is available, 0 otherwise"),
+		metrics.WithLabelNames([]string{"dependency", "optional"}),
+	)
+	if err != nil {
+		return
+	}
+
+	v := 0.0
+	if up {
+		v = 1
+	}
+	optional := "false"
+	if d.optional {
+		optional = "true"
+	}
+
+	_ = gauge.Measure(ctx, v, metrics.WithLabel("dependency", d.name), metrics.WithLabel("optional", optional))
+}
+
+// DependencyInfo describes a registered dependency
+type DependencyInfo struct {
+	Name     string `json:"name"`
+	Address  string `json:"address,omitempty"`
+	Optional bool   `json:"optional"`
+}
+
+// Dependencies lists the registered dependencies sorted by name, their status
+// is part of the readiness report
+func Dependencies() []DependencyInfo {
+	dependencies.mu.Lock()
+	defer dependencies.mu.Unlock()
+
+	infos := make([]DependencyInfo, 0, len(dependencies.deps))
+	for _, d := range dependencies.deps {
+		infos = append(infos, DependencyInfo{Name: d.name, Address: d.addr, Optional: d.optional})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+
+	return infos
+}
@@ -0,0 +1,28 @@
+package kokoro
+
+import (
+	"context"
+
+	"github.com/kzs0/kokoro/diagnostics"
+	"go.opentelemetry.io/otel"
+)
+
+// Diagnostic is an internal failure of kokoro, see diagnostics.Error
+type Diagnostic = diagnostics.Error
+
+// WithDiagnostics calls fn with every internal failure of kokoro, such as
+// metrics that failed to record or spans that failed to export, in addition
+// to counting them with the kokoro_internal_errors counter
+func WithDiagnostics(fn func(Diagnostic)) Option {
+	return func(o *options) {
+		o.diagnostics = fn
+	}
+}
+
+// reportOtelErrors reports the errors of the OpenTelemetry SDK, e.g. failed
+// exports, as internal failures rather than logging each one
+func reportOtelErrors() {
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		diagnostics.Report(context.Background(), "otel", "opentelemetry error", err)
+	}))
+}
@@ -0,0 +1,181 @@
+// Package diagnostics reports the internal failures of kokoro itself, such as
+// metrics that could not be created or recorded and spans that could not be
+// exported, so the health of the telemetry pipeline can be monitored.
+//
+// Every failure increments the kokoro_internal_errors counter labeled with the
+// failing component. The first failure of a kind is logged as a warning, and
+// repeats are logged at most once per interval along with how many were
+// suppressed, so a broken exporter doesn't flood the logs.
+//
+// Telemetry dropped before it could be exported, such as spans over a full
+// export queue, is reported with Dropped and counted on the
+// kokoro_telemetry_dropped counter instead.
+package diagnostics
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/kzs0/kokoro/internal/clock"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+const defaultLogInterval = time.Minute
+
+// Error is an internal failure of kokoro
+type Error struct {
+	// Component is the part of kokoro that failed, e.g. koko or traces
+	Component string
+	// Message describes what failed, e.g. failed to record metrics
+	Message string
+	Err     error
+	Time    time.Time
+}
+
+type kind struct {
+	component string
+	message   string
+}
+
+type logState struct {
+	logged     time.Time
+	suppressed int
+}
+
+var state struct {
+	mu       sync.Mutex
+	interval time.Duration
+	handler  func(Error)
+	kinds    map[kind]*logState
+}
+
+// SetLogInterval sets how often a repeating failure of the same kind is
+// logged. Defaults to a minute.
+func SetLogInterval(d time.Duration) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	state.interval = d
+}
+
+// OnError calls fn with every internal failure, e.g. to forward them to an
+// error tracker. fn must not block. Providing nil removes the handler.
+func OnError(fn func(Error)) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	state.handler = fn
+}
+
+// Report records an internal failure of the component provided. The args are
+// logged along with the message as with slog.
+func Report(ctx context.Context, component, msg string, err error, args ...any) {
+	e := Error{
+		Component: component,
+		Message:   msg,
+		Err:       err,
+		Time:      clock.Now(),
+	}
+
+	suppressed, log, handler := track(e)
+
+	if log {
+		args = append(args, slog.String("component", component))
+		if err != nil {
+			args = append(args, slog.String("error", err.Error()))
+		}
+		if suppressed > 0 {
+			args = append(args, slog.Int("suppressed", suppressed))
+		}
+
+		slog.WarnContext(ctx, msg, args...)
+	}
+
+	record(context.WithoutCancel(ctx), component)
+
+	if handler != nil {
+		handler(e)
+	}
+}
+
+// Dropped records n spans, metric points, or log records of the signal, see
+// metrics.SignalSpans and the other signals, dropped for the reason provided,
+// e.g. queue_full. Drops are logged as warnings limited like failures.
+func Dropped(ctx context.Context, signal, reason string, n int) {
+	if n <= 0 {
+		return
+	}
+
+	suppressed, log, _ := track(Error{
+		Component: signal,
+		Message:   "dropped " + reason,
+		Time:      clock.Now(),
+	})
+
+	if log {
+		args := []any{
+			slog.String("signal", signal),
+			slog.String("reason", reason),
+			slog.Int("dropped", n),
+		}
+		if suppressed > 0 {
+			args = append(args, slog.Int("suppressed", suppressed))
+		}
+
+		slog.WarnContext(ctx, "dropped telemetry", args...)
+	}
+
+	metrics.RecordDropped(ctx, signal, reason, n)
+}
+
+// track returns whether the failure should be logged, along with the number
+// of failures of its kind suppressed since it was last logged
+func track(e Error) (int, bool, func(Error)) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.kinds == nil {
+		state.kinds = make(map[kind]*logState)
+	}
+
+	interval := state.interval
+	if interval <= 0 {
+		interval = defaultLogInterval
+	}
+
+	k := kind{component: e.Component, message: e.Message}
+	s, ok := state.kinds[k]
+	if !ok {
+		state.kinds[k] = &logState{logged: e.Time}
+		return 0, true, state.handler
+	}
+
+	if e.Time.Sub(s.logged) < interval {
+		s.suppressed++
+		return 0, false, state.handler
+	}
+
+	suppressed := s.suppressed
+	s.logged = e.Time
+	s.suppressed = 0
+
+	return suppressed, true, state.handler
+}
+
+func record(ctx context.Context, component string) {
+	if metrics.DefaultFactory == nil {
+		return
+	}
+
+	counter, err := metrics.DefaultFactory.NewCounter("kokoro_internal_errors",
+		metrics.WithDescription("Internal failures of kokoro, such as metrics that failed to record"),
+		metrics.WithLabelNames([]string{"component"}),
+	)
+	if err != nil {
+		return
+	}
+
+	_ = counter.Incr(ctx, metrics.WithLabel("component", component))
+}
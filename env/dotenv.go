@@ -0,0 +1,124 @@
+package env
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LoadFile reads the variables of a .env file, one KEY=VALUE per line, which
+// is decrypted with key when it was encrypted with EncryptFile. Blank lines
+// and lines starting with # are ignored, a leading export is allowed, and
+// values may be quoted.
+func LoadFile(path string, key []byte) (map[string]string, error) {
+	return LoadFileWithDecrypter(path, KeyDecrypter(staticKey(key)))
+}
+
+// LoadFileWithDecrypter reads the variables of a .env file like LoadFile,
+// decrypting it with the decrypter when it is encrypted in its format
+func LoadFileWithDecrypter(path string, decrypter Decrypter) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Join(ErrLoadEnvFile, err)
+	}
+
+	if decrypter.Encrypted(content) {
+		content, err = decrypter.Decrypt(content)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("could not decrypt %s", path), err)
+		}
+	}
+
+	vars, err := parseDotenv(content)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("could not parse %s", path), ErrLoadEnvFile, err)
+	}
+
+	return vars, nil
+}
+
+func parseDotenv(content []byte) (map[string]string, error) {
+	vars := make(map[string]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", n)
+		}
+
+		k = strings.TrimSpace(k)
+		v = strings.TrimSpace(v)
+
+		switch {
+		case len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"':
+			unquoted, err := strconv.Unquote(v)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			v = unquoted
+		case len(v) >= 2 && v[0] == '\'' && v[len(v)-1] == '\'':
+			v = v[1 : len(v)-1]
+		}
+
+		vars[k] = v
+	}
+
+	return vars, scanner.Err()
+}
+
+// withFiles returns the options with the variables of opts.Files added to the
+// environment, without overriding variables already set in it
+func withFiles(opts Options) (Options, error) {
+	if len(opts.Files) == 0 {
+		return opts, nil
+	}
+
+	decrypter := opts.Decrypter
+	if decrypter == nil {
+		key := opts.Key
+		if key == nil {
+			if encoded, ok := opts.Environment[KeyVariable]; ok {
+				var err error
+				key, err = ParseKey(encoded)
+				if err != nil {
+					return opts, err
+				}
+			}
+		}
+
+		decrypter = KeyDecrypter(staticKey(key))
+	}
+
+	environment := make(map[string]string, len(opts.Environment))
+	for k, v := range opts.Environment {
+		environment[k] = v
+	}
+
+	for _, path := range opts.Files {
+		vars, err := LoadFileWithDecrypter(path, decrypter)
+		if err != nil {
+			return opts, err
+		}
+
+		for k, v := range vars {
+			if _, set := environment[k]; !set {
+				environment[k] = v
+			}
+		}
+	}
+
+	opts.Environment = environment
+
+	return opts, nil
+}
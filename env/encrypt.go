@@ -0,0 +1,204 @@
+package env
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// KeyVariable is the environment variable holding the key of encrypted env
+// files when neither Options.Key nor Options.Decrypter is set, encoded as
+// base64
+const KeyVariable = "KOKORO_ENV_KEY"
+
+// KeySize is the size of the keys env files are encrypted with, AES-256
+const KeySize = 32
+
+// encryptedHeader starts every encrypted env file, so encrypted and plain
+// files can be loaded alike
+var encryptedHeader = []byte("# kokoro encrypted env v1\n")
+
+// GenerateKey returns a random key to encrypt env files with, encoded as
+// base64 like the value of KeyVariable
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ParseKey decodes a base64 key, such as the value of KeyVariable
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidKey, err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("%w: must be %d bytes, got %d", ErrInvalidKey, KeySize, len(key))
+	}
+
+	return key, nil
+}
+
+// EncryptFile encrypts the env file at src with key, writing the result to
+// dst, which can be committed and loaded with Options.Files
+func EncryptFile(src, dst string, key []byte) error {
+	plain, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if IsEncrypted(plain) {
+		return fmt.Errorf("%s is already encrypted", src)
+	}
+
+	encrypted, err := encrypt(plain, key)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(dst, encrypted, 0o644)
+}
+
+// DecryptFile decrypts the env file at src with key, writing the result to
+// dst so it can be edited and encrypted again
+func DecryptFile(src, dst string, key []byte) error {
+	encrypted, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	plain, err := decrypt(encrypted, key)
+	if err != nil {
+		return fmt.Errorf("could not decrypt %s: %w", src, err)
+	}
+
+	return os.WriteFile(dst, plain, 0o600)
+}
+
+// IsEncrypted reports whether the content of an env file was encrypted with
+// EncryptFile
+func IsEncrypted(content []byte) bool {
+	return bytes.HasPrefix(content, encryptedHeader)
+}
+
+// Decrypter decrypts encrypted env files, so files encrypted with tools such as
+// age or a KMS can be loaded, see Options.Decrypter
+type Decrypter interface {
+	// Encrypted reports whether the content of an env file is encrypted in
+	// the format the decrypter decrypts
+	Encrypted(content []byte) bool
+	Decrypt(content []byte) ([]byte, error)
+}
+
+// KeyProvider returns the key of env files encrypted with EncryptFile, e.g.
+// after decrypting it with a KMS
+type KeyProvider func() ([]byte, error)
+
+// KeyDecrypter decrypts env files encrypted with EncryptFile with the key
+// provided. The key is requested once, when the first encrypted file is
+// loaded.
+func KeyDecrypter(provider KeyProvider) Decrypter {
+	return &keyDecrypter{provider: provider}
+}
+
+type keyDecrypter struct {
+	provider KeyProvider
+	once     sync.Once
+	key      []byte
+	err      error
+}
+
+func (d *keyDecrypter) Encrypted(content []byte) bool {
+	return IsEncrypted(content)
+}
+
+func (d *keyDecrypter) Decrypt(content []byte) ([]byte, error) {
+	d.once.Do(func() {
+		d.key, d.err = d.provider()
+	})
+	if d.err != nil {
+		return nil, errors.Join(ErrInvalidKey, d.err)
+	}
+
+	return decrypt(content, d.key)
+}
+
+// staticKey provides the key given
+func staticKey(key []byte) KeyProvider {
+	return func() ([]byte, error) {
+		return key, nil
+	}
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("%w: must be %d bytes, got %d", ErrInvalidKey, KeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encrypt seals plain with AES-GCM, returning the header followed by the
+// nonce and ciphertext encoded as base64
+func encrypt(plain, key []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plain, encryptedHeader)
+
+	out := make([]byte, 0, len(encryptedHeader)+base64.StdEncoding.EncodedLen(len(sealed))+1)
+	out = append(out, encryptedHeader...)
+	out = base64.StdEncoding.AppendEncode(out, sealed)
+	out = append(out, '\n')
+
+	return out, nil
+}
+
+func decrypt(content, key []byte) ([]byte, error) {
+	if !IsEncrypted(content) {
+		return nil, ErrNotEncrypted
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(content[len(encryptedHeader):])))
+	if err != nil {
+		return nil, errors.Join(ErrDecrypt, err)
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, ciphertext, encryptedHeader)
+	if err != nil {
+		return nil, errors.Join(ErrDecrypt, err)
+	}
+
+	return plain, nil
+}
@@ -0,0 +1,77 @@
+package env
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// reversed is a decrypter of files whose content is stored reversed after a
+// header, standing in for formats such as age
+type reversed struct{}
+
+var reversedHeader = []byte("reversed\n")
+
+func (reversed) Encrypted(content []byte) bool {
+	return bytes.HasPrefix(content, reversedHeader)
+}
+
+func (reversed) Decrypt(content []byte) ([]byte, error) {
+	content = bytes.Clone(content[len(reversedHeader):])
+	for i, j := 0, len(content)-1; i < j; i, j = i+1, j-1 {
+		content[i], content[j] = content[j], content[i]
+	}
+
+	return content, nil
+}
+
+func TestFilesDecrypter(t *testing.T) {
+	key := make([]byte, KeySize)
+	encrypted, err := encrypt([]byte("HOST=db\n"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyErr := errors.New("kms unavailable")
+
+	tests := []struct {
+		name    string
+		content []byte
+		opts    Options
+		want    string
+		wantErr error
+	}{
+		{"plain", []byte("HOST=db\n"), Options{}, "db", nil},
+		{"key", encrypted, Options{Key: key}, "db", nil},
+		{"key provider", encrypted, Options{Decrypter: KeyDecrypter(staticKey(key))}, "db", nil},
+		{"key provider error", encrypted, Options{Decrypter: KeyDecrypter(func() ([]byte, error) { return nil, keyErr })}, "", keyErr},
+		{"custom", append(bytes.Clone(reversedHeader), []byte("\nbd=TSOH")...), Options{Decrypter: reversed{}}, "db", nil},
+		{"missing key", encrypted, Options{}, "", ErrInvalidKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ".env")
+			if err := os.WriteFile(path, tt.content, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			var config struct {
+				Host string `env:"HOST"`
+			}
+			opts := tt.opts
+			opts.Environment = map[string]string{}
+			opts.Files = []string{path}
+
+			err := ParseWithOptions(&config, opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseWithOptions() error = %v, want %v", err, tt.wantErr)
+			}
+			if config.Host != tt.want {
+				t.Errorf("Host = %q, want %q", config.Host, tt.want)
+			}
+		})
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"net/url"
 	"os"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -164,6 +165,19 @@ type Options struct {
 	// Custom parse functions for different types.
 	FuncMap map[reflect.Type]ParserFunc
 
+	// Files lists .env files whose variables are added to the environment,
+	// without overriding variables already set. Earlier files take precedence
+	// over later ones. Files encrypted with EncryptFile are decrypted with Key.
+	Files []string
+
+	// Key decrypts encrypted Files, read from the KOKORO_ENV_KEY variable of
+	// the environment when not set.
+	Key []byte
+
+	// Decrypter decrypts encrypted Files instead of Key, e.g. to load files
+	// encrypted with age or a key held by a KMS, see KeyDecrypter.
+	Decrypter Decrypter
+
 	// Used internally. maps the env variable key to its resolved string value.
 	// (for env var expansion)
 	rawEnvVars map[string]string
@@ -231,6 +245,21 @@ func optionsWithSliceEnvPrefix(opts Options, index int) Options {
 	}
 }
 
+func optionsWithMapEnvPrefix(opts Options, key string) Options {
+	return Options{
+		Environment:           opts.Environment,
+		TagName:               opts.TagName,
+		PrefixTagName:         opts.PrefixTagName,
+		DefaultValueTagName:   opts.DefaultValueTagName,
+		RequiredIfNoDef:       opts.RequiredIfNoDef,
+		OnSet:                 opts.OnSet,
+		Prefix:                fmt.Sprintf("%s%s_", opts.Prefix, key),
+		UseFieldNameByDefault: opts.UseFieldNameByDefault,
+		FuncMap:               opts.FuncMap,
+		rawEnvVars:            opts.rawEnvVars,
+	}
+}
+
 func optionsWithEnvPrefix(field reflect.StructField, opts Options) Options {
 	return Options{
 		Environment:           opts.Environment,
@@ -317,6 +346,11 @@ func parseInternal(v interface{}, processField processFieldFn, opts Options) err
 		return ErrStructPtr
 	}
 
+	opts, err := withFiles(opts)
+	if err != nil {
+		return err
+	}
+
 	return doParse(ref, processField, opts)
 }
 
@@ -330,7 +364,7 @@ func doParse(ref reflect.Value, processField processFieldFn, opts Options) error
 
 		err := doParseField(refField, refTypeField, processField, opts)
 		if err != nil {
-			err = errors.Join(errs, err)
+			errs = errors.Join(errs, err)
 		}
 	}
 
@@ -383,6 +417,12 @@ func doParseField(
 		return doParseSlice(refField, processField, optionsWithEnvPrefix(refTypeField, opts))
 	}
 
+	// a map without a prefix of its own is skipped, as its keys would be
+	// discovered from every variable under the prefix of the parent
+	if isMapOfStructs(refTypeField, opts) && refTypeField.Tag.Get(opts.PrefixTagName) != "" {
+		return doParseMap(refField, processField, optionsWithEnvPrefix(refTypeField, opts))
+	}
+
 	return nil
 }
 
@@ -396,8 +436,12 @@ func isSliceOfStructs(refTypeField reflect.StructField, opts Options) bool {
 		return false
 	}
 
-	field = field.Elem()
+	return isStruct(field.Elem(), opts)
+}
 
+// isStruct reports whether elements of the type are parsed as structs rather
+// than from a single variable
+func isStruct(field reflect.Type, opts Options) bool {
 	if reflect.Ptr == field.Kind() {
 		field = field.Elem()
 	}
@@ -482,6 +526,148 @@ func doParseSlice(ref reflect.Value, processField processFieldFn, opts Options)
 	return nil
 }
 
+func isMapOfStructs(refTypeField reflect.StructField, opts Options) bool {
+	field := refTypeField.Type
+	if reflect.Map != field.Kind() || reflect.String != field.Key().Kind() {
+		return false
+	}
+
+	return isStruct(field.Elem(), opts)
+}
+
+// doParseMap parses a map of structs from the variables under the prefix of
+// the map, discovering its keys from the segment between the prefix and the
+// variables of the struct, e.g. DB_PRIMARY_HOST and DB_REPLICA_HOST are the
+// HOST of the PRIMARY and REPLICA entries of a map prefixed by DB_
+func doParseMap(ref reflect.Value, processField processFieldFn, opts Options) error {
+	if opts.Prefix != "" && !strings.HasSuffix(opts.Prefix, string(underscore)) {
+		opts.Prefix += string(underscore)
+	}
+
+	mapType := ref.Type()
+	structType := mapType.Elem()
+	if reflect.Ptr == structType.Kind() {
+		structType = structType.Elem()
+	}
+
+	leaves, prefixes := structVariables(structType, "", opts)
+	// the longest variables are matched first so keys are as short as possible
+	sort.Slice(leaves, func(i, j int) bool { return len(leaves[i]) > len(leaves[j]) })
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	keys := make(map[string]struct{})
+	for environment := range opts.Environment {
+		rest, ok := strings.CutPrefix(environment, opts.Prefix)
+		if !ok {
+			continue
+		}
+
+		if key := mapKey(rest, leaves, prefixes); key != "" {
+			keys[key] = struct{}{}
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	result := ref
+	if ref.IsNil() {
+		result = reflect.MakeMapWithSize(mapType, len(keys))
+	}
+
+	var errs error
+	for key := range keys {
+		mapKey := reflect.ValueOf(key).Convert(mapType.Key())
+
+		item := reflect.New(structType).Elem()
+		if existing := result.MapIndex(mapKey); existing.IsValid() {
+			if reflect.Ptr == existing.Kind() && !existing.IsNil() {
+				existing = existing.Elem()
+			}
+			if reflect.Struct == existing.Kind() {
+				item.Set(existing)
+			}
+		}
+
+		if err := doParse(item, processField, optionsWithMapEnvPrefix(opts, key)); err != nil {
+			errs = errors.Join(errs, err)
+		}
+
+		if reflect.Ptr == mapType.Elem().Kind() {
+			item = item.Addr()
+		}
+		result.SetMapIndex(mapKey, item)
+	}
+
+	ref.Set(result)
+
+	return errs
+}
+
+// mapKey returns the key of the map entry the variable belongs to, given the
+// rest of its name after the prefix of the map, or an empty key if it is not
+// a variable of an entry
+func mapKey(rest string, leaves, prefixes []string) string {
+	for _, leaf := range leaves {
+		key, ok := strings.CutSuffix(rest, string(underscore)+leaf)
+		if ok && key != "" {
+			return key
+		}
+	}
+
+	for _, prefix := range prefixes {
+		i := strings.Index(rest, string(underscore)+prefix)
+		if i > 0 {
+			return rest[:i]
+		}
+	}
+
+	return ""
+}
+
+// structVariables returns the names of the variables a struct is parsed from,
+// and the prefixes of its nested slices and maps of structs whose variables
+// cannot be known in advance
+func structVariables(t reflect.Type, prefix string, opts Options) (leaves, prefixes []string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		params, err := parseFieldParams(field, opts)
+		if err != nil || params.Ignored {
+			continue
+		}
+		if params.OwnKey != "" {
+			leaves = append(leaves, prefix+params.OwnKey)
+		}
+
+		ft := field.Type
+		if reflect.Ptr == ft.Kind() {
+			ft = ft.Elem()
+		}
+
+		nested := prefix + field.Tag.Get(opts.PrefixTagName)
+		switch {
+		case isSliceOfStructs(field, opts) || isMapOfStructs(field, opts):
+			if nested != prefix {
+				prefixes = append(prefixes, nested)
+			}
+		case reflect.Struct == ft.Kind():
+			if _, ok := opts.FuncMap[ft]; ok {
+				continue
+			}
+			l, p := structVariables(ft, nested, opts)
+			leaves = append(leaves, l...)
+			prefixes = append(prefixes, p...)
+		}
+	}
+
+	return leaves, prefixes
+}
+
 func setField(refField reflect.Value, refTypeField reflect.StructField, opts Options, fieldParams FieldParams) error {
 	value, err := get(fieldParams, opts)
 	if err != nil {
@@ -721,7 +907,7 @@ func handleSlice(field reflect.Value, value string, sf reflect.StructField, func
 	for _, part := range parts {
 		r, err := parserFunc(part)
 		if err != nil {
-			return errors.Join(fmt.Errorf(`parse error on field "%s" of type "%s": %v`, sf.Name, sf.Type),
+			return errors.Join(fmt.Errorf(`parse error on field "%s" of type "%s"`, sf.Name, sf.Type),
 				ErrParseValue, err)
 		}
 		v := reflect.ValueOf(r).Convert(typee)
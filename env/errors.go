@@ -12,4 +12,9 @@ var (
 	ErrEmptyVar             = errors.New("environment variable should not be empty")
 	ErrLoadFileContent      = errors.New("could not load content of file from variable")
 	ErrNoParser             = errors.New("no parser found")
+	ErrInvalidKey           = errors.New("invalid env file key")
+	ErrNotEncrypted         = errors.New("env file is not encrypted")
+	ErrDecrypt              = errors.New("could not decrypt env file")
+	ErrLoadEnvFile          = errors.New("could not load env file")
+	ErrNoVariables          = errors.New("no environment variables found")
 )
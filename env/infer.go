@@ -0,0 +1,145 @@
+package env
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// initialisms are the segments of variable names kept in upper case in the
+// names of the inferred fields.
+var initialisms = map[string]bool{
+	"API": true, "AWS": true, "CPU": true, "DB": true, "DNS": true,
+	"GRPC": true, "HTTP": true, "HTTPS": true, "ID": true, "IP": true,
+	"JSON": true, "JWT": true, "OTLP": true, "SQL": true, "SSL": true,
+	"TCP": true, "TLS": true, "TTL": true, "UDP": true, "URI": true,
+	"URL": true, "UUID": true,
+}
+
+// Infer inspects the environment variables starting with prefix and returns
+// the Go source of a Config struct with a tagged field for each of them, its
+// type guessed from the current value. It helps adopting Parse in services
+// reading the environment ad hoc. The values themselves are not included in
+// the source since they may be secrets.
+func Infer(prefix string) ([]byte, error) {
+	return InferWithOptions(prefix, defaultOptions())
+}
+
+// InferWithOptions infers a Config struct like Infer from the environment
+// and files of the options.
+func InferWithOptions(prefix string, opts Options) ([]byte, error) {
+	opts, err := withFiles(customOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range opts.Environment {
+		if strings.HasPrefix(name, prefix) && name != prefix {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%w with prefix %q", ErrNoVariables, prefix)
+	}
+	sort.Strings(names)
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Config is parsed from the %s environment variables.\n", strings.TrimRight(prefix, "_"))
+	src.WriteString("type Config struct {\n")
+
+	fields := make(map[string]int)
+	for _, name := range names {
+		field := fieldName(strings.TrimPrefix(name, prefix))
+		if n := fields[field]; n > 0 {
+			fields[field]++
+			field = fmt.Sprintf("%s%d", field, n+1)
+		} else {
+			fields[field] = 1
+		}
+
+		fmt.Fprintf(&src, "\t%s %s `%s:%q`\n", field, inferType(opts.Environment[name]), opts.TagName, name)
+	}
+	src.WriteString("}\n")
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, errors.Join(err, errors.New("unable to format inferred config"))
+	}
+
+	return formatted, nil
+}
+
+// fieldName converts a variable name like DB_MAX_CONNS to the field name
+// DBMaxConns.
+func fieldName(name string) string {
+	var b strings.Builder
+	for _, segment := range strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		upper := strings.ToUpper(segment)
+		if initialisms[upper] {
+			b.WriteString(upper)
+			continue
+		}
+
+		b.WriteString(upper[:1])
+		b.WriteString(strings.ToLower(upper[1:]))
+	}
+
+	field := b.String()
+	if field == "" {
+		return "Field"
+	}
+	if !unicode.IsLetter(rune(field[0])) {
+		field = "Field" + field
+	}
+
+	return field
+}
+
+// inferType guesses the type of the field a value is parsed into.
+func inferType(v string) string {
+	if parts := strings.Split(v, ","); len(parts) > 1 {
+		elem := inferScalarType(strings.TrimSpace(parts[0]))
+		for _, p := range parts[1:] {
+			if inferScalarType(strings.TrimSpace(p)) != elem {
+				elem = "string"
+				break
+			}
+		}
+
+		return "[]" + elem
+	}
+
+	return inferScalarType(v)
+}
+
+func inferScalarType(v string) string {
+	switch strings.ToLower(v) {
+	case "true", "false":
+		return "bool"
+	}
+
+	if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return "int"
+	}
+	if _, err := strconv.ParseFloat(v, 64); err == nil {
+		return "float64"
+	}
+	if _, err := time.ParseDuration(v); err == nil {
+		return "time.Duration"
+	}
+	if u, err := url.Parse(v); err == nil && u.Scheme != "" && u.Host != "" {
+		return "url.URL"
+	}
+
+	return "string"
+}
@@ -0,0 +1,77 @@
+package env
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestInferWithOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		prefix      string
+		environment map[string]string
+		want        string
+		wantErr     error
+	}{
+		{
+			name:   "types",
+			prefix: "APP_",
+			environment: map[string]string{
+				"APP_DEBUG":        "true",
+				"APP_DB_MAX_CONNS": "20",
+				"APP_RATIO":        "0.5",
+				"APP_TIMEOUT":      "5s",
+				"APP_API_URL":      "https://example.com/v1",
+				"APP_NAME":         "checkout",
+				"APP_PORTS":        "80,443",
+				"APP_TAGS":         "a,1",
+				"OTHER_NAME":       "ignored",
+			},
+			want: "// Config is parsed from the APP environment variables.\n" +
+				"type Config struct {\n" +
+				"\tAPIURL     url.URL       `env:\"APP_API_URL\"`\n" +
+				"\tDBMaxConns int           `env:\"APP_DB_MAX_CONNS\"`\n" +
+				"\tDebug      bool          `env:\"APP_DEBUG\"`\n" +
+				"\tName       string        `env:\"APP_NAME\"`\n" +
+				"\tPorts      []int         `env:\"APP_PORTS\"`\n" +
+				"\tRatio      float64       `env:\"APP_RATIO\"`\n" +
+				"\tTags       []string      `env:\"APP_TAGS\"`\n" +
+				"\tTimeout    time.Duration `env:\"APP_TIMEOUT\"`\n" +
+				"}\n",
+		},
+		{
+			name:   "clashing names",
+			prefix: "APP_",
+			environment: map[string]string{
+				"APP_DB_HOST":  "a",
+				"APP_DB__HOST": "b",
+				"APP_1ST":      "c",
+			},
+			want: "// Config is parsed from the APP environment variables.\n" +
+				"type Config struct {\n" +
+				"\tField1st string `env:\"APP_1ST\"`\n" +
+				"\tDBHost   string `env:\"APP_DB_HOST\"`\n" +
+				"\tDBHost2  string `env:\"APP_DB__HOST\"`\n" +
+				"}\n",
+		},
+		{
+			name:        "no variables",
+			prefix:      "APP_",
+			environment: map[string]string{"APP_": "x", "OTHER": "y"},
+			wantErr:     ErrNoVariables,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := InferWithOptions(tt.prefix, Options{Environment: tt.environment})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("InferWithOptions() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("InferWithOptions() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package env
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMapKey(t *testing.T) {
+	leaves := []string{"MAX_CONNS", "HOST"}
+	prefixes := []string{"TAGS_"}
+
+	tests := []struct {
+		name string
+		rest string
+		want string
+	}{
+		{"leaf", "PRIMARY_HOST", "PRIMARY"},
+		{"longest leaf", "PRIMARY_MAX_CONNS", "PRIMARY"},
+		{"key with underscores", "EU_WEST_HOST", "EU_WEST"},
+		{"nested prefix", "REPLICA_TAGS_0_NAME", "REPLICA"},
+		{"leaf without key", "HOST", ""},
+		{"nested prefix without key", "TAGS_0_NAME", ""},
+		{"unknown variable", "PRIMARY_PORT", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mapKey(tt.rest, leaves, prefixes); got != tt.want {
+				t.Errorf("mapKey(%q) = %q, want %q", tt.rest, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMap(t *testing.T) {
+	type database struct {
+		Host     string `env:"HOST"`
+		MaxConns int    `env:"MAX_CONNS" envDefault:"10"`
+	}
+
+	type config struct {
+		Databases map[string]database  `envPrefix:"DB_"`
+		Replicas  map[string]*database `envPrefix:"REPLICA"`
+		Ignored   map[string]database
+	}
+
+	tests := []struct {
+		name        string
+		environment map[string]string
+		want        config
+	}{
+		{
+			name:        "no entries",
+			environment: map[string]string{"HOST": "db"},
+			want:        config{},
+		},
+		{
+			name: "entries",
+			environment: map[string]string{
+				"DB_PRIMARY_HOST":      "primary",
+				"DB_PRIMARY_MAX_CONNS": "50",
+				"DB_EU_WEST_HOST":      "eu-west",
+			},
+			want: config{Databases: map[string]database{
+				"PRIMARY": {Host: "primary", MaxConns: 50},
+				"EU_WEST": {Host: "eu-west", MaxConns: 10},
+			}},
+		},
+		{
+			name: "pointers under a prefix without underscore",
+			environment: map[string]string{
+				"REPLICA_A_HOST": "a",
+			},
+			want: config{Replicas: map[string]*database{
+				"A": {Host: "a", MaxConns: 10},
+			}},
+		},
+		{
+			name: "unprefixed map",
+			environment: map[string]string{
+				"PRIMARY_HOST": "primary",
+			},
+			want: config{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got config
+			if err := ParseWithOptions(&got, Options{Environment: tt.environment}); err != nil {
+				t.Fatalf("ParseWithOptions() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseWithOptions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package kokoro
+
+import (
+	"github.com/kzs0/kokoro/env"
+)
+
+// envFiles are the env files the config is read from and what decrypts them
+type envFiles struct {
+	paths     []string
+	decrypter env.Decrypter
+}
+
+// WithEnvFiles reads the config from the .env files provided in addition to
+// the environment, e.g. for local development. Variables set in the
+// environment take precedence over the files, and earlier files over later
+// ones. Files encrypted with env.EncryptFile are decrypted with the key held
+// by the KOKORO_ENV_KEY variable, so they can be committed.
+func WithEnvFiles(paths ...string) Option {
+	return func(o *options) {
+		o.envFiles.paths = append(o.envFiles.paths, paths...)
+	}
+}
+
+// WithEnvDecrypter decrypts the env files with the decrypter provided instead
+// of the KOKORO_ENV_KEY key, e.g. to load files encrypted with age or a key held
+// by a KMS, see env.KeyDecrypter
+func WithEnvDecrypter(decrypter env.Decrypter) Option {
+	return func(o *options) {
+		o.envFiles.decrypter = decrypter
+	}
+}
+
+// loadEnvFiles adds the variables of the env files to environment without
+// overriding those already set, returning the variables it added
+func loadEnvFiles(environment map[string]string, files envFiles) (map[string]bool, error) {
+	added := make(map[string]bool)
+	if len(files.paths) == 0 {
+		return added, nil
+	}
+
+	decrypter := files.decrypter
+	if decrypter == nil {
+		var key []byte
+		if encoded, ok := environment[env.KeyVariable]; ok {
+			var err error
+			key, err = env.ParseKey(encoded)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		decrypter = env.KeyDecrypter(func() ([]byte, error) { return key, nil })
+	}
+
+	for _, path := range files.paths {
+		vars, err := env.LoadFileWithDecrypter(path, decrypter)
+		if err != nil {
+			return nil, err
+		}
+
+		for k, v := range vars {
+			if _, set := environment[k]; !set {
+				environment[k] = v
+				added[k] = true
+			}
+		}
+	}
+
+	return added, nil
+}
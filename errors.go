@@ -5,4 +5,6 @@ import "errors"
 var (
 	ErrEnvLoadFailed        error = errors.New("failed to load config from environment")
 	ErrInitializationFailed error = errors.New("failed to initialize kokoro")
+	ErrInvalidConfig        error = errors.New("invalid config")
+	ErrAlreadyInitialized   error = errors.New("kokoro is already initialized")
 )
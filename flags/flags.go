@@ -0,0 +1,356 @@
+// Package flags declares typed feature flags whose defaults are parsed from
+// the environment and which can be overridden while the process is running.
+//
+// Evaluating a flag registers its value on the current operation and every
+// flag's state is exported as metrics, so behavior changes are visible in the
+// same telemetry as their effects.
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kzs0/kokoro/env"
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+var ErrUnknownFlag = errors.New("unknown flag")
+
+const (
+	sourceDefault  = "default"
+	sourceEnv      = "env"
+	sourceOverride = "override"
+)
+
+// Value is the set of types a flag can hold
+type Value interface {
+	~bool | ~string | ~int | ~int64 | ~float64
+}
+
+// Flag is a typed feature flag
+type Flag[T Value] struct {
+	name   string
+	envKey string
+
+	mu       sync.RWMutex
+	value    T
+	source   string
+	override *T
+}
+
+// holder reuses the env package to parse a flag value
+type holder[T Value] struct {
+	Value T `env:"VALUE"`
+}
+
+func parse[T Value](raw string) (T, error) {
+	h, err := env.ParseAsWithOptions[holder[T]](env.Options{
+		Environment: map[string]string{"VALUE": raw},
+	})
+
+	return h.Value, err
+}
+
+// EnvKey returns the environment variable a flag named name is parsed from,
+// e.g. new-checkout is parsed from FLAG_NEW_CHECKOUT
+func EnvKey(name string) string {
+	return "FLAG_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_", " ", "_").Replace(name))
+}
+
+// New declares a flag, parsing its value from the environment variable named
+// by EnvKey and falling back to def when it is unset. Declaring a flag with
+// the name of an existing flag replaces it.
+func New[T Value](name string, def T) (*Flag[T], error) {
+	f := &Flag[T]{
+		name:   name,
+		envKey: EnvKey(name),
+		value:  def,
+		source: sourceDefault,
+	}
+
+	raw := os.Getenv(f.envKey)
+	if raw != "" {
+		v, err := parse[T](raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse flag %s from %s: %w", name, f.envKey, err)
+		}
+
+		f.value = v
+		f.source = sourceEnv
+	}
+
+	register(f)
+	f.record()
+
+	return f, nil
+}
+
+// Must declares a flag, panicking when its value can't be parsed
+func Must[T Value](name string, def T) *Flag[T] {
+	return env.Must(New(name, def))
+}
+
+// Bool declares a boolean flag, see New
+func Bool(name string, def bool) (*Flag[bool], error) {
+	return New(name, def)
+}
+
+// String declares a string flag, see New
+func String(name string, def string) (*Flag[string], error) {
+	return New(name, def)
+}
+
+// Int declares an integer flag, see New
+func Int(name string, def int) (*Flag[int], error) {
+	return New(name, def)
+}
+
+// Float declares a floating point flag, see New
+func Float(name string, def float64) (*Flag[float64], error) {
+	return New(name, def)
+}
+
+// Name returns the name of the flag
+func (f *Flag[T]) Name() string {
+	return f.name
+}
+
+// Value returns the current value of the flag without registering it
+func (f *Flag[T]) Value() T {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.override != nil {
+		return *f.override
+	}
+
+	return f.value
+}
+
+// Get evaluates the flag, registering its value as the flag.<name> attribute
+// on the operation in ctx
+func (f *Flag[T]) Get(ctx context.Context) T {
+	v := f.Value()
+	koko.Register(ctx, koko.Str("flag."+f.name, fmt.Sprint(v), koko.LogOnly(), koko.TraceOnly()))
+
+	return v
+}
+
+// Override replaces the value of the flag until Reset is called
+func (f *Flag[T]) Override(v T) {
+	f.mu.Lock()
+	f.override = &v
+	f.mu.Unlock()
+
+	f.record()
+}
+
+// Reset removes any override, restoring the value parsed on declaration
+func (f *Flag[T]) Reset() {
+	f.mu.Lock()
+	f.override = nil
+	f.mu.Unlock()
+
+	f.record()
+}
+
+func (f *Flag[T]) state() State {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	s := State{
+		Name:   f.name,
+		EnvKey: f.envKey,
+		Value:  fmt.Sprint(f.value),
+		Source: f.source,
+	}
+	if f.override != nil {
+		s.Value = fmt.Sprint(*f.override)
+		s.Source = sourceOverride
+	}
+
+	return s
+}
+
+func (f *Flag[T]) overrideString(raw string) error {
+	v, err := parse[T](raw)
+	if err != nil {
+		return err
+	}
+
+	f.Override(v)
+
+	return nil
+}
+
+// record exports the state of the flag. flag_overridden reports whether the
+// flag is overridden, and flag_value reports the value of boolean flags as 0
+// or 1 and numeric flags as their value.
+func (f *Flag[T]) record() {
+	ctx := context.Background()
+	label := metrics.WithLabel("flag", f.name)
+
+	f.mu.RLock()
+	overridden := f.override != nil
+	f.mu.RUnlock()
+
+	gauge, err := koko.Gauge("flag_overridden",
+		metrics.WithDescription("whether each feature flag is overridden at runtime"),
+		metrics.WithLabelNames([]string{"flag"}),
+	)
+	if err != nil {
+		return
+	}
+
+	var n float64
+	if overridden {
+		n = 1
+	}
+	_ = gauge.Measure(ctx, n, label)
+
+	switch v := any(f.Value()).(type) {
+	case bool:
+		n = 0
+		if v {
+			n = 1
+		}
+	case int:
+		n = float64(v)
+	case int64:
+		n = float64(v)
+	case float64:
+		n = v
+	default:
+		return
+	}
+
+	gauge, err = koko.Gauge("flag_value",
+		metrics.WithDescription("the current value of each boolean or numeric feature flag"),
+		metrics.WithLabelNames([]string{"flag"}),
+	)
+	if err != nil {
+		return
+	}
+
+	_ = gauge.Measure(ctx, n, label)
+}
+
+// State describes the current value of a flag
+type State struct {
+	Name   string `json:"name"`
+	EnvKey string `json:"env"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+type flag interface {
+	state() State
+	overrideString(raw string) error
+	Reset()
+}
+
+var registry struct {
+	mu    sync.RWMutex
+	flags map[string]flag
+}
+
+func register(f flag) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if registry.flags == nil {
+		registry.flags = make(map[string]flag)
+	}
+	registry.flags[f.state().Name] = f
+}
+
+func lookup(name string) (flag, bool) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	f, ok := registry.flags[name]
+	return f, ok
+}
+
+// List returns the state of every declared flag
+func List() []State {
+	registry.mu.RLock()
+	states := make([]State, 0, len(registry.flags))
+	for _, f := range registry.flags {
+		states = append(states, f.state())
+	}
+	registry.mu.RUnlock()
+
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Name < states[j].Name
+	})
+
+	return states
+}
+
+// Set overrides the flag with the name provided, parsing the value as the
+// flag's type
+func Set(name, value string) error {
+	f, ok := lookup(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownFlag, name)
+	}
+
+	return f.overrideString(value)
+}
+
+// Reset removes any override from the flag with the name provided
+func Reset(name string) error {
+	f, ok := lookup(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownFlag, name)
+	}
+
+	f.Reset()
+
+	return nil
+}
+
+// Handler lists every flag on GET, overrides the flag named by the name query
+// parameter with the value parameter on PUT or POST, and resets it on DELETE
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("name")
+
+		var err error
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			err = Set(name, r.URL.Query().Get("value"))
+		case http.MethodDelete:
+			err = Reset(name)
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		switch {
+		case errors.Is(err, ErrUnknownFlag):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(List())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Pinger is implemented by clients that can check their connection, such as
+// *sql.DB
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// Ping checks that the client can reach its server, e.g. a database
+func Ping(p Pinger) Check {
+	return func(ctx context.Context) error {
+		return p.PingContext(ctx)
+	}
+}
+
+// Dial checks that a TCP connection can be established to addr, e.g.
+// cache:6379, for dependencies without a client of their own to ping
+func Dial(addr string) Check {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+
+		return conn.Close()
+	}
+}
+
+// HTTPGet checks that a GET request to url succeeds, e.g. the readiness
+// endpoint of an upstream service. Any status of 400 or above fails the check.
+func HTTPGet(client *http.Client, url string) Check {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("%s responded %s", url, resp.Status)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,65 @@
+package health
+
+import (
+	"context"
+	"sync"
+
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+// gate holds the readiness endpoint failing independently of the checks, for
+// work that runs once rather than on a period, e.g. warming caches
+var gate struct {
+	mu     sync.Mutex
+	held   bool
+	reason string
+}
+
+// NotReady fails the readiness endpoint with the reason provided until
+// SetReady is called
+func NotReady(reason string) {
+	gate.mu.Lock()
+	gate.held = true
+	gate.reason = reason
+	gate.mu.Unlock()
+
+	recordGate(false)
+}
+
+// SetReady releases a hold placed by NotReady. The readiness endpoint reports
+// ready once the readiness checks are also passing.
+func SetReady() {
+	gate.mu.Lock()
+	gate.held = false
+	gate.reason = ""
+	gate.mu.Unlock()
+
+	recordGate(true)
+}
+
+func gateReason() (string, bool) {
+	gate.mu.Lock()
+	defer gate.mu.Unlock()
+
+	return gate.reason, gate.held
+}
+
+func recordGate(ready bool) {
+	if metrics.DefaultFactory == nil {
+		return
+	}
+
+	gauge, err := metrics.DefaultFactory.NewGauge("ready",
+		metrics.WithDescription("1 when the service has not been held unready by NotReady, 0 otherwise"),
+	)
+	if err != nil {
+		return
+	}
+
+	status := 1.0
+	if !ready {
+		status = 0
+	}
+
+	_ = gauge.Measure(context.Background(), status)
+}
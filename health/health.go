@@ -0,0 +1,379 @@
+// Package health runs the liveness and readiness checks registered by the
+// components of a service and reports their status over HTTP and as metrics.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kzs0/kokoro/internal/clock"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+const (
+	defaultPeriod  = 10 * time.Second
+	defaultTimeout = 5 * time.Second
+)
+
+var ErrNotStarted = errors.New("health checks have not been started")
+
+// Check reports whether a component is healthy by returning nil
+type Check func(ctx context.Context) error
+
+type kind string
+
+const (
+	liveness  kind = "liveness"
+	readiness kind = "readiness"
+)
+
+type checkOpts struct {
+	period   time.Duration
+	timeout  time.Duration
+	advisory bool
+}
+
+type CheckOption func(*checkOpts)
+
+// WithPeriod sets how often the check is run. Defaults to 10 seconds, which a
+// non-positive period keeps.
+func WithPeriod(d time.Duration) CheckOption {
+	return func(opts *checkOpts) {
+		if d > 0 {
+			opts.period = d
+		}
+	}
+}
+
+// WithTimeout bounds how long a single run of the check may take. Defaults to
+// 5 seconds, which a non-positive timeout keeps.
+func WithTimeout(d time.Duration) CheckOption {
+	return func(opts *checkOpts) {
+		if d > 0 {
+			opts.timeout = d
+		}
+	}
+}
+
+// WithAdvisory reports the status of the check without failing the endpoint,
+// for components the service can degrade gracefully without
+func WithAdvisory() CheckOption {
+	return func(opts *checkOpts) {
+		opts.advisory = true
+	}
+}
+
+type check struct {
+	name string
+	kind kind
+	fn   Check
+	opts checkOpts
+	// cancel stops the loop of the check, guarded by the registry lock
+	cancel context.CancelFunc
+
+	mu      sync.RWMutex
+	ran     bool
+	err     error
+	checked time.Time
+}
+
+var registry struct {
+	mu      sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	checks  map[string]*check
+	started bool
+}
+
+// RegisterLiveness registers a check that fails the liveness endpoint, which
+// should only happen when the process can't recover without a restart
+func RegisterLiveness(name string, fn Check, opts ...CheckOption) {
+	register(name, liveness, fn, opts...)
+}
+
+// RegisterReadiness registers a check that fails the readiness endpoint while
+// the service can't accept traffic. Readiness checks are failing until their
+// first run completes.
+func RegisterReadiness(name string, fn Check, opts ...CheckOption) {
+	register(name, readiness, fn, opts...)
+}
+
+func register(name string, k kind, fn Check, opts ...CheckOption) {
+	opt := checkOpts{
+		period:  defaultPeriod,
+		timeout: defaultTimeout,
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	c := &check{
+		name: name,
+		kind: k,
+		fn:   fn,
+		opts: opt,
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if registry.checks == nil {
+		registry.checks = make(map[string]*check)
+	}
+	// the check replaced stops running, rather than reporting alongside it
+	if previous, ok := registry.checks[key(name, k)]; ok {
+		previous.stop()
+	}
+	registry.checks[key(name, k)] = c
+
+	if registry.started {
+		c.start(registry.ctx)
+	}
+}
+
+func key(name string, k kind) string {
+	return fmt.Sprintf("%s/%s", k, name)
+}
+
+// Start runs every registered check on its period until ctx is done. The
+// readiness endpoint fails until Start has been called, which kokoro.Init does
+// once initialization has completed.
+func Start(ctx context.Context) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if registry.started {
+		return
+	}
+
+	registry.ctx, registry.cancel = context.WithCancel(ctx)
+	registry.started = true
+
+	for _, c := range registry.checks {
+		c.start(registry.ctx)
+	}
+
+	_, held := gateReason()
+	recordGate(!held)
+}
+
+// Stop stops running the checks started by Start. The readiness endpoint fails
+// until Start is called again.
+func Stop() {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if !registry.started {
+		return
+	}
+
+	registry.cancel()
+	registry.ctx = nil
+	registry.cancel = nil
+	registry.started = false
+}
+
+func started() bool {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	return registry.started
+}
+
+// start runs the check on its period until ctx is done or it is stopped, must
+// be called with the registry lock held
+func (c *check) start(ctx context.Context) {
+	ctx, c.cancel = context.WithCancel(ctx)
+	go c.loop(ctx)
+}
+
+// stop stops running the check, must be called with the registry lock held
+func (c *check) stop() {
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
+}
+
+func (c *check) loop(ctx context.Context) {
+	ticker := clock.NewTicker(c.opts.period)
+	defer ticker.Stop()
+
+	for {
+		c.run(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+	}
+}
+
+func (c *check) run(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.timeout)
+	defer cancel()
+
+	err := c.call(ctx)
+
+	c.mu.Lock()
+	c.ran = true
+	c.err = err
+	c.checked = clock.Now()
+	c.mu.Unlock()
+
+	c.record(ctx, err)
+}
+
+func (c *check) call(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("check panicked: %v", r)
+		}
+	}()
+
+	return c.fn(ctx)
+}
+
+func (c *check) record(ctx context.Context, err error) {
+	if metrics.DefaultFactory == nil {
+		return
+	}
+
+	gauge, gerr := metrics.DefaultFactory.NewGauge("health_check_status",
+		metrics.WithDescription("1 when the health check is passing, 0 otherwise"),
+		metrics.WithLabelNames([]string{"check", "kind"}),
+	)
+	if gerr != nil {
+		return
+	}
+
+	status := 1.0
+	if err != nil {
+		status = 0
+	}
+
+	_ = gauge.Measure(context.WithoutCancel(ctx), status,
+		metrics.WithLabel("check", c.name), metrics.WithLabel("kind", string(c.kind)))
+}
+
+// Status is the result of the most recent run of a check
+type Status struct {
+	Name     string    `json:"name"`
+	Healthy  bool      `json:"healthy"`
+	Advisory bool      `json:"advisory,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Checked  time.Time `json:"checked"`
+}
+
+// Report is the status of every check of a kind
+type Report struct {
+	Healthy bool     `json:"healthy"`
+	Error   string   `json:"error,omitempty"`
+	Checks  []Status `json:"checks"`
+}
+
+func report(k kind) Report {
+	registry.mu.Lock()
+	checks := make([]*check, 0, len(registry.checks))
+	for _, c := range registry.checks {
+		if c.kind == k {
+			checks = append(checks, c)
+		}
+	}
+	registry.mu.Unlock()
+
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].name < checks[j].name
+	})
+
+	r := Report{
+		Healthy: true,
+		Checks:  make([]Status, 0, len(checks)),
+	}
+
+	if k == readiness {
+		reason, held := gateReason()
+
+		switch {
+		case !started():
+			r.Healthy = false
+			r.Error = ErrNotStarted.Error()
+		case held:
+			r.Healthy = false
+			r.Error = reason
+		}
+	}
+
+	for _, c := range checks {
+		c.mu.RLock()
+		s := Status{
+			Name:     c.name,
+			Healthy:  c.err == nil,
+			Advisory: c.opts.advisory,
+			Checked:  c.checked,
+		}
+
+		switch {
+		case c.err != nil:
+			s.Error = c.err.Error()
+		case !c.ran && k == readiness:
+			s.Healthy = false
+			s.Error = "pending"
+		}
+		c.mu.RUnlock()
+
+		if !s.Healthy && !s.Advisory {
+			r.Healthy = false
+		}
+
+		r.Checks = append(r.Checks, s)
+	}
+
+	return r
+}
+
+// Liveness returns the status of every liveness check
+func Liveness() Report {
+	return report(liveness)
+}
+
+// Readiness returns the status of every readiness check
+func Readiness() Report {
+	return report(readiness)
+}
+
+// LivenessHandler serves the liveness report, responding 503 when any check
+// is failing. Typically mounted at /healthz.
+func LivenessHandler() http.Handler {
+	return handler(Liveness)
+}
+
+// ReadinessHandler serves the readiness report, responding 503 when any check
+// is failing, the checks have not been started, or NotReady is holding the
+// service unready. Typically mounted at /readyz.
+func ReadinessHandler() http.Handler {
+	return handler(Readiness)
+}
+
+func handler(report func() Report) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rep := report()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !rep.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		err := json.NewEncoder(w).Encode(rep)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
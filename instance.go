@@ -0,0 +1,119 @@
+package kokoro
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Kokoro is a handle to a set of logs, metrics, and traces. The default
+// instance reports to the process wide defaults configured by Init, while
+// instances created with New are isolated from them, allowing tests and
+// embedded libraries to report elsewhere.
+type Kokoro struct {
+	logger         *slog.Logger
+	factory        metrics.Factory
+	tracerProvider trace.TracerProvider
+}
+
+type instanceOpts struct {
+	logger         *slog.Logger
+	factory        metrics.Factory
+	tracerProvider trace.TracerProvider
+}
+
+type InstanceOption func(*instanceOpts)
+
+// WithLogger sets the logger the instance writes to
+func WithLogger(logger *slog.Logger) InstanceOption {
+	return func(o *instanceOpts) {
+		o.logger = logger
+	}
+}
+
+// WithMetricsFactory sets the factory the instance creates metrics with
+func WithMetricsFactory(factory metrics.Factory) InstanceOption {
+	return func(o *instanceOpts) {
+		o.factory = factory
+	}
+}
+
+// WithTracerProvider sets the provider the instance creates spans with
+func WithTracerProvider(tp trace.TracerProvider) InstanceOption {
+	return func(o *instanceOpts) {
+		o.tracerProvider = tp
+	}
+}
+
+var defaultInstance = &Kokoro{}
+
+// Default returns the instance reporting to the process wide defaults, which
+// Init returns and the package level functions delegate to
+func Default() *Kokoro {
+	return defaultInstance
+}
+
+// New creates an instance reporting to the logger, metrics factory, and tracer
+// provider provided. Any that are not provided fall back to the process wide
+// defaults.
+func New(opts ...InstanceOption) *Kokoro {
+	opt := instanceOpts{}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	return &Kokoro{
+		logger:         opt.logger,
+		factory:        opt.factory,
+		tracerProvider: opt.tracerProvider,
+	}
+}
+
+// Logger returns the logger the instance writes to
+func (k *Kokoro) Logger() *slog.Logger {
+	if k.logger == nil {
+		return slog.Default()
+	}
+
+	return k.logger
+}
+
+// Metrics returns the factory the instance creates metrics with
+func (k *Kokoro) Metrics() metrics.Factory {
+	if k.factory == nil {
+		return metrics.DefaultFactory
+	}
+
+	return k.factory
+}
+
+// Tracer returns a tracer from the provider the instance creates spans with,
+// attributed to the same instrumentation scope as operation spans
+func (k *Kokoro) Tracer() trace.Tracer {
+	tp := k.tracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+
+	return koko.Tracer(tp)
+}
+
+// Context returns a context whose operations report to the instance
+func (k *Kokoro) Context(ctx context.Context) context.Context {
+	return koko.WithTelemetry(ctx, koko.Telemetry{
+		Logger:         k.logger,
+		Metrics:        k.factory,
+		TracerProvider: k.tracerProvider,
+	})
+}
+
+// Operation starts an operation reporting to the instance, see koko.Operation
+func (k *Kokoro) Operation(ctx context.Context, operation string, opts ...koko.OperationOption) (context.Context, koko.Done) {
+	opts = append(opts, koko.WithCallerSkip(1))
+
+	return koko.Operation(k.Context(ctx), operation, opts...)
+}
@@ -0,0 +1,128 @@
+// Package clock is the source of time for operation timing, periodic jobs,
+// and samplers, so tests can replace it to control time deterministically,
+// see kokotest.NewClock.
+package clock
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Clock tells the time and creates timers and tickers
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer delivers the time on C once its duration has elapsed
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// Ticker delivers the time on C every period
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+type holder struct {
+	clock Clock
+}
+
+var current atomic.Pointer[holder]
+
+// Set replaces the clock, returning a func restoring the previous one.
+// Setting nil restores the system clock.
+func Set(c Clock) func() {
+	previous := current.Swap(&holder{clock: c})
+
+	return func() {
+		current.Store(previous)
+	}
+}
+
+func get() Clock {
+	h := current.Load()
+	if h == nil || h.clock == nil {
+		return system{}
+	}
+
+	return h.clock
+}
+
+// Now returns the current time of the clock
+func Now() time.Time {
+	return get().Now()
+}
+
+// Since returns the time elapsed on the clock since t
+func Since(t time.Time) time.Duration {
+	return get().Now().Sub(t)
+}
+
+// NewTimer creates a timer firing after d on the clock
+func NewTimer(d time.Duration) Timer {
+	return get().NewTimer(d)
+}
+
+// NewTicker creates a ticker firing every d on the clock
+func NewTicker(d time.Duration) Ticker {
+	return get().NewTicker(d)
+}
+
+// AfterFunc calls f in its own goroutine once d has elapsed on the clock. The
+// returned func stops the timer, reporting false if f was already called.
+func AfterFunc(d time.Duration, f func()) (stop func() bool) {
+	timer := NewTimer(d)
+	stopped := make(chan struct{})
+
+	go func() {
+		select {
+		case <-timer.C():
+			f()
+		case <-stopped:
+		}
+	}()
+
+	var once sync.Once
+	return func() bool {
+		active := timer.Stop()
+		once.Do(func() { close(stopped) })
+
+		return active
+	}
+}
+
+// system is the clock of the time package
+type system struct{}
+
+func (system) Now() time.Time {
+	return time.Now()
+}
+
+func (system) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+func (system) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
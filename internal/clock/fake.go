@@ -0,0 +1,145 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a clock that only moves when advanced
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*waiter
+}
+
+// waiter is a timer, or a ticker when its period is set
+type waiter struct {
+	fake   *Fake
+	c      chan time.Time
+	at     time.Time
+	period time.Duration
+}
+
+// NewFake creates a clock stopped at the time provided
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+// Advance moves the clock forward by d, firing every timer and ticker due by
+// the new time. Like those of the time package, a ticker falling behind
+// drops ticks rather than queueing them.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+
+	kept := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.at.After(f.now) {
+			kept = append(kept, w)
+			continue
+		}
+
+		select {
+		case w.c <- f.now:
+		default:
+		}
+
+		if w.period > 0 {
+			for !w.at.After(f.now) {
+				w.at = w.at.Add(w.period)
+			}
+			kept = append(kept, w)
+		}
+	}
+	f.waiters = kept
+}
+
+// Waiters returns the number of timers and tickers waiting to fire, so tests
+// can wait for a goroutine to start waiting before advancing the clock
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.waiters)
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	return fakeTimer{f.add(d, 0)}
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+
+	return fakeTicker{f.add(d, d)}
+}
+
+func (f *Fake) add(d, period time.Duration) *waiter {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w := &waiter{
+		fake:   f,
+		c:      make(chan time.Time, 1),
+		at:     f.now.Add(d),
+		period: period,
+	}
+
+	if d <= 0 && period == 0 {
+		w.c <- f.now
+		return w
+	}
+
+	f.waiters = append(f.waiters, w)
+
+	return w
+}
+
+// remove stops the waiter, reporting whether it was waiting
+func (f *Fake) remove(w *waiter) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, other := range f.waiters {
+		if other == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+type fakeTimer struct {
+	*waiter
+}
+
+func (t fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t fakeTimer) Stop() bool {
+	return t.fake.remove(t.waiter)
+}
+
+type fakeTicker struct {
+	*waiter
+}
+
+func (t fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t fakeTicker) Stop() {
+	t.fake.remove(t.waiter)
+}
@@ -0,0 +1,152 @@
+// Package kaws instruments AWS API calls with koko operations without
+// depending on the AWS SDK.
+//
+// With the AWS SDK for Go v2, Invoke is registered as an initialize
+// middleware so it wraps each call along with its retries:
+//
+//	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+//		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("kaws",
+//			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (
+//				out middleware.InitializeOutput, md middleware.Metadata, err error,
+//			) {
+//				call := kaws.Call{
+//					Service:   awsmiddleware.GetServiceID(ctx),
+//					Operation: awsmiddleware.GetOperationName(ctx),
+//					Region:    awsmiddleware.GetRegion(ctx),
+//				}
+//				err = kaws.Invoke(ctx, call, func(ctx context.Context) (kaws.Result, error) {
+//					out, md, err = next.HandleInitialize(ctx, in)
+//
+//					var res kaws.Result
+//					if attempts, ok := retry.GetAttemptResults(md); ok {
+//						res.Attempts = len(attempts.Results)
+//					}
+//					var re *awshttp.ResponseError
+//					if errors.As(err, &re) {
+//						res.StatusCode = re.HTTPStatusCode()
+//					}
+//
+//					return res, err
+//				})
+//
+//				return out, md, err
+//			}), middleware.After)
+//	})
+package kaws
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/kzs0/kokoro/kerr"
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+const defaultOperation = "aws_call"
+
+// Call identifies an AWS API call
+type Call struct {
+	// Service is the service ID, e.g. S3
+	Service string
+	// Operation is the API operation, e.g. GetObject
+	Operation string
+	Region    string
+}
+
+// Result describes how a call completed
+type Result struct {
+	// StatusCode is the HTTP status of the last response, zero when unknown
+	StatusCode int
+	// Attempts is the number of attempts made, including retries
+	Attempts int
+}
+
+type awsOpts struct {
+	operation string
+	opOpts    []koko.OperationOption
+}
+
+type Option func(*awsOpts)
+
+// WithOperationName sets the name of the operation started for each call.
+// Defaults to aws_call.
+func WithOperationName(name string) Option {
+	return func(opts *awsOpts) {
+		opts.operation = name
+	}
+}
+
+// WithOperationOptions applies additional options to the operation started
+// for each call
+func WithOperationOptions(opts ...koko.OperationOption) Option {
+	return func(o *awsOpts) {
+		o.opOpts = append(o.opOpts, opts...)
+	}
+}
+
+// Invoke makes a call with fn within a client operation labeled with the
+// service, API operation, and status. Retries are counted by the
+// <operation>_retries counter. Error responses are categorized from their
+// status, see kerr.FromStatus, so e.g. a missing S3 object is an expected
+// outcome rather than a failure. The error returned is the one fn returned.
+func Invoke(ctx context.Context, call Call, fn func(context.Context) (Result, error), opts ...Option) error {
+	opt := awsOpts{operation: defaultOperation}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	opOpts := append([]koko.OperationOption{
+		koko.WithSpanKind(koko.SpanKindClient),
+		koko.WithLabels("service", "method", "status"),
+	}, opt.opOpts...)
+
+	var err error
+	ctx, done := koko.Operation(ctx, opt.operation, opOpts...)
+	defer func() { done(&ctx, &err) }()
+
+	ctx = koko.Register(ctx,
+		koko.Str("rpc.system", "aws-api", koko.TraceOnly()),
+		koko.Str("service", call.Service),
+		koko.Str("method", call.Operation),
+		koko.Str("cloud.region", call.Region, koko.LogOnly(), koko.TraceOnly()),
+	)
+
+	res, callErr := fn(ctx)
+
+	status := res.StatusCode
+	if status == 0 && callErr == nil {
+		status = http.StatusOK
+	}
+	ctx = koko.Register(ctx,
+		koko.Str("status", strconv.Itoa(status)),
+		koko.Int64("attempts", int64(res.Attempts), koko.LogOnly(), koko.TraceOnly()),
+	)
+
+	if res.Attempts > 1 {
+		recordRetries(ctx, opt.operation, call, res.Attempts-1)
+	}
+
+	err = callErr
+	if c := kerr.FromStatus(res.StatusCode); callErr != nil && c != "" {
+		err = kerr.Wrap(callErr, c)
+	}
+
+	return callErr
+}
+
+func recordRetries(ctx context.Context, operation string, call Call, retries int) {
+	counter, err := koko.Counter(operation+"_retries",
+		metrics.WithDescription("retries of AWS API calls"),
+		metrics.WithLabelNames([]string{"service", "method"}),
+	)
+	if err != nil {
+		return
+	}
+
+	_ = counter.Add(ctx, float64(retries),
+		metrics.WithLabel("service", call.Service),
+		metrics.WithLabel("method", call.Operation),
+	)
+}
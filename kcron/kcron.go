@@ -0,0 +1,219 @@
+// Package kcron instruments scheduled jobs with koko operations, for
+// schedulers like robfig/cron that run jobs implementing Run().
+//
+// A scheduler that stalls runs nothing and so reports nothing, which is why a
+// job given its schedule counts the runs it missed:
+//
+//	schedule, _ := cron.ParseStandard("*/5 * * * *")
+//	c.Schedule(schedule, kcron.NewJob(ctx, "cleanup", cleanup, kcron.WithSchedule(schedule)))
+package kcron
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kzs0/kokoro/internal/clock"
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+const (
+	defaultOperation = "cron_job"
+	defaultTolerance = time.Minute
+)
+
+// Schedule returns the next time a job runs after the time provided, as
+// robfig/cron schedules do
+type Schedule interface {
+	Next(time.Time) time.Time
+}
+
+type jobOpts struct {
+	operation string
+	schedule  Schedule
+	tolerance time.Duration
+	overlap   bool
+	opOpts    []koko.OperationOption
+}
+
+type Option func(*jobOpts)
+
+// WithOperationName sets the name of the operation started for each run.
+// Defaults to cron_job.
+func WithOperationName(name string) Option {
+	return func(opts *jobOpts) {
+		opts.operation = name
+	}
+}
+
+// WithSchedule enables missed run detection for a job run on the schedule
+// provided. A run that hasn't started within the tolerance of its scheduled
+// time is counted by the cron_missed_runs counter.
+func WithSchedule(schedule Schedule) Option {
+	return func(opts *jobOpts) {
+		opts.schedule = schedule
+	}
+}
+
+// WithTolerance sets how late a run may start before it is counted as
+// missed. Defaults to 1 minute, which a non-positive tolerance keeps.
+func WithTolerance(d time.Duration) Option {
+	return func(opts *jobOpts) {
+		if d > 0 {
+			opts.tolerance = d
+		}
+	}
+}
+
+// WithOverlap allows a run to start while the previous one is still running.
+// By default the run is skipped and counted by the cron_skipped_runs counter.
+func WithOverlap() Option {
+	return func(opts *jobOpts) {
+		opts.overlap = true
+	}
+}
+
+// WithOperationOptions applies additional options to the operation started
+// for each run
+func WithOperationOptions(opts ...koko.OperationOption) Option {
+	return func(o *jobOpts) {
+		o.opOpts = append(o.opOpts, opts...)
+	}
+}
+
+// Job runs a func as an operation labeled with the name of the job
+type Job struct {
+	ctx  context.Context
+	name string
+	fn   func(context.Context) error
+	opt  jobOpts
+
+	mu      sync.Mutex
+	running bool
+	next    time.Time
+}
+
+// NewJob creates a job running fn. ctx is the parent of every run, and when a
+// schedule is provided missed runs are detected until ctx is done.
+func NewJob(ctx context.Context, name string, fn func(context.Context) error, opts ...Option) *Job {
+	opt := jobOpts{
+		operation: defaultOperation,
+		tolerance: defaultTolerance,
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	j := &Job{
+		ctx:  ctx,
+		name: name,
+		fn:   fn,
+		opt:  opt,
+	}
+
+	if opt.schedule != nil {
+		j.next = opt.schedule.Next(clock.Now())
+		go j.watch()
+	}
+
+	return j
+}
+
+// Run runs the job, implementing the robfig/cron Job interface. Errors are
+// reported by the operation.
+func (j *Job) Run() {
+	_ = j.RunContext(j.ctx)
+}
+
+// RunContext runs the job within ctx, returning the error of the job. The run
+// is skipped, returning nil, when the previous run hasn't finished and
+// overlapping runs aren't allowed.
+func (j *Job) RunContext(ctx context.Context) (err error) {
+	start := clock.Now()
+
+	j.mu.Lock()
+	if j.opt.schedule != nil {
+		j.next = j.opt.schedule.Next(start)
+	}
+	if j.running && !j.opt.overlap {
+		j.mu.Unlock()
+		j.count(ctx, "cron_skipped_runs", "runs skipped because the previous run was still running", 1)
+		return nil
+	}
+	j.running = true
+	j.mu.Unlock()
+
+	defer func() {
+		j.mu.Lock()
+		j.running = false
+		j.mu.Unlock()
+	}()
+
+	opOpts := append([]koko.OperationOption{
+		koko.WithLabels("job"),
+	}, j.opt.opOpts...)
+
+	ctx, done := koko.Operation(ctx, j.opt.operation, opOpts...)
+	defer done(&ctx, &err)
+
+	ctx = koko.Register(ctx, koko.Str("job", j.name))
+
+	err = j.fn(ctx)
+	if err == nil {
+		j.recordSuccess(ctx)
+	}
+
+	return err
+}
+
+// watch counts the scheduled runs that haven't started within the tolerance
+// of their scheduled time
+func (j *Job) watch() {
+	ticker := clock.NewTicker(j.opt.tolerance)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-j.ctx.Done():
+			return
+		case now := <-ticker.C():
+			missed := 0
+
+			j.mu.Lock()
+			for !j.next.IsZero() && now.Sub(j.next) > j.opt.tolerance {
+				missed++
+				j.next = j.opt.schedule.Next(j.next)
+			}
+			j.mu.Unlock()
+
+			if missed > 0 {
+				j.count(j.ctx, "cron_missed_runs", "scheduled runs that didn't start", missed)
+			}
+		}
+	}
+}
+
+func (j *Job) recordSuccess(ctx context.Context) {
+	gauge, err := koko.Gauge("cron_last_success_timestamp_seconds",
+		metrics.WithDescription("time of the last successful run since unix epoch in seconds"),
+		metrics.WithLabelNames([]string{"job"}),
+	)
+	if err != nil {
+		return
+	}
+
+	_ = gauge.Measure(ctx, float64(clock.Now().UnixNano())/float64(time.Second), metrics.WithLabel("job", j.name))
+}
+
+func (j *Job) count(ctx context.Context, name, desc string, n int) {
+	counter, err := koko.Counter(name,
+		metrics.WithDescription(desc),
+		metrics.WithLabelNames([]string{"job"}),
+	)
+	if err != nil {
+		return
+	}
+
+	_ = counter.Add(ctx, float64(n), metrics.WithLabel("job", j.name))
+}
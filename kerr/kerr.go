@@ -0,0 +1,157 @@
+// Package kerr categorizes errors so operations can tell failures of the
+// service apart from errors that are an expected response to a request, such
+// as a missing record or invalid input.
+//
+// Operations returning an error in an expected category are not counted as
+// failures, are logged at their registered level, and leave the span status
+// unset. Every categorized error is reported with an error_category label.
+package kerr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Category classifies an error. A Category is itself an error so that
+// errors.Is(err, kerr.NotFound) reports whether err is in the category.
+type Category string
+
+const (
+	// NotFound means the requested entity does not exist
+	NotFound Category = "not_found"
+	// Invalid means the request was malformed or failed validation
+	Invalid Category = "invalid"
+	// Conflict means the request conflicts with the current state, e.g. a
+	// duplicate or a failed precondition
+	Conflict Category = "conflict"
+	// Unauthenticated means the caller could not be identified
+	Unauthenticated Category = "unauthenticated"
+	// PermissionDenied means the caller is not allowed to make the request
+	PermissionDenied Category = "permission_denied"
+	// RateLimited means the caller has exceeded a quota
+	RateLimited Category = "rate_limited"
+	// Unavailable means a dependency could not be reached, the request may
+	// succeed if retried
+	Unavailable Category = "unavailable"
+	// Internal means the service failed, the default for uncategorized errors
+	Internal Category = "internal"
+)
+
+func (c Category) Error() string {
+	return string(c)
+}
+
+// Expected reports whether errors in the category are an expected response to
+// the request rather than a failure of the service
+func (c Category) Expected() bool {
+	switch c {
+	case NotFound, Invalid, Conflict, Unauthenticated, PermissionDenied, RateLimited:
+		return true
+	default:
+		return false
+	}
+}
+
+// Error is an error assigned a category
+type Error struct {
+	Category Category
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the category of the error, so errors.Is(err, kerr.NotFound)
+// holds for any error categorized as NotFound
+func (e *Error) Is(target error) bool {
+	c, ok := target.(Category)
+	return ok && c == e.Category
+}
+
+// New returns an error in the category with the message provided
+func New(c Category, msg string) error {
+	return &Error{Category: c, Err: errors.New(msg)}
+}
+
+// Newf returns an error in the category, formatting the message as fmt.Errorf
+// does
+func Newf(c Category, format string, args ...any) error {
+	return &Error{Category: c, Err: fmt.Errorf(format, args...)}
+}
+
+// Wrap assigns err to the category, returning nil when err is nil
+func Wrap(err error, c Category) error {
+	if err == nil {
+		return nil
+	}
+
+	return &Error{Category: c, Err: err}
+}
+
+// Wrapf assigns err to the category, prefixing it with the formatted message.
+// Returns nil when err is nil.
+func Wrapf(err error, c Category, format string, args ...any) error {
+	if err == nil {
+		return nil
+	}
+
+	return &Error{Category: c, Err: fmt.Errorf("%s: %w", fmt.Sprintf(format, args...), err)}
+}
+
+// CategoryOf returns the category of the outermost categorized error in the
+// chain of err, Internal when none is categorized, or the empty category when
+// err is nil
+func CategoryOf(err error) Category {
+	if err == nil {
+		return ""
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Category
+	}
+
+	var c Category
+	if errors.As(err, &c) {
+		return c
+	}
+
+	return Internal
+}
+
+// IsExpected reports whether err is in an expected category, see
+// Category.Expected
+func IsExpected(err error) bool {
+	return err != nil && CategoryOf(err).Expected()
+}
+
+// FromStatus returns the category of an HTTP response status, or the empty
+// category for statuses that aren't errors
+func FromStatus(status int) Category {
+	switch {
+	case status < http.StatusBadRequest:
+		return ""
+	case status == http.StatusNotFound:
+		return NotFound
+	case status == http.StatusConflict, status == http.StatusPreconditionFailed:
+		return Conflict
+	case status == http.StatusUnauthorized:
+		return Unauthenticated
+	case status == http.StatusForbidden:
+		return PermissionDenied
+	case status == http.StatusTooManyRequests:
+		return RateLimited
+	case status == http.StatusBadGateway, status == http.StatusServiceUnavailable, status == http.StatusGatewayTimeout:
+		return Unavailable
+	case status < http.StatusInternalServerError:
+		return Invalid
+	default:
+		return Internal
+	}
+}
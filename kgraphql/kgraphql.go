@@ -0,0 +1,208 @@
+// Package kgraphql instruments GraphQL servers with koko operations without
+// depending on a particular server library.
+//
+// With gqlgen, a Tracer is installed as a handler extension with
+// srv.Use(extension{t: kgraphql.NewTracer()}):
+//
+//	type extension struct{ t *kgraphql.Tracer }
+//
+//	func (extension) ExtensionName() string                   { return "kokoro" }
+//	func (extension) Validate(graphql.ExecutableSchema) error { return nil }
+//
+//	func (e extension) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+//		req := kgraphql.Request{Operation: graphql.GetOperationContext(ctx).OperationName}
+//		if stats := extension.GetComplexityStats(ctx); stats != nil {
+//			req.Complexity = stats.Complexity
+//		}
+//
+//		var resp *graphql.Response
+//		_ = e.t.Request(ctx, req, func(ctx context.Context) error {
+//			resp = next(ctx)
+//			if resp != nil && len(resp.Errors) > 0 {
+//				return resp.Errors
+//			}
+//			return nil
+//		})
+//
+//		return resp
+//	}
+//
+//	func (e extension) InterceptField(ctx context.Context, next graphql.Resolver) (any, error) {
+//		fc := graphql.GetFieldContext(ctx)
+//		return e.t.Field(ctx, kgraphql.Field{Object: fc.Object, Name: fc.Field.Name, Resolver: fc.IsResolver}, next)
+//	}
+package kgraphql
+
+import (
+	"context"
+
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+const (
+	defaultRequestOperation = "graphql_request"
+	defaultFieldOperation   = "graphql_field"
+
+	// other replaces the label value of operations and fields that aren't
+	// allowlisted
+	other = "other"
+)
+
+// Request describes a GraphQL request
+type Request struct {
+	// Operation is the operation name sent by the client
+	Operation string
+	// Complexity is the calculated complexity of the query, zero when unknown
+	Complexity int
+}
+
+// Field describes a field being resolved
+type Field struct {
+	// Object is the type the field belongs to, e.g. Query
+	Object string
+	// Name is the name of the field
+	Name string
+	// Resolver reports whether the field is resolved by a method or resolver,
+	// rather than read from a struct field
+	Resolver bool
+}
+
+func (f Field) path() string {
+	return f.Object + "." + f.Name
+}
+
+type tracerOpts struct {
+	requestOperation string
+	fieldOperation   string
+	operations       map[string]bool
+	fields           map[string]bool
+	trivial          bool
+}
+
+type Option func(*tracerOpts)
+
+// WithOperationNames sets the names of the operations started for each
+// request and resolved field. Defaults to graphql_request and graphql_field.
+func WithOperationNames(request, field string) Option {
+	return func(opts *tracerOpts) {
+		opts.requestOperation = request
+		opts.fieldOperation = field
+	}
+}
+
+// WithOperationAllowlist reports the GraphQL operation names provided as the
+// graphql_operation label. Operation names are chosen by clients, so any other
+// name is reported as other and only recorded on the span.
+func WithOperationAllowlist(names ...string) Option {
+	return func(opts *tracerOpts) {
+		if opts.operations == nil {
+			opts.operations = make(map[string]bool)
+		}
+		for _, n := range names {
+			opts.operations[n] = true
+		}
+	}
+}
+
+// WithFieldAllowlist only reports the fields provided, e.g. Query.user, as
+// the field label, any other field is reported as other. Fields are bounded by
+// the schema so every field is reported by default.
+func WithFieldAllowlist(fields ...string) Option {
+	return func(opts *tracerOpts) {
+		if opts.fields == nil {
+			opts.fields = make(map[string]bool)
+		}
+		for _, f := range fields {
+			opts.fields[f] = true
+		}
+	}
+}
+
+// WithTrivialFields also starts operations for fields read from struct
+// fields, which are skipped by default since they would dwarf the resolvers
+// doing work
+func WithTrivialFields() Option {
+	return func(opts *tracerOpts) {
+		opts.trivial = true
+	}
+}
+
+// Tracer wraps requests and field resolvers in operations
+type Tracer struct {
+	opt tracerOpts
+}
+
+// NewTracer creates a Tracer with the options provided
+func NewTracer(opts ...Option) *Tracer {
+	opt := tracerOpts{
+		requestOperation: defaultRequestOperation,
+		fieldOperation:   defaultFieldOperation,
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	return &Tracer{opt: opt}
+}
+
+// Request runs a request with next within an operation labeled with the
+// GraphQL operation name, if allowlisted. The complexity of the query is
+// observed in the graphql_complexity histogram.
+func (t *Tracer) Request(ctx context.Context, req Request, next func(context.Context) error) (err error) {
+	ctx, done := koko.Operation(ctx, t.opt.requestOperation,
+		koko.WithSpanKind(koko.SpanKindServer),
+		koko.WithLabels("graphql_operation"),
+	)
+	defer done(&ctx, &err)
+
+	operation := req.Operation
+	if !t.opt.operations[operation] {
+		operation = other
+	}
+
+	ctx = koko.Register(ctx,
+		koko.Str("graphql_operation", operation),
+		koko.Str("graphql.operation.name", req.Operation, koko.LogOnly(), koko.TraceOnly()),
+	)
+
+	if req.Complexity > 0 {
+		ctx = koko.Register(ctx, koko.Int64("complexity", int64(req.Complexity), koko.LogOnly(), koko.TraceOnly()))
+		recordComplexity(ctx, operation, req.Complexity)
+	}
+
+	return next(ctx)
+}
+
+// Field resolves a field with next within an operation labeled with the field,
+// a child of the request. Trivial fields are resolved without an operation
+// unless WithTrivialFields is set.
+func (t *Tracer) Field(ctx context.Context, f Field, next func(context.Context) (any, error)) (res any, err error) {
+	if !f.Resolver && !t.opt.trivial {
+		return next(ctx)
+	}
+
+	ctx, done := koko.Operation(ctx, t.opt.fieldOperation, koko.WithLabels("field"))
+	defer done(&ctx, &err)
+
+	field := f.path()
+	if t.opt.fields != nil && !t.opt.fields[field] {
+		ctx = koko.Register(ctx, koko.Str("field", other), koko.Str("graphql.field", field, koko.LogOnly(), koko.TraceOnly()))
+	} else {
+		ctx = koko.Register(ctx, koko.Str("field", field))
+	}
+
+	return next(ctx)
+}
+
+func recordComplexity(ctx context.Context, operation string, complexity int) {
+	hist, err := koko.Histogram("graphql_complexity",
+		metrics.WithDescription("calculated complexity of GraphQL queries"),
+		metrics.WithLabelNames([]string{"graphql_operation"}),
+	)
+	if err != nil {
+		return
+	}
+
+	_ = hist.Record(ctx, float64(complexity), metrics.WithLabel("graphql_operation", operation))
+}
@@ -0,0 +1,357 @@
+// Package kgrpc instruments gRPC servers with koko operations without
+// depending on grpc.
+//
+// The interceptors take the arguments of grpc.UnaryServerInterceptor and
+// grpc.StreamServerInterceptor, so installing them is a thin adapter:
+//
+//	opts := []kgrpc.Option{
+//		kgrpc.WithMetadata(func(ctx context.Context) map[string][]string {
+//			md, _ := metadata.FromIncomingContext(ctx)
+//			return md
+//		}),
+//		kgrpc.WithCodeFunc(func(err error) kgrpc.Code {
+//			return kgrpc.Code(status.Code(err))
+//		}),
+//	}
+//	unary := kgrpc.UnaryServerInterceptor(opts...)
+//	stream := kgrpc.StreamServerInterceptor(opts...)
+//
+//	grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+//		return unary(ctx, req, &kgrpc.UnaryServerInfo{FullMethod: info.FullMethod}, kgrpc.UnaryHandler(handler))
+//	})
+//
+// Stream handlers are given a stream whose context is that of the operation,
+// which the adapter passes on by overriding Context of the grpc stream:
+//
+//	type serverStream struct {
+//		grpc.ServerStream
+//		ctx context.Context
+//	}
+//
+//	func (s serverStream) Context() context.Context { return s.ctx }
+//
+//	grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+//		return stream(srv, ss, &kgrpc.StreamServerInfo{
+//			FullMethod:     info.FullMethod,
+//			IsClientStream: info.IsClientStream,
+//			IsServerStream: info.IsServerStream,
+//		}, func(srv any, s kgrpc.ServerStream) error {
+//			return handler(srv, serverStream{ServerStream: ss, ctx: s.Context()})
+//		})
+//	})
+package kgrpc
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/kzs0/kokoro/kerr"
+	"github.com/kzs0/kokoro/koko"
+	"go.opentelemetry.io/otel"
+)
+
+const defaultOperation = "grpc_request"
+
+// Code is a gRPC status code, numbered as in google.golang.org/grpc/codes
+type Code uint32
+
+const (
+	OK Code = iota
+	Canceled
+	Unknown
+	InvalidArgument
+	DeadlineExceeded
+	NotFound
+	AlreadyExists
+	PermissionDenied
+	ResourceExhausted
+	FailedPrecondition
+	Aborted
+	OutOfRange
+	Unimplemented
+	Internal
+	Unavailable
+	DataLoss
+	Unauthenticated
+)
+
+var codeNames = [...]string{
+	"OK", "Canceled", "Unknown", "InvalidArgument", "DeadlineExceeded", "NotFound",
+	"AlreadyExists", "PermissionDenied", "ResourceExhausted", "FailedPrecondition",
+	"Aborted", "OutOfRange", "Unimplemented", "Internal", "Unavailable", "DataLoss",
+	"Unauthenticated",
+}
+
+func (c Code) String() string {
+	if int(c) < len(codeNames) {
+		return codeNames[c]
+	}
+
+	return "Code(" + strconv.FormatUint(uint64(c), 10) + ")"
+}
+
+// UnaryServerInfo describes the unary call being served, as
+// grpc.UnaryServerInfo does
+type UnaryServerInfo struct {
+	// FullMethod is the method called, e.g. /package.Service/Method
+	FullMethod string
+}
+
+// UnaryHandler serves a unary call, as grpc.UnaryHandler does
+type UnaryHandler func(ctx context.Context, req any) (any, error)
+
+// UnaryInterceptor intercepts unary calls, as grpc.UnaryServerInterceptor
+// does
+type UnaryInterceptor func(ctx context.Context, req any, info *UnaryServerInfo, handler UnaryHandler) (any, error)
+
+// StreamServerInfo describes the streaming call being served, as
+// grpc.StreamServerInfo does
+type StreamServerInfo struct {
+	// FullMethod is the method called, e.g. /package.Service/Method
+	FullMethod     string
+	IsClientStream bool
+	IsServerStream bool
+}
+
+// ServerStream is the part of grpc.ServerStream the interceptors use
+type ServerStream interface {
+	Context() context.Context
+	SendMsg(m any) error
+	RecvMsg(m any) error
+}
+
+// StreamHandler serves a streaming call, as grpc.StreamHandler does
+type StreamHandler func(srv any, stream ServerStream) error
+
+// StreamInterceptor intercepts streaming calls, as
+// grpc.StreamServerInterceptor does
+type StreamInterceptor func(srv any, ss ServerStream, info *StreamServerInfo, handler StreamHandler) error
+
+type interceptorOpts struct {
+	operation string
+	metadata  func(context.Context) map[string][]string
+	code      func(error) Code
+	opOpts    []koko.OperationOption
+}
+
+type Option func(*interceptorOpts)
+
+// WithOperationName sets the name of the operation started for each call.
+// Defaults to grpc_request.
+func WithOperationName(name string) Option {
+	return func(opts *interceptorOpts) {
+		opts.operation = name
+	}
+}
+
+// WithMetadata reads the incoming metadata of a call, e.g. with
+// metadata.FromIncomingContext, which the trace context is extracted from.
+// Without it calls start new traces.
+func WithMetadata(metadata func(context.Context) map[string][]string) Option {
+	return func(opts *interceptorOpts) {
+		opts.metadata = metadata
+	}
+}
+
+// WithCodeFunc reports the status code of the error a call returned, e.g.
+// with status.Code. By default the code is derived from context errors and
+// the kerr category of the error.
+func WithCodeFunc(code func(error) Code) Option {
+	return func(opts *interceptorOpts) {
+		opts.code = code
+	}
+}
+
+// WithOperationOptions applies additional options to the operation started
+// for each call
+func WithOperationOptions(opts ...koko.OperationOption) Option {
+	return func(o *interceptorOpts) {
+		o.opOpts = append(o.opOpts, opts...)
+	}
+}
+
+// UnaryServerInterceptor starts an operation for every unary call, see
+// StreamServerInterceptor
+func UnaryServerInterceptor(opts ...Option) UnaryInterceptor {
+	s := newServer(opts)
+
+	return func(ctx context.Context, req any, info *UnaryServerInfo, handler UnaryHandler) (any, error) {
+		var resp any
+		err := s.serve(ctx, info.FullMethod, func(ctx context.Context) error {
+			var err error
+			resp, err = handler(ctx, req)
+			return err
+		})
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor starts an operation for every streaming call. The
+// trace context is extracted from the metadata read WithMetadata, the
+// service, method, and status code are registered as attributes, and codes
+// reporting a failure of the server, e.g. Internal or Unavailable, fail the
+// operation while the others, e.g. NotFound, are expected outcomes. A
+// panicking handler fails the operation with the panic before the panic is
+// left for grpc to handle. The error returned is the one the handler
+// returned.
+func StreamServerInterceptor(opts ...Option) StreamInterceptor {
+	s := newServer(opts)
+
+	return func(srv any, ss ServerStream, info *StreamServerInfo, handler StreamHandler) error {
+		return s.serve(ss.Context(), info.FullMethod, func(ctx context.Context) error {
+			ctx = koko.Register(ctx,
+				koko.Bool("client_stream", info.IsClientStream, koko.LogOnly(), koko.TraceOnly()),
+				koko.Bool("server_stream", info.IsServerStream, koko.LogOnly(), koko.TraceOnly()),
+			)
+
+			return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		})
+	}
+}
+
+type server struct {
+	interceptorOpts
+	operationOpts []koko.OperationOption
+}
+
+func newServer(opts []Option) *server {
+	opt := interceptorOpts{operation: defaultOperation, code: codeOf}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	return &server{
+		interceptorOpts: opt,
+		operationOpts: append(append([]koko.OperationOption{
+			koko.WithSpanKind(koko.SpanKindServer),
+			koko.WithLabels("service", "method", "code"),
+		}, opt.opOpts...), koko.WithRepanic()),
+	}
+}
+
+// serve runs next within the operation of the call to fullMethod, returning
+// the error next returned
+func (s *server) serve(ctx context.Context, fullMethod string, next func(context.Context) error) error {
+	if s.metadata != nil {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(s.metadata(ctx)))
+	}
+
+	var err error
+	ctx, done := koko.Operation(ctx, s.operation, s.operationOpts...)
+	defer done(&ctx, &err)
+
+	service, method := splitMethod(fullMethod)
+	ctx = koko.Register(ctx,
+		koko.Str("rpc.system", "grpc", koko.TraceOnly()),
+		koko.Str("service", service),
+		koko.Str("method", method),
+	)
+
+	callErr := next(ctx)
+
+	code := s.code(callErr)
+	ctx = koko.Register(ctx, koko.Str("code", code.String()))
+
+	err = callErr
+	if c, ok := categories[code]; ok && callErr != nil {
+		err = kerr.Wrap(callErr, c)
+	}
+
+	return callErr
+}
+
+// categories are the kerr categories of the codes which are not a failure of
+// the server, see the OpenTelemetry semantic conventions for gRPC
+var categories = map[Code]kerr.Category{
+	InvalidArgument:    kerr.Invalid,
+	OutOfRange:         kerr.Invalid,
+	NotFound:           kerr.NotFound,
+	AlreadyExists:      kerr.Conflict,
+	FailedPrecondition: kerr.Conflict,
+	Aborted:            kerr.Conflict,
+	PermissionDenied:   kerr.PermissionDenied,
+	Unauthenticated:    kerr.Unauthenticated,
+	ResourceExhausted:  kerr.RateLimited,
+}
+
+// codeOf derives the status code of err from context errors and its kerr
+// category
+func codeOf(err error) Code {
+	switch {
+	case err == nil:
+		return OK
+	case errors.Is(err, context.Canceled):
+		return Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return DeadlineExceeded
+	}
+
+	switch kerr.CategoryOf(err) {
+	case kerr.NotFound:
+		return NotFound
+	case kerr.Invalid:
+		return InvalidArgument
+	case kerr.Conflict:
+		return FailedPrecondition
+	case kerr.Unauthenticated:
+		return Unauthenticated
+	case kerr.PermissionDenied:
+		return PermissionDenied
+	case kerr.RateLimited:
+		return ResourceExhausted
+	case kerr.Unavailable:
+		return Unavailable
+	default:
+		return Unknown
+	}
+}
+
+// splitMethod splits /package.Service/Method into its service and method
+func splitMethod(fullMethod string) (string, string) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if !ok {
+		return "", fullMethod
+	}
+
+	return service, method
+}
+
+// serverStream is the stream handlers are given, carrying the context of the
+// operation
+type serverStream struct {
+	ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// metadataCarrier reads the trace context from grpc metadata, whose keys are
+// lowercase
+type metadataCarrier map[string][]string
+
+func (c metadataCarrier) Get(key string) string {
+	values := c[strings.ToLower(key)]
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	c[strings.ToLower(key)] = []string{value}
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
@@ -0,0 +1,175 @@
+package kgrpc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kzs0/kokoro"
+	"github.com/kzs0/kokoro/health"
+	"github.com/kzs0/kokoro/internal/clock"
+)
+
+const (
+	defaultServerName = "grpc"
+	// healthInterval is how often the readiness of the service is reported to
+	// the health service of the server
+	healthInterval = 5 * time.Second
+)
+
+// Server is the part of *grpc.Server NewServer manages
+type Server interface {
+	GracefulStop()
+	Stop()
+}
+
+// Interceptors are the interceptors NewServer instruments the server with, to
+// be installed with grpc.UnaryInterceptor and grpc.StreamInterceptor
+type Interceptors struct {
+	Unary  UnaryInterceptor
+	Stream StreamInterceptor
+}
+
+type serverOpts struct {
+	name         string
+	interceptors []Option
+	health       func(serving bool)
+	reflection   func(Server)
+	shutdown     []kokoro.ShutdownOption
+}
+
+type ServerOption func(*serverOpts)
+
+// WithServerName names the server in the shutdown hook stopping it. Defaults
+// to grpc.
+func WithServerName(name string) ServerOption {
+	return func(opts *serverOpts) {
+		opts.name = name
+	}
+}
+
+// WithInterceptorOptions configures the interceptors of the server
+func WithInterceptorOptions(opts ...Option) ServerOption {
+	return func(o *serverOpts) {
+		o.interceptors = append(o.interceptors, opts...)
+	}
+}
+
+// WithHealth keeps the health service of the server current with the
+// readiness of the service, see health.Readiness, by calling set whenever it
+// changes, e.g. with SetServingStatus of the grpc health server. The server
+// reports it is not serving once it starts shutting down.
+func WithHealth(set func(serving bool)) ServerOption {
+	return func(opts *serverOpts) {
+		opts.health = set
+	}
+}
+
+// WithReflection registers the reflection service on the server once it is
+// built by calling register, e.g. with reflection.Register
+func WithReflection(register func(Server)) ServerOption {
+	return func(opts *serverOpts) {
+		opts.reflection = register
+	}
+}
+
+// WithShutdownOptions configures the shutdown hook stopping the server
+func WithShutdownOptions(opts ...kokoro.ShutdownOption) ServerOption {
+	return func(o *serverOpts) {
+		o.shutdown = append(o.shutdown, opts...)
+	}
+}
+
+// NewServer builds a server with build, which installs the interceptors it is
+// given, e.g. with grpc.NewServer:
+//
+//	srv := kgrpc.NewServer(func(i kgrpc.Interceptors) *grpc.Server {
+//		return grpc.NewServer(
+//			grpc.UnaryInterceptor(/* adapts i.Unary, see the package docs */),
+//			grpc.StreamInterceptor(/* adapts i.Stream */),
+//		)
+//	}, kgrpc.WithReflection(func(s kgrpc.Server) {
+//		reflection.Register(s.(*grpc.Server))
+//	}))
+//
+// The server is stopped gracefully by a shutdown hook, see kokoro.OnShutdown,
+// and stopped outright when the calls in flight outlast the hook.
+func NewServer[S Server](build func(Interceptors) S, opts ...ServerOption) S {
+	opt := serverOpts{name: defaultServerName}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	srv := build(Interceptors{
+		Unary:  UnaryServerInterceptor(opt.interceptors...),
+		Stream: StreamServerInterceptor(opt.interceptors...),
+	})
+
+	if opt.reflection != nil {
+		opt.reflection(srv)
+	}
+
+	stopHealth := func() {}
+	if opt.health != nil {
+		stopHealth = reportHealth(opt.health)
+	}
+
+	kokoro.OnShutdown(fmt.Sprintf("grpc server %s", opt.name), func(ctx context.Context) error {
+		stopHealth()
+
+		stopped := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+			return nil
+		case <-ctx.Done():
+			srv.Stop()
+			return fmt.Errorf("grpc server %s did not drain in time: %w", opt.name, ctx.Err())
+		}
+	}, opt.shutdown...)
+
+	return srv
+}
+
+// reportHealth calls set with the readiness of the service whenever it
+// changes, until the func it returns is called, which reports the server is
+// not serving
+func reportHealth(set func(serving bool)) func() {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	var serving bool
+
+	go func() {
+		defer close(stopped)
+
+		ticker := clock.NewTicker(healthInterval)
+		defer ticker.Stop()
+
+		serving = health.Readiness().Healthy
+		set(serving)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C():
+			}
+
+			if ready := health.Readiness().Healthy; ready != serving {
+				serving = ready
+				set(serving)
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-stopped
+		if serving {
+			set(false)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Package kecho instruments echo routers with the khttp middleware. It is a
+// module of its own so kokoro does not depend on echo.
+package kecho
+
+import (
+	"net/http"
+
+	"github.com/kzs0/kokoro/khttp"
+	"github.com/kzs0/kokoro/koko"
+	"github.com/labstack/echo/v4"
+)
+
+// Middleware runs every request as an operation labeled with the route echo
+// matched, see khttp.Middleware. WithRouteFunc is ignored. Errors returned by
+// handlers are passed to the error handler of echo so the status of the
+// response is known when the operation completes.
+//
+//	e := echo.New()
+//	e.Use(kecho.Middleware())
+func Middleware(opts ...khttp.Option) echo.MiddlewareFunc {
+	serve := khttp.ServeFunc(opts...)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			serve(c.Request(), func(r *http.Request) (string, int) {
+				c.SetRequest(r)
+
+				_, id := koko.RequestID(r.Context())
+				c.Response().Header().Set(khttp.RequestIDHeader, id)
+
+				if err := next(c); err != nil {
+					c.Error(err)
+				}
+
+				return c.Path(), c.Response().Status
+			})
+
+			return nil
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package kecho_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kzs0/kokoro/khttp"
+	"github.com/kzs0/kokoro/khttp/kecho"
+	"github.com/kzs0/kokoro/kokotest"
+	"github.com/labstack/echo/v4"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler echo.HandlerFunc
+		status  int
+		outcome kokotest.Outcome
+	}{
+		{
+			name:    "success",
+			handler: func(c echo.Context) error { return c.NoContent(http.StatusOK) },
+			status:  http.StatusOK,
+			outcome: kokotest.Success,
+		},
+		{
+			name:    "client error",
+			handler: func(echo.Context) error { return echo.ErrNotFound },
+			status:  http.StatusNotFound,
+			outcome: kokotest.Success,
+		},
+		{
+			name:    "server error",
+			handler: func(echo.Context) error { return echo.ErrInternalServerError },
+			status:  http.StatusInternalServerError,
+			outcome: kokotest.Failure,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tel := kokotest.Capture(t)
+
+			e := echo.New()
+			e.Use(kecho.Middleware())
+			e.GET("/users/:id", tt.handler)
+
+			w := httptest.NewRecorder()
+			e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/42", nil))
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if w.Header().Get(khttp.RequestIDHeader) == "" {
+				t.Errorf("%s header not set", khttp.RequestIDHeader)
+			}
+
+			tel.AssertOperation(t, "http_request", tt.outcome, kokotest.WithLabel("route", "/users/:id"))
+		})
+	}
+}
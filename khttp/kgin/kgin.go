@@ -0,0 +1,33 @@
+// Package kgin instruments gin routers with the khttp middleware. It is a
+// module of its own so kokoro does not depend on gin.
+package kgin
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kzs0/kokoro/khttp"
+	"github.com/kzs0/kokoro/koko"
+)
+
+// Middleware runs every request as an operation labeled with the route gin
+// matched, see khttp.Middleware. WithRouteFunc is ignored.
+//
+//	router := gin.New()
+//	router.Use(kgin.Middleware())
+func Middleware(opts ...khttp.Option) gin.HandlerFunc {
+	serve := khttp.ServeFunc(opts...)
+
+	return func(c *gin.Context) {
+		serve(c.Request, func(r *http.Request) (string, int) {
+			c.Request = r
+
+			_, id := koko.RequestID(r.Context())
+			c.Header(khttp.RequestIDHeader, id)
+
+			c.Next()
+
+			return c.FullPath(), c.Writer.Status()
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package kgin_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kzs0/kokoro/khttp"
+	"github.com/kzs0/kokoro/khttp/kgin"
+	"github.com/kzs0/kokoro/kokotest"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name    string
+		status  int
+		outcome kokotest.Outcome
+	}{
+		{"success", http.StatusOK, kokotest.Success},
+		{"server error", http.StatusInternalServerError, kokotest.Failure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tel := kokotest.Capture(t)
+
+			router := gin.New()
+			router.Use(kgin.Middleware())
+			router.GET("/users/:id", func(c *gin.Context) {
+				c.Status(tt.status)
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/42", nil))
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if w.Header().Get(khttp.RequestIDHeader) == "" {
+				t.Errorf("%s header not set", khttp.RequestIDHeader)
+			}
+
+			tel.AssertOperation(t, "http_request", tt.outcome, kokotest.WithLabel("route", "/users/:id"))
+		})
+	}
+}
@@ -0,0 +1,252 @@
+// Package khttp instruments HTTP servers with koko operations.
+package khttp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/kzs0/kokoro/diagnostics"
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const defaultOperation = "http_request"
+
+// RequestIDHeader carries the request ID of a request, which is reused when
+// the caller sends one and echoed on the response
+const RequestIDHeader = "X-Request-ID"
+
+type middlewareOpts struct {
+	operation string
+	route     func(*http.Request) string
+	opOpts    []koko.OperationOption
+}
+
+type Option func(*middlewareOpts)
+
+// WithOperationName sets the name of the operation started for each request.
+// Defaults to http_request.
+func WithOperationName(name string) Option {
+	return func(opts *middlewareOpts) {
+		opts.operation = name
+	}
+}
+
+// WithRouteFunc extracts the route a request matched, e.g. /users/{id}, which
+// is reported as the route label. Routes must be templated to keep the label
+// low cardinality, so the route is only reported when a func is provided. It
+// is called once the request has been served, when routers have matched it.
+func WithRouteFunc(route func(*http.Request) string) Option {
+	return func(opts *middlewareOpts) {
+		opts.route = route
+	}
+}
+
+// WithOperationOptions applies additional options to the operation started
+// for each request
+func WithOperationOptions(opts ...koko.OperationOption) Option {
+	return func(o *middlewareOpts) {
+		o.opOpts = append(o.opOpts, opts...)
+	}
+}
+
+// Middleware starts an operation for every request served by next. The trace
+// context is extracted from the request headers, the method, route, and status
+// code are registered as attributes, and responses with a 5xx status fail the
+// operation. Methods other than the standard ones are reported as _OTHER. A
+// panicking handler fails the operation with the panic, see koko.WithRepanic,
+// before the panic is left for net/http to handle. The number of requests being
+// served is reported by the <operation>_in_flight gauge. The request ID
+// received in the X-Request-ID header, or generated when absent, is set on the
+// operation and echoed on the response.
+func Middleware(next http.Handler, opts ...Option) http.Handler {
+	s := newServer(opts)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.serve(r, func(r *http.Request) (string, int) {
+			_, id := koko.RequestID(r.Context())
+			w.Header().Set(RequestIDHeader, id)
+
+			rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rw, r)
+
+			var route string
+			if s.route != nil {
+				route = s.route(r)
+			}
+
+			return route, rw.status
+		})
+	})
+}
+
+type server struct {
+	middlewareOpts
+	operationOpts []koko.OperationOption
+	inFlight      *inFlight
+}
+
+func newServer(opts []Option) *server {
+	opt := middlewareOpts{operation: defaultOperation}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	return &server{
+		middlewareOpts: opt,
+		operationOpts: append(append([]koko.OperationOption{
+			koko.WithSpanKind(koko.SpanKindServer),
+			koko.WithLabels("method", "route", "status"),
+		}, opt.opOpts...), koko.WithRepanic()),
+		inFlight: newInFlight(opt.operation),
+	}
+}
+
+// serve runs next within the operation for r. next serves the request it is
+// given and returns the route matched and the status code of the response.
+// The route is read once the request is served since routers only match it
+// then.
+func (s *server) serve(r *http.Request, next func(*http.Request) (string, int)) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	if id := r.Header.Get(RequestIDHeader); id != "" {
+		ctx = koko.WithRequestID(ctx, id)
+	}
+	ctx, _ = koko.RequestID(ctx)
+
+	s.inFlight.add(ctx, 1)
+	defer s.inFlight.add(ctx, -1)
+
+	var err error
+	ctx, done := koko.Operation(ctx, s.operation, s.operationOpts...)
+	defer done(&ctx, &err)
+
+	method := normalizeMethod(r.Method)
+	ctx = koko.Register(ctx,
+		koko.Str("method", method),
+		koko.Str("path", r.URL.Path, koko.LogOnly(), koko.TraceOnly()),
+	)
+	if method != r.Method {
+		ctx = koko.Register(ctx, koko.Str("method_original", r.Method, koko.LogOnly(), koko.TraceOnly()))
+	}
+
+	route, status := next(r.WithContext(ctx))
+
+	if route != "" {
+		ctx = koko.Register(ctx, koko.Str("route", route))
+	}
+	ctx = koko.Register(ctx, koko.Str("status", strconv.Itoa(status)))
+	if status >= http.StatusInternalServerError {
+		err = fmt.Errorf("responded %d %s", status, http.StatusText(status))
+	}
+}
+
+// otherMethod is reported in place of methods that aren't standard, which
+// clients can make up to grow the number of series without bounds
+const otherMethod = "_OTHER"
+
+// normalizeMethod returns the method when it is a standard one, or _OTHER
+func normalizeMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return otherMethod
+	}
+}
+
+// InFlight returns the number of requests currently being served through
+// Middleware
+func InFlight() int64 {
+	return inFlightTotal.Load()
+}
+
+var inFlightTotal atomic.Int64
+
+type inFlight struct {
+	count      atomic.Int64
+	operation  string
+	name       string
+	labelNames []string
+	labels     []metrics.MeasurementOption
+}
+
+// inFlights holds the in flight count of each operation, shared by every
+// middleware starting it
+var inFlights sync.Map
+
+func newInFlight(operation string) *inFlight {
+	if f, ok := inFlights.Load(operation); ok {
+		return f.(*inFlight)
+	}
+
+	// named like the other metrics of the operation
+	name, naming := koko.OperationMetric(operation, "in_flight")
+	f := &inFlight{operation: operation, name: name}
+	for k, v := range naming {
+		f.labelNames = append(f.labelNames, k)
+		f.labels = append(f.labels, metrics.WithLabel(k, v))
+	}
+
+	actual, _ := inFlights.LoadOrStore(operation, f)
+	return actual.(*inFlight)
+}
+
+func (f *inFlight) add(ctx context.Context, delta int64) {
+	inFlightTotal.Add(delta)
+	f.count.Add(delta)
+
+	// the gauge reads the count when metrics are collected, so concurrent
+	// requests can't leave a stale value behind. It is looked up on every
+	// call since the default factory may be replaced.
+	_, err := koko.ObservableGaugeSeries(f.name, f.operation, f.observe,
+		metrics.WithDescription("number of requests being served"),
+		metrics.WithLabelNames(f.labelNames))
+	if err != nil {
+		diagnostics.Report(ctx, "khttp", "failed to create in flight gauge", err, slog.String("operation", f.operation))
+	}
+}
+
+func (f *inFlight) observe(context.Context) (float64, []metrics.MeasurementOption) {
+	return float64(f.count.Load()), f.labels
+}
+
+// responseWriter records the status code written by a handler
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status = status
+		rw.wroteHeader = true
+	}
+
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+
+	return rw.ResponseWriter.Write(b)
+}
+
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
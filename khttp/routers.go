@@ -0,0 +1,65 @@
+package khttp
+
+import (
+	"net/http"
+)
+
+// Handler returns Middleware in the func(http.Handler) http.Handler signature
+// used by net/http compatible routers such as chi. With chi the route pattern
+// is only complete once the request is routed, which is when the route func is
+// called:
+//
+//	r := chi.NewRouter()
+//	r.Use(khttp.Handler(khttp.WithRouteFunc(func(r *http.Request) string {
+//		return chi.RouteContext(r.Context()).RoutePattern()
+//	})))
+func Handler(opts ...Option) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return Middleware(next, opts...)
+	}
+}
+
+// ServeFunc returns Serve with the middleware built once, for use in the
+// middleware of routers with their own handler signature. Adapters for gin and
+// echo are provided by the kgin and kecho modules, this is what they are built
+// on. next continues the chain with the request provided, which carries the
+// operation, and returns the templated route matched and the status code of
+// the response. WithRouteFunc is ignored. The request ID is not echoed, next
+// can set the X-Request-ID header from koko.RequestID(r.Context()) to do so.
+//
+// With gin:
+//
+//	serve := khttp.ServeFunc()
+//	router.Use(func(c *gin.Context) {
+//		serve(c.Request, func(r *http.Request) (string, int) {
+//			c.Request = r
+//			c.Next()
+//			return c.FullPath(), c.Writer.Status()
+//		})
+//	})
+//
+// With echo, errors are handled before returning so the status is known:
+//
+//	serve := khttp.ServeFunc()
+//	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+//		return func(c echo.Context) error {
+//			serve(c.Request(), func(r *http.Request) (string, int) {
+//				c.SetRequest(r)
+//				if err := next(c); err != nil {
+//					c.Error(err)
+//				}
+//				return c.Path(), c.Response().Status
+//			})
+//			return nil
+//		}
+//	})
+func ServeFunc(opts ...Option) func(r *http.Request, next func(*http.Request) (route string, status int)) {
+	return newServer(opts).serve
+}
+
+// Serve runs a single request through the middleware, see ServeFunc. The
+// middleware is built on every call, so router middleware should create it
+// once with ServeFunc instead.
+func Serve(r *http.Request, next func(*http.Request) (route string, status int), opts ...Option) {
+	ServeFunc(opts...)(r, next)
+}
@@ -0,0 +1,267 @@
+// Package kkafka instruments Kafka producers and consumers with koko
+// operations without depending on a particular client.
+//
+// Records are described by Record, whose Header has the same layout as the
+// header types of the popular clients, so they convert element by element,
+// e.g. kkafka.Header(h) for a segmentio/kafka-go kafka.Header or a franz-go
+// kgo.RecordHeader.
+package kkafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/kzs0/kokoro/internal/clock"
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	defaultProduceOperation = "kafka_produce"
+	defaultConsumeOperation = "kafka_consume"
+)
+
+// Header is a record header
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// Record is a Kafka record as seen by the instrumentation
+type Record struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   []Header
+	// Time is when the record was produced, used to report its age when
+	// consumed
+	Time time.Time
+}
+
+// Carrier exposes the record headers for reading and writing trace context
+func (r *Record) Carrier() propagation.TextMapCarrier {
+	return (*headerCarrier)(&r.Headers)
+}
+
+type headerCarrier []Header
+
+func (c *headerCarrier) Get(key string) string {
+	for _, h := range *c {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+
+	return ""
+}
+
+func (c *headerCarrier) Set(key, value string) {
+	for i, h := range *c {
+		if h.Key == key {
+			(*c)[i].Value = []byte(value)
+			return
+		}
+	}
+
+	*c = append(*c, Header{Key: key, Value: []byte(value)})
+}
+
+func (c *headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c))
+	for _, h := range *c {
+		keys = append(keys, h.Key)
+	}
+
+	return keys
+}
+
+type kafkaOpts struct {
+	operation string
+	opOpts    []koko.OperationOption
+}
+
+type Option func(*kafkaOpts)
+
+// WithOperationName sets the name of the operation started for each record or
+// batch. Defaults to kafka_produce or kafka_consume.
+func WithOperationName(name string) Option {
+	return func(opts *kafkaOpts) {
+		opts.operation = name
+	}
+}
+
+// WithOperationOptions applies additional options to the operations started
+func WithOperationOptions(opts ...koko.OperationOption) Option {
+	return func(o *kafkaOpts) {
+		o.opOpts = append(o.opOpts, opts...)
+	}
+}
+
+func options(operation string, opts []Option) kafkaOpts {
+	opt := kafkaOpts{operation: operation}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	return opt
+}
+
+// Produce sends the records with send within a producer operation. The trace
+// context is written to the headers of every record before sending, and the
+// time send takes is recorded by the kafka_delivery_millis histogram.
+func Produce(ctx context.Context, records []*Record, send func(context.Context, []*Record) error, opts ...Option) (err error) {
+	opt := options(defaultProduceOperation, opts)
+
+	opOpts := append([]koko.OperationOption{
+		koko.WithSpanKind(koko.SpanKindProducer),
+		koko.WithLabels("topic"),
+	}, opt.opOpts...)
+
+	ctx, done := koko.Operation(ctx, opt.operation, opOpts...)
+	defer done(&ctx, &err)
+
+	ctx = koko.Register(ctx,
+		koko.Str("messaging.system", "kafka", koko.TraceOnly()),
+		koko.Int64("batch_size", int64(len(records)), koko.LogOnly(), koko.TraceOnly()),
+	)
+	if topic := commonTopic(records); topic != "" {
+		ctx = koko.Register(ctx, koko.Str("topic", topic))
+	}
+
+	for _, r := range records {
+		otel.GetTextMapPropagator().Inject(ctx, r.Carrier())
+	}
+
+	start := clock.Now()
+	err = send(ctx, records)
+
+	recordBatchSize(ctx, "kafka_produce_batch_size", records)
+	for _, topic := range topics(records) {
+		observe(ctx, "kafka_delivery_millis", "time taken to deliver records to the broker",
+			float64(clock.Since(start).Milliseconds()), topic)
+	}
+
+	return err
+}
+
+// Consume processes a record within a consumer operation linked to the trace
+// of its producer. The age of the record, from Time to the start of
+// processing, is recorded by the kafka_record_age_millis histogram.
+func Consume(ctx context.Context, record *Record, fn func(context.Context, *Record) error, opts ...Option) (err error) {
+	opt := options(defaultConsumeOperation, opts)
+
+	ctx = otel.GetTextMapPropagator().Extract(ctx, record.Carrier())
+
+	opOpts := append([]koko.OperationOption{
+		koko.WithSpanKind(koko.SpanKindConsumer),
+		koko.WithLabels("topic"),
+	}, opt.opOpts...)
+
+	ctx, done := koko.Operation(ctx, opt.operation, opOpts...)
+	defer done(&ctx, &err)
+
+	ctx = koko.Register(ctx,
+		koko.Str("messaging.system", "kafka", koko.TraceOnly()),
+		koko.Str("topic", record.Topic),
+		koko.Str("partition", strconv.Itoa(int(record.Partition)), koko.LogOnly(), koko.TraceOnly()),
+		koko.Int64("offset", record.Offset, koko.LogOnly(), koko.TraceOnly()),
+	)
+
+	if !record.Time.IsZero() {
+		observe(ctx, "kafka_record_age_millis", "time between a record being produced and consumed",
+			float64(clock.Since(record.Time).Milliseconds()), record.Topic)
+	}
+
+	return fn(ctx, record)
+}
+
+// ConsumeBatch processes every record of a polled batch within a single
+// operation, see koko.Batch. The size of the batch is recorded by the
+// kafka_consume_batch_size histogram, and each record is processed with
+// Consume so it remains linked to its producer.
+func ConsumeBatch(ctx context.Context, records []*Record, fn func(context.Context, *Record) error, opts ...Option) error {
+	opt := options(defaultConsumeOperation, opts)
+
+	recordBatchSize(ctx, "kafka_consume_batch_size", records)
+
+	return koko.Batch(ctx, opt.operation+"_batch", records, func(ctx context.Context, r *Record) error {
+		return Consume(ctx, r, fn, opts...)
+	}, koko.WithBatchOperationOptions(opt.opOpts...))
+}
+
+// RecordLag reports how far a consumer is behind the end of a partition as
+// the kafka_consumer_lag gauge, given the partition's high watermark and the
+// offset of the next record the consumer will read
+func RecordLag(ctx context.Context, group, topic string, partition int32, highWatermark, offset int64) {
+	gauge, err := koko.Gauge("kafka_consumer_lag",
+		metrics.WithDescription("records between the consumer offset and the end of the partition"),
+		metrics.WithLabelNames([]string{"group", "topic", "partition"}),
+	)
+	if err != nil {
+		return
+	}
+
+	lag := highWatermark - offset
+	if lag < 0 {
+		lag = 0
+	}
+
+	_ = gauge.Measure(ctx, float64(lag),
+		metrics.WithLabel("group", group),
+		metrics.WithLabel("topic", topic),
+		metrics.WithLabel("partition", fmt.Sprint(partition)),
+	)
+}
+
+func recordBatchSize(ctx context.Context, name string, records []*Record) {
+	hist, err := koko.Histogram(name,
+		metrics.WithDescription("records per batch"),
+	)
+	if err != nil {
+		return
+	}
+
+	_ = hist.Record(ctx, float64(len(records)))
+}
+
+func observe(ctx context.Context, name, desc string, v float64, topic string) {
+	hist, err := koko.Histogram(name,
+		metrics.WithDescription(desc),
+		metrics.WithLabelNames([]string{"topic"}),
+	)
+	if err != nil {
+		return
+	}
+
+	_ = hist.Record(ctx, v, metrics.WithLabel("topic", topic))
+}
+
+// commonTopic returns the topic shared by every record, or empty when they
+// differ
+func commonTopic(records []*Record) string {
+	ts := topics(records)
+	if len(ts) != 1 {
+		return ""
+	}
+
+	return ts[0]
+}
+
+func topics(records []*Record) []string {
+	seen := make(map[string]bool)
+	ts := make([]string, 0, 1)
+	for _, r := range records {
+		if !seen[r.Topic] {
+			seen[r.Topic] = true
+			ts = append(ts, r.Topic)
+		}
+	}
+
+	return ts
+}
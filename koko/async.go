@@ -0,0 +1,94 @@
+package koko
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/kzs0/kokoro/diagnostics"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+// asyncQueueSize is the number of operations waiting to be completed by the
+// worker past which the policy of the operation applies
+const asyncQueueSize = 4096
+
+// AsyncPolicy determines what an operation completed asynchronously does when
+// the queue of the worker is full
+type AsyncPolicy int
+
+const (
+	// DropWhenFull drops the log and metrics of the operation, counting them
+	// as dropped, so done never waits
+	DropWhenFull AsyncPolicy = iota
+	// CompleteWhenFull logs and records the metrics of the operation in done,
+	// as if it were not asynchronous
+	CompleteWhenFull
+)
+
+// WithAsyncCompletion makes done only end the span of the operation, leaving
+// its log and metrics to a background worker, so latency critical paths only
+// pay for ending the span and queueing the rest. The policy determines what
+// happens when the queue is full. Operations still queued are completed by
+// FlushAsync, which kokoro.Done calls before flushing metrics.
+func WithAsyncCompletion(policy AsyncPolicy) OperationOption {
+	return func(opts *operationOpts) {
+		opts.async = true
+		opts.asyncPolicy = policy
+	}
+}
+
+var async struct {
+	once  sync.Once
+	queue chan func()
+}
+
+func asyncQueue() chan func() {
+	async.once.Do(func() {
+		async.queue = make(chan func(), asyncQueueSize)
+		go func() {
+			for complete := range async.queue {
+				complete()
+			}
+		}()
+	})
+
+	return async.queue
+}
+
+// completeAsync queues complete to be run by the worker, applying the policy
+// when the queue is full
+func completeAsync(ctx context.Context, policy AsyncPolicy, complete func()) {
+	select {
+	case asyncQueue() <- complete:
+		return
+	default:
+	}
+
+	if policy == CompleteWhenFull {
+		complete()
+		return
+	}
+
+	diagnostics.Dropped(ctx, metrics.SignalLogs, "async_queue_full", 1)
+	diagnostics.Dropped(ctx, metrics.SignalMetrics, "async_queue_full", 1)
+}
+
+// FlushAsync waits for the operations queued by WithAsyncCompletion before it
+// was called to be completed, giving up once ctx is done
+func FlushAsync(ctx context.Context) error {
+	flushed := make(chan struct{})
+
+	select {
+	case asyncQueue() <- func() { close(flushed) }:
+	case <-ctx.Done():
+		return fmt.Errorf("failed to flush operations completed asynchronously: %w", ctx.Err())
+	}
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to flush operations completed asynchronously: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,42 @@
+package koko
+
+import (
+	"context"
+	"sync"
+)
+
+var root struct {
+	mu  sync.RWMutex
+	ctx context.Context
+}
+
+// SetRoot sets the context Background derives operations from, which
+// kokoro.Init sets to the context it returns. Setting nil reverts to
+// context.Background.
+func SetRoot(ctx context.Context) {
+	root.mu.Lock()
+	defer root.mu.Unlock()
+
+	root.ctx = ctx
+}
+
+// Background starts an operation for code without an incoming context, such
+// as legacy code paths and work done during initialization. The operation is
+// derived from the root context, see SetRoot, so it is canceled on shutdown
+// and reports to the same telemetry as the rest of the service.
+//
+//	ctx, done := koko.Background("warm_cache")
+//	defer done(&ctx, &err)
+func Background(operation string, opts ...OperationOption) (context.Context, Done) {
+	root.mu.RLock()
+	ctx := root.ctx
+	root.mu.RUnlock()
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	opts = append(opts, WithCallerSkip(1))
+
+	return Operation(ctx, operation, opts...)
+}
@@ -0,0 +1,34 @@
+package koko
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/baggage"
+)
+
+// WithBaggage copies the allowlisted OTel baggage members into attributes of
+// the operation, so identifiers set at the edge such as a tenant or experiment
+// are consistently present on inner operations.
+func WithBaggage(keys ...string) OperationOption {
+	return func(opts *operationOpts) {
+		opts.baggage = append(opts.baggage, keys...)
+	}
+}
+
+func registerBaggage(ctx context.Context, keys []string) context.Context {
+	if len(keys) == 0 {
+		return ctx
+	}
+
+	bag := baggage.FromContext(ctx)
+	for _, k := range keys {
+		m := bag.Member(k)
+		if m.Key() == "" {
+			continue
+		}
+
+		ctx = Register(ctx, Str(k, m.Value()))
+	}
+
+	return ctx
+}
@@ -0,0 +1,136 @@
+package koko
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/kzs0/kokoro/diagnostics"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+type batchOpts struct {
+	parallelism int
+	opOpts      []OperationOption
+}
+
+type BatchOption func(*batchOpts)
+
+// WithParallelism processes up to n items of the batch concurrently. Items are
+// processed sequentially by default.
+func WithParallelism(n int) BatchOption {
+	return func(opts *batchOpts) {
+		opts.parallelism = n
+	}
+}
+
+// WithBatchOperationOptions applies options to the operation wrapping the
+// batch
+func WithBatchOperationOptions(opts ...OperationOption) BatchOption {
+	return func(b *batchOpts) {
+		b.opOpts = append(b.opOpts, opts...)
+	}
+}
+
+// Batch will process every item within a single operation.
+//
+// The batch size and number of failed items are registered on the operation,
+// and per item outcomes are counted in the <name>_items_success and
+// <name>_items_failures counters, named like the other metrics of the
+// operation, see OperationMetric. When only some items fail the operation is
+// marked as a partial failure. The errors of every failed item are joined and
+// returned.
+//
+// Each item is processed with its own copy of the attributes of the
+// operation, so attributes fn registers stay with the item and items
+// processed concurrently do not race. A panic of fn becomes the error of the
+// item.
+func Batch[T any](ctx context.Context, name string, items []T, fn func(context.Context, T) error, opts ...BatchOption) (err error) {
+	opt := batchOpts{parallelism: 1}
+	for _, o := range opts {
+		o(&opt)
+	}
+	if opt.parallelism < 1 {
+		opt.parallelism = 1
+	}
+
+	ctx, done := Operation(ctx, name, opt.opOpts...)
+	defer done(&ctx, &err)
+
+	ctx = Register(ctx, Int64("batch_size", int64(len(items)), LogOnly(), TraceOnly()))
+
+	tel := telemetryFrom(ctx)
+	successName, labelNames, labels := operationMetric(name, "items_success")
+	failuresName, _, _ := operationMetric(name, "items_failures")
+	successes, serr := tel.counter(successName, metrics.WithLabelNames(labelNames))
+	failures, ferr := tel.counter(failuresName, metrics.WithLabelNames(labelNames))
+	if cerr := errors.Join(serr, ferr); cerr != nil {
+		diagnostics.Report(ctx, "koko", "failed to create batch item metrics", cerr, slog.String("operation", name))
+	}
+
+	var (
+		mu   sync.Mutex
+		errs = make([]error, 0)
+		wg   sync.WaitGroup
+		sem  = make(chan struct{}, opt.parallelism)
+	)
+
+	for _, item := range items {
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(item T) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			ierr := processItem(ctx, item, fn)
+			recordItem(ctx, successes, failures, ierr, labels)
+
+			if ierr != nil {
+				mu.Lock()
+				errs = append(errs, ierr)
+				mu.Unlock()
+			}
+		}(item)
+	}
+	wg.Wait()
+
+	ctx = Register(ctx, Int64("batch_failed", int64(len(errs)), LogOnly(), TraceOnly()))
+	if len(errs) > 0 && len(errs) < len(items) {
+		ctx = Register(ctx, Bool("partial_failure", true))
+	}
+
+	return errors.Join(errs...)
+}
+
+// processItem calls fn with item on a copy of the stack of the batch,
+// returning a panic of fn as its error
+func processItem[T any](ctx context.Context, item T, fn func(context.Context, T) error) (err error) {
+	if st, ok := getStack(ctx); ok {
+		ctx = saveStack(ctx, st.clone())
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = DescribePanic(r).Err()
+		}
+	}()
+
+	return fn(ctx, item)
+}
+
+func recordItem(ctx context.Context, successes, failures metrics.Counter, err error, labels []metrics.MeasurementOption) {
+	counter := successes
+	if err != nil {
+		counter = failures
+	}
+	if counter == nil {
+		return
+	}
+
+	rerr := counter.Incr(ctx, labels...)
+	if rerr != nil {
+		diagnostics.Report(ctx, "koko", "failed to record batch item", rerr)
+	}
+}
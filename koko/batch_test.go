@@ -0,0 +1,116 @@
+package koko_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/kokoro/kokotest"
+)
+
+func TestBatch(t *testing.T) {
+	errOdd := errors.New("odd")
+
+	tests := []struct {
+		name         string
+		items        []int
+		fn           func(context.Context, int) error
+		wantErr      string
+		wantFailed   int64
+		wantPartial  bool
+		wantOutcome  kokotest.Outcome
+		wantSuccess  float64
+		wantFailures float64
+	}{
+		{
+			name:        "success",
+			items:       []int{2, 4, 6, 8},
+			fn:          func(context.Context, int) error { return nil },
+			wantOutcome: kokotest.Success,
+			wantSuccess: 4,
+		},
+		{
+			name:  "partial failure",
+			items: []int{1, 2, 3, 4},
+			fn: func(_ context.Context, i int) error {
+				if i%2 == 1 {
+					return errOdd
+				}
+				return nil
+			},
+			wantErr:      "odd",
+			wantFailed:   2,
+			wantPartial:  true,
+			wantOutcome:  kokotest.Failure,
+			wantSuccess:  2,
+			wantFailures: 2,
+		},
+		{
+			name:  "panic",
+			items: []int{1, 2, 3, 4},
+			fn: func(_ context.Context, i int) error {
+				if i == 3 {
+					panic("item 3")
+				}
+				return nil
+			},
+			wantErr:      "panic: item 3",
+			wantFailed:   1,
+			wantPartial:  true,
+			wantOutcome:  kokotest.Failure,
+			wantSuccess:  3,
+			wantFailures: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, tel := kokotest.Init(t)
+
+			err := koko.Batch(ctx, "import", tt.items, func(ctx context.Context, i int) error {
+				// items registering attributes concurrently must not race
+				ctx = koko.Register(ctx, koko.Int64("item", int64(i), koko.LogOnly()))
+				return tt.fn(ctx, i)
+			}, koko.WithParallelism(4))
+
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Batch() error = %v, want %q", err, tt.wantErr)
+			}
+
+			tel.AssertOperation(t, "import", tt.wantOutcome)
+			if got := tel.Sum(t, "import_items_success", nil); got != tt.wantSuccess {
+				t.Errorf("import_items_success = %v, want %v", got, tt.wantSuccess)
+			}
+			if got := tel.Sum(t, "import_items_failures", nil); got != tt.wantFailures {
+				t.Errorf("import_items_failures = %v, want %v", got, tt.wantFailures)
+			}
+
+			span := tel.Spans()[len(tel.Spans())-1]
+			var failed int64 = -1
+			partial := false
+			for _, attr := range span.Attributes {
+				switch attr.Key {
+				case "batch_failed":
+					failed = attr.Value.AsInt64()
+				case "partial_failure":
+					partial = attr.Value.AsBool()
+				}
+			}
+			for _, r := range tel.Logs() {
+				r.Attrs(func(a slog.Attr) bool {
+					if r.Message == "import" && a.Key == "item" {
+						t.Errorf("attribute registered by an item reached the batch")
+					}
+					return true
+				})
+			}
+
+			if failed != tt.wantFailed || partial != tt.wantPartial {
+				t.Errorf("batch_failed = %d, partial_failure = %v, want %d, %v", failed, partial, tt.wantFailed, tt.wantPartial)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package koko
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/kzs0/kokoro/diagnostics"
+	"github.com/kzs0/kokoro/internal/clock"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+type cacheOpts struct {
+	maxEntries int
+	opOpts     []OperationOption
+}
+
+type CacheOption func(*cacheOpts)
+
+// WithMaxEntries bounds the number of entries of the cache, evicting the
+// oldest entry when a new one would exceed it. Caches are unbounded by
+// default.
+func WithMaxEntries(n int) CacheOption {
+	return func(opts *cacheOpts) {
+		opts.maxEntries = n
+	}
+}
+
+// WithCacheOperationOptions applies options to the operations wrapping cache
+// misses
+func WithCacheOperationOptions(opts ...OperationOption) CacheOption {
+	return func(c *cacheOpts) {
+		c.opOpts = append(c.opOpts, opts...)
+	}
+}
+
+type cacheEntry[T any] struct {
+	key     string
+	value   T
+	expires time.Time
+}
+
+// cacheCall is a miss being loaded, which concurrent misses of the same key
+// wait on rather than loading the key again
+type cacheCall[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// Cache memoizes the results of a func by key for a fixed time, see Cached
+type Cache[T any] struct {
+	name string
+	ttl  time.Duration
+	fn   func(context.Context, string) (T, error)
+	opt  cacheOpts
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	order    *list.List
+	inflight map[string]*cacheCall[T]
+
+	hits      metrics.Counter
+	misses    metrics.Counter
+	evictions metrics.Counter
+	size      metrics.ObservableGauge
+}
+
+// Cached creates a Cache of the results of fn, keyed by the key provided to
+// Get, which are kept for ttl. Errors are not cached.
+//
+// Misses call fn within an operation of the name provided, and concurrent
+// misses of the same key share a single call. Hits and misses are counted in
+// <name>_cache_hits and <name>_cache_misses, entries evicted because they
+// expired or exceeded WithMaxEntries in <name>_cache_evictions labeled with
+// the reason, and the number of entries is observed in the
+// <name>_cache_entries gauge until the cache is closed.
+func Cached[T any](name string, ttl time.Duration, fn func(context.Context, string) (T, error), opts ...CacheOption) (*Cache[T], error) {
+	opt := cacheOpts{}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	if ttl <= 0 {
+		return nil, fmt.Errorf("ttl must be positive, got %v", ttl)
+	}
+
+	c := &Cache[T]{
+		name:     name,
+		ttl:      ttl,
+		fn:       fn,
+		opt:      opt,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		inflight: make(map[string]*cacheCall[T]),
+	}
+
+	var err error
+	c.hits, err = Counter(fmt.Sprintf("%s_cache_hits", name),
+		metrics.WithDescription("lookups answered by the cache"))
+	if err != nil {
+		return nil, err
+	}
+
+	c.misses, err = Counter(fmt.Sprintf("%s_cache_misses", name),
+		metrics.WithDescription("lookups loaded because they were missing from the cache"))
+	if err != nil {
+		return nil, err
+	}
+
+	c.evictions, err = Counter(fmt.Sprintf("%s_cache_evictions", name),
+		metrics.WithDescription("entries evicted from the cache"),
+		metrics.WithLabelNames([]string{"reason"}))
+	if err != nil {
+		return nil, err
+	}
+
+	c.size, err = ObservableGauge(fmt.Sprintf("%s_cache_entries", name), func(context.Context) (float64, []metrics.MeasurementOption) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		return float64(c.order.Len()), nil
+	}, metrics.WithDescription("number of entries in the cache"))
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Get returns the value cached for key, calling the func of the cache to load
+// it when it is missing or expired
+func (c *Cache[T]) Get(ctx context.Context, key string) (T, error) {
+	c.mu.Lock()
+	expired := c.evictExpired()
+
+	if e, ok := c.entries[key]; ok {
+		value := e.Value.(*cacheEntry[T]).value
+		c.mu.Unlock()
+
+		c.recordEvictions(ctx, "expired", expired)
+		c.record(ctx, c.hits)
+		return value, nil
+	}
+
+	call, loading := c.inflight[key]
+	if !loading {
+		call = &cacheCall[T]{done: make(chan struct{})}
+		c.inflight[key] = call
+	}
+	c.mu.Unlock()
+
+	c.recordEvictions(ctx, "expired", expired)
+	c.record(ctx, c.misses)
+
+	if loading {
+		select {
+		case <-call.done:
+			return call.value, call.err
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+	}
+
+	evicted := c.resolve(ctx, key, call)
+	c.recordEvictions(ctx, "capacity", evicted)
+
+	return call.value, call.err
+}
+
+// resolve loads key for the call and caches the value, returning the number
+// of entries evicted to make room for it. Waiters are released even if the
+// func of the cache panics.
+func (c *Cache[T]) resolve(ctx context.Context, key string, call *cacheCall[T]) (evicted int) {
+	loaded := false
+	defer func() {
+		c.mu.Lock()
+		delete(c.inflight, key)
+		if loaded && call.err == nil {
+			evicted = c.store(key, call.value)
+		}
+		c.mu.Unlock()
+
+		if !loaded {
+			call.err = fmt.Errorf("failed to load %q into cache %s", key, c.name)
+		}
+		close(call.done)
+	}()
+
+	call.value, call.err = c.load(ctx, key)
+	loaded = true
+
+	return 0
+}
+
+// Invalidate removes the entry of key from the cache
+func (c *Cache[T]) Invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		c.order.Remove(e)
+		delete(c.entries, key)
+	}
+}
+
+// Len returns the number of entries in the cache, including expired entries
+// which have not been evicted yet
+func (c *Cache[T]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// Close stops observing the <name>_cache_entries gauge. The cache can still be
+// used.
+func (c *Cache[T]) Close() error {
+	return c.size.Unregister()
+}
+
+func (c *Cache[T]) load(ctx context.Context, key string) (value T, err error) {
+	ctx, done := Operation(ctx, c.name, c.opt.opOpts...)
+	defer done(&ctx, &err)
+
+	return c.fn(ctx, key)
+}
+
+// store caches value for key, returning the number of entries evicted to stay
+// within the maximum number of entries. It must be called with the lock held.
+func (c *Cache[T]) store(key string, value T) int {
+	entry := &cacheEntry[T]{key: key, value: value, expires: clock.Now().Add(c.ttl)}
+
+	if e, ok := c.entries[key]; ok {
+		c.order.Remove(e)
+	}
+	c.entries[key] = c.order.PushBack(entry)
+
+	evicted := 0
+	for c.opt.maxEntries > 0 && c.order.Len() > c.opt.maxEntries {
+		c.remove(c.order.Front())
+		evicted++
+	}
+
+	return evicted
+}
+
+// evictExpired removes the entries which expired, returning how many it
+// removed. Every entry lives for the same ttl, so entries are ordered by
+// expiry. It must be called with the lock held.
+func (c *Cache[T]) evictExpired() int {
+	now := clock.Now()
+
+	evicted := 0
+	for e := c.order.Front(); e != nil && !now.Before(e.Value.(*cacheEntry[T]).expires); e = c.order.Front() {
+		c.remove(e)
+		evicted++
+	}
+
+	return evicted
+}
+
+func (c *Cache[T]) remove(e *list.Element) {
+	c.order.Remove(e)
+	delete(c.entries, e.Value.(*cacheEntry[T]).key)
+}
+
+func (c *Cache[T]) recordEvictions(ctx context.Context, reason string, n int) {
+	if n == 0 {
+		return
+	}
+
+	err := c.evictions.Add(ctx, float64(n), metrics.WithLabel("reason", reason))
+	if err != nil {
+		diagnostics.Report(ctx, "koko", "failed to record cache evictions", err, slog.String("cache", c.name))
+	}
+}
+
+func (c *Cache[T]) record(ctx context.Context, counter metrics.Counter) {
+	err := counter.Incr(ctx)
+	if err != nil {
+		diagnostics.Report(ctx, "koko", "failed to record cache lookup", err, slog.String("cache", c.name))
+	}
+}
@@ -0,0 +1,102 @@
+package koko
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/kzs0/kokoro/diagnostics"
+	"github.com/kzs0/kokoro/internal/clock"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type checkpoints struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+// lap returns the time elapsed since the previous checkpoint, or the start of
+// the operation, and resets the lap to now
+func (c *checkpoints) lap() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := clock.Now()
+	elapsed := now.Sub(c.last)
+	c.last = now
+
+	return elapsed
+}
+
+type checkpointOpts struct {
+	histogram bool
+}
+
+type CheckpointOption func(*checkpointOpts)
+
+// WithCheckpointHistogram will additionally observe the time elapsed since the
+// previous checkpoint in a histogram named after the operation, checkpoint,
+// and duration unit like the duration histogram of the operation, e.g.
+// checkout_charged_millis, see OperationMetric and SetDurationUnit
+func WithCheckpointHistogram() CheckpointOption {
+	return func(opts *checkpointOpts) {
+		opts.histogram = true
+	}
+}
+
+// Checkpoint will record a span event on the current operation along with the
+// time elapsed since the previous checkpoint, or since the operation started
+// if this is the first checkpoint.
+//
+// Checkpoints make it easy to see which segment of a long operation regressed.
+func Checkpoint(ctx context.Context, name string, opts ...CheckpointOption) {
+	opt := checkpointOpts{}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	st, ok := getStack(ctx)
+	if !ok {
+		return
+	}
+
+	elapsed := st.Checkpoints.lap()
+
+	span := trace.SpanFromContext(ctx)
+	span.AddEvent(name, trace.WithAttributes(
+		attribute.String("checkpoint", name),
+		attribute.Float64("checkpoint.elapsed_ms", float64(elapsed.Microseconds())/1000),
+	))
+
+	if !opt.histogram {
+		return
+	}
+
+	unit := currentDurationUnit()
+	metricName, labelNames, labels := operationMetric(st.Operation, fmt.Sprintf("%s_%s", name, unit))
+
+	timerOpts := []metrics.MetricOption{
+		metrics.WithDescription(fmt.Sprintf("time elapsed before the checkpoint in %s", unit.long())),
+		metrics.WithLabelNames(labelNames),
+	}
+	// named and bucketed like the duration histogram of the operation
+	timerOpts = append(timerOpts, unit.timerOptions()...)
+
+	tel := telemetryFrom(ctx)
+	timer, err := tel.histogram(metricName, timerOpts...)
+	if err != nil {
+		diagnostics.Report(ctx, "koko", "failed to create checkpoint histogram", err,
+			slog.String("operation", st.Operation), slog.String("checkpoint", name))
+		return
+	}
+
+	err = timer.Record(ctx, unit.measure(elapsed), labels...)
+	if err != nil {
+		diagnostics.Report(ctx, "koko", "failed to record checkpoint", err,
+			slog.String("operation", st.Operation), slog.String("checkpoint", name))
+	}
+}
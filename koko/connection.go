@@ -0,0 +1,239 @@
+package koko
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kzs0/kokoro/diagnostics"
+	"github.com/kzs0/kokoro/internal/clock"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultConnectionHeartbeat = 30 * time.Second
+
+const (
+	directionIn  = "in"
+	directionOut = "out"
+)
+
+type connectionOpts struct {
+	heartbeat time.Duration
+	spanOpts  []trace.SpanStartOption
+}
+
+type ConnectionOption func(*connectionOpts)
+
+// WithConnectionHeartbeat sets how often an open connection reports the
+// messages it exchanged since the last heartbeat. Defaults to 30 seconds,
+// which a non-positive interval keeps.
+func WithConnectionHeartbeat(interval time.Duration) ConnectionOption {
+	return func(opts *connectionOpts) {
+		if interval > 0 {
+			opts.heartbeat = interval
+		}
+	}
+}
+
+// WithConnectionSpanKind sets the kind of the connection span, defaults to
+// SpanKindServer
+func WithConnectionSpanKind(kind trace.SpanKind) ConnectionOption {
+	return func(opts *connectionOpts) {
+		opts.spanOpts = append(opts.spanOpts, trace.WithSpanKind(kind))
+	}
+}
+
+// openConnections counts the open connections of each name
+var openConnections sync.Map
+
+// Connection instruments a long-lived connection such as a WebSocket or a
+// stream. Unlike an operation it has no duration histogram, which would be
+// dominated by connections lasting hours. Instead every message is its own
+// operation, a child of the connection span, and the connection reports its
+// activity on every heartbeat.
+type Connection struct {
+	name   string
+	span   trace.Span
+	opened time.Time
+	open   *atomic.Int64
+	cancel context.CancelFunc
+	once   sync.Once
+
+	in, out atomic.Int64
+
+	mu              sync.Mutex
+	lastIn, lastOut int64
+
+	connections metrics.Gauge
+	messages    metrics.Counter
+	heartbeats  metrics.Histogram
+	closed      metrics.Counter
+}
+
+// Connect starts instrumenting a connection, returning a context carrying the
+// connection span. Close must be called once the connection is closed.
+//
+// The open connections are reported by the <name>_connections gauge, and
+// messages by the <name>_messages counter labeled with their direction. On
+// every heartbeat the messages exchanged in the interval are observed in the
+// <name>_messages_per_heartbeat histogram and added as an event on the span.
+// Closed connections are counted in <name>_connections_closed, labeled with
+// their outcome.
+func Connect(ctx context.Context, name string, opts ...ConnectionOption) (context.Context, *Connection, error) {
+	opt := connectionOpts{
+		heartbeat: defaultConnectionHeartbeat,
+		spanOpts:  []trace.SpanStartOption{trace.WithSpanKind(trace.SpanKindServer)},
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	tel := telemetryFrom(ctx)
+
+	connections, err := tel.gauge(fmt.Sprintf("%s_connections", name),
+		metrics.WithDescription("open connections"))
+	if err != nil {
+		return ctx, nil, err
+	}
+
+	messages, err := tel.counter(fmt.Sprintf("%s_messages", name),
+		metrics.WithDescription("messages exchanged over connections"),
+		metrics.WithLabelNames([]string{"direction"}))
+	if err != nil {
+		return ctx, nil, err
+	}
+
+	heartbeats, err := tel.histogram(fmt.Sprintf("%s_messages_per_heartbeat", name),
+		metrics.WithDescription("messages exchanged by a connection between heartbeats"),
+		metrics.WithLabelNames([]string{"direction"}))
+	if err != nil {
+		return ctx, nil, err
+	}
+
+	closed, err := tel.counter(fmt.Sprintf("%s_connections_closed", name),
+		metrics.WithDescription("closed connections"),
+		metrics.WithLabelNames([]string{"outcome"}))
+	if err != nil {
+		return ctx, nil, err
+	}
+
+	open, _ := openConnections.LoadOrStore(name, &atomic.Int64{})
+
+	ctx, span := tel.tracer().Start(ctx, name, opt.spanOpts...)
+	hbCtx, cancel := context.WithCancel(ctx)
+
+	c := &Connection{
+		name:        name,
+		span:        span,
+		opened:      clock.Now(),
+		open:        open.(*atomic.Int64),
+		cancel:      cancel,
+		connections: connections,
+		messages:    messages,
+		heartbeats:  heartbeats,
+		closed:      closed,
+	}
+
+	err = c.connections.Measure(ctx, float64(c.open.Add(1)))
+	c.report(ctx, "failed to record open connections", err)
+
+	go c.watch(hbCtx, opt.heartbeat)
+
+	return ctx, c, nil
+}
+
+// Received starts an operation processing a message received over the
+// connection, see Operation
+func (c *Connection) Received(ctx context.Context, operation string, opts ...OperationOption) (context.Context, Done) {
+	c.in.Add(1)
+	err := c.messages.Incr(ctx, metrics.WithLabel("direction", directionIn))
+	c.report(ctx, "failed to record connection message", err)
+
+	return Operation(ctx, operation, opts...)
+}
+
+// Sent starts an operation sending a message over the connection, see
+// Operation
+func (c *Connection) Sent(ctx context.Context, operation string, opts ...OperationOption) (context.Context, Done) {
+	c.out.Add(1)
+	err := c.messages.Incr(ctx, metrics.WithLabel("direction", directionOut))
+	c.report(ctx, "failed to record connection message", err)
+
+	return Operation(ctx, operation, opts...)
+}
+
+// Close ends the connection span, failing it when err is not nil, e.g. when
+// the connection was dropped rather than closed cleanly. Only the first call
+// has an effect.
+func (c *Connection) Close(ctx context.Context, err error) {
+	c.once.Do(func() {
+		c.cancel()
+		c.beat(ctx)
+
+		outcome := "success"
+		if err != nil {
+			outcome = "failure"
+			c.span.RecordError(err)
+			c.span.SetStatus(codes.Error, err.Error())
+			c.span.SetAttributes(attribute.String("error.type", ErrorType(err)))
+		}
+
+		c.span.SetAttributes(
+			attribute.Int64("messages_in", c.in.Load()),
+			attribute.Int64("messages_out", c.out.Load()),
+		)
+		c.span.End()
+
+		c.report(ctx, "failed to record open connections", c.connections.Measure(ctx, float64(c.open.Add(-1))))
+		c.report(ctx, "failed to record closed connection", c.closed.Incr(ctx, metrics.WithLabel("outcome", outcome)))
+	})
+}
+
+func (c *Connection) watch(ctx context.Context, interval time.Duration) {
+	ticker := clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			c.beat(ctx)
+		}
+	}
+}
+
+// beat reports the messages exchanged since the last heartbeat
+func (c *Connection) beat(ctx context.Context) {
+	c.mu.Lock()
+	in, out := c.in.Load(), c.out.Load()
+	dIn, dOut := in-c.lastIn, out-c.lastOut
+	c.lastIn, c.lastOut = in, out
+	c.mu.Unlock()
+
+	err := errors.Join(
+		c.heartbeats.Record(ctx, float64(dIn), metrics.WithLabel("direction", directionIn)),
+		c.heartbeats.Record(ctx, float64(dOut), metrics.WithLabel("direction", directionOut)),
+	)
+	c.report(ctx, "failed to record connection heartbeat", err)
+
+	c.span.AddEvent("heartbeat", trace.WithAttributes(
+		attribute.Int64("messages_in", dIn),
+		attribute.Int64("messages_out", dOut),
+		attribute.String("age", clock.Since(c.opened).Round(time.Second).String()),
+	))
+}
+
+// report records a failure to record the metrics of the connection
+func (c *Connection) report(ctx context.Context, msg string, err error) {
+	if err != nil {
+		diagnostics.Report(ctx, "koko", msg, err, slog.String("connection", c.name))
+	}
+}
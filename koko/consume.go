@@ -0,0 +1,44 @@
+package koko
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Message is implemented by messages that carry trace context in their
+// headers, such as Kafka records, NATS messages, or SQS messages
+type Message interface {
+	// Carrier exposes the message headers for reading and writing trace context
+	Carrier() propagation.TextMapCarrier
+}
+
+// Consume will process a message within an operation.
+//
+// The trace context is extracted from the message headers so the consumer span
+// is linked to the producer, and the processing latency and outcome are
+// recorded like any other operation.
+func Consume[M Message](ctx context.Context, name string, msg M, fn func(context.Context, M) error) (err error) {
+	if name == "" {
+		name = callerOperationName(2)
+	}
+
+	ctx = otel.GetTextMapPropagator().Extract(ctx, msg.Carrier())
+
+	ctx, done := Operation(ctx, name, withSpanOptions(
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(semconv.MessagingOperationTypeDeliver),
+	))
+	defer done(&ctx, &err)
+
+	return fn(ctx, msg)
+}
+
+// Inject will write the trace context of ctx into the message headers so a
+// downstream Consume can continue the trace
+func Inject(ctx context.Context, msg Message) {
+	otel.GetTextMapPropagator().Inject(ctx, msg.Carrier())
+}
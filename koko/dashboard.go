@@ -0,0 +1,243 @@
+package koko
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+type dashboardOpts struct {
+	title      string
+	datasource string
+}
+
+type DashboardOption func(*dashboardOpts)
+
+// WithDashboardTitle sets the title of the generated dashboard
+func WithDashboardTitle(title string) DashboardOption {
+	return func(opts *dashboardOpts) {
+		opts.title = title
+	}
+}
+
+// WithDashboardDatasource sets the uid of the prometheus datasource the
+// generated panels query
+func WithDashboardDatasource(uid string) DashboardOption {
+	return func(opts *dashboardOpts) {
+		opts.datasource = uid
+	}
+}
+
+type dashboard struct {
+	Title         string     `json:"title"`
+	Tags          []string   `json:"tags"`
+	Timezone      string     `json:"timezone"`
+	SchemaVersion int        `json:"schemaVersion"`
+	Time          timeRange  `json:"time"`
+	Refresh       string     `json:"refresh"`
+	Templating    templating `json:"templating"`
+	Panels        []panel    `json:"panels"`
+}
+
+type timeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type templating struct {
+	List []variable `json:"list"`
+}
+
+type variable struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Type  string `json:"type"`
+	Query string `json:"query"`
+}
+
+type datasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type gridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type target struct {
+	Expr         string     `json:"expr"`
+	LegendFormat string     `json:"legendFormat"`
+	RefID        string     `json:"refId"`
+	Datasource   datasource `json:"datasource"`
+}
+
+type fieldConfig struct {
+	Defaults fieldDefaults `json:"defaults"`
+}
+
+type fieldDefaults struct {
+	Unit string `json:"unit"`
+}
+
+type panel struct {
+	ID          int          `json:"id"`
+	Type        string       `json:"type"`
+	Title       string       `json:"title"`
+	GridPos     gridPos      `json:"gridPos"`
+	Datasource  *datasource  `json:"datasource,omitempty"`
+	Targets     []target     `json:"targets,omitempty"`
+	FieldConfig *fieldConfig `json:"fieldConfig,omitempty"`
+}
+
+// operationSeries returns the exported name of an operation metric and the
+// label selector identifying the operation, empty unless operations share
+// their metrics
+func operationSeries(operation, signal string) (string, string) {
+	name, labels := OperationMetric(operation, signal)
+	if len(labels) == 0 {
+		return metricName(name), ""
+	}
+
+	matchers := make([]string, 0, len(labels))
+	for k, v := range labels {
+		matchers = append(matchers, fmt.Sprintf("%s=%q", k, v))
+	}
+	sort.Strings(matchers)
+
+	return metricName(name), "{" + strings.Join(matchers, ",") + "}"
+}
+
+// metricName returns the name prometheus exports for a metric created by the
+// default factory
+func metricName(name string) string {
+	if n, ok := metrics.DefaultFactory.(metrics.Namer); ok {
+		return n.Name(name)
+	}
+
+	return name
+}
+
+// GenerateDashboard will write a Grafana dashboard to w with rate, error, and
+// duration panels for every registered operation.
+//
+// Only operations that have been started by the process are known to the
+// registry, so the dashboard is typically generated after startup or from a
+// test exercising the service's operations.
+func GenerateDashboard(w io.Writer, opts ...DashboardOption) error {
+	opt := dashboardOpts{
+		title:      "kokoro operations",
+		datasource: "${datasource}",
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	ds := datasource{Type: "prometheus", UID: opt.datasource}
+
+	d := dashboard{
+		Title:         opt.title,
+		Tags:          []string{"kokoro"},
+		Timezone:      "browser",
+		SchemaVersion: 39,
+		Time:          timeRange{From: "now-6h", To: "now"},
+		Refresh:       "30s",
+		Templating: templating{List: []variable{{
+			Name:  "datasource",
+			Label: "Data source",
+			Type:  "datasource",
+			Query: "prometheus",
+		}}},
+		Panels: make([]panel, 0),
+	}
+
+	id := 1
+	y := 0
+	for _, op := range Operations() {
+		count, sel := operationSeries(op.Name, "count")
+		failures, _ := operationSeries(op.Name, "failures")
+		unit := currentDurationUnit()
+		timer, _ := operationSeries(op.Name, string(unit))
+
+		d.Panels = append(d.Panels, panel{
+			ID:      id,
+			Type:    "row",
+			Title:   op.Name,
+			GridPos: gridPos{H: 1, W: 24, X: 0, Y: y},
+		})
+		id++
+		y++
+
+		red := []struct {
+			title   string
+			unit    string
+			targets []target
+		}{
+			{
+				title: "Rate",
+				unit:  "reqps",
+				targets: []target{{
+					Expr:         fmt.Sprintf("sum(rate(%s_total%s[$__rate_interval]))", count, sel),
+					LegendFormat: "requests",
+				}},
+			},
+			{
+				title: "Errors",
+				unit:  "percentunit",
+				targets: []target{{
+					Expr: fmt.Sprintf("sum(rate(%s_total%s[$__rate_interval])) / sum(rate(%s_total%s[$__rate_interval]))",
+						failures, sel, count, sel),
+					LegendFormat: "error ratio",
+				}},
+			},
+			{
+				title: "Duration",
+				unit:  unit.symbol(),
+				targets: []target{
+					{
+						Expr:         fmt.Sprintf("histogram_quantile(0.5, sum by (le) (rate(%s_bucket%s[$__rate_interval])))", timer, sel),
+						LegendFormat: "p50",
+					},
+					{
+						Expr:         fmt.Sprintf("histogram_quantile(0.95, sum by (le) (rate(%s_bucket%s[$__rate_interval])))", timer, sel),
+						LegendFormat: "p95",
+					},
+					{
+						Expr:         fmt.Sprintf("histogram_quantile(0.99, sum by (le) (rate(%s_bucket%s[$__rate_interval])))", timer, sel),
+						LegendFormat: "p99",
+					},
+				},
+			},
+		}
+
+		for i, p := range red {
+			for j := range p.targets {
+				p.targets[j].RefID = string(rune('A' + j))
+				p.targets[j].Datasource = ds
+			}
+
+			d.Panels = append(d.Panels, panel{
+				ID:          id,
+				Type:        "timeseries",
+				Title:       fmt.Sprintf("%s %s", op.Name, p.title),
+				GridPos:     gridPos{H: 8, W: 8, X: i * 8, Y: y},
+				Datasource:  &ds,
+				Targets:     p.targets,
+				FieldConfig: &fieldConfig{Defaults: fieldDefaults{Unit: p.unit}},
+			})
+			id++
+		}
+		y += 8
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(d)
+}
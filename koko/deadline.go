@@ -0,0 +1,34 @@
+package koko
+
+import (
+	"context"
+	"time"
+
+	"github.com/kzs0/kokoro/internal/clock"
+)
+
+// deadlineBudget returns the time remaining before the deadline of ctx, if it
+// has one
+func deadlineBudget(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+
+	return deadline.Sub(clock.Now()), true
+}
+
+// deadlineAttributes describe how much of the deadline budget available when
+// the operation started was used. They are kept out of metric labels as their
+// values are unbounded.
+func deadlineAttributes(budget, elapsed time.Duration) []Attribute {
+	used := 100.0
+	if budget > 0 {
+		used = float64(elapsed) / float64(budget) * 100
+	}
+
+	return []Attribute{
+		Float64("deadline_budget_ms", float64(budget.Microseconds())/1000, LogOnly(), TraceOnly()),
+		Float64("deadline_used_pct", used, LogOnly(), TraceOnly()),
+	}
+}
@@ -0,0 +1,230 @@
+package koko
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kzs0/kokoro/diagnostics"
+	"github.com/kzs0/kokoro/internal/clock"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+const (
+	defaultDerivedWindow = time.Minute
+	// derivedSlots is the number of slots the window is divided into, so it
+	// slides in steps of a twelfth of the window
+	derivedSlots = 12
+	// derivedSamples bounds the durations kept per slot to estimate the p99
+	derivedSamples = 256
+)
+
+// WithDerivedMetrics exports gauges derived in-process from the calls of the
+// operation over the trailing window, one minute when it is not positive, so
+// simple threshold alerts can be set on backends without complex queries. They
+// are named like the other metrics of the operation, see OperationMetric:
+//
+//   - <operation>_panic_rate, the ratio of calls which panicked, see
+//     WithRecover
+//   - <operation>_slo_p99_ratio, the p99 latency over the latency objective,
+//     when the operation has one, see WithObjective
+//   - <operation>_saturation, the calls in flight over the limit, when the
+//     operation has one, see WithInFlightLimit
+func WithDerivedMetrics(window time.Duration) OperationOption {
+	return func(opts *operationOpts) {
+		if window <= 0 {
+			window = defaultDerivedWindow
+		}
+		opts.derivedWindow = window
+	}
+}
+
+// WithInFlightLimit declares the number of calls of the operation which can be
+// in flight at once, e.g. the size of the worker pool serving it, and exports
+// the <operation>_saturation gauge. The limit is not enforced.
+func WithInFlightLimit(limit int) OperationOption {
+	return func(opts *operationOpts) {
+		opts.inFlightLimit = limit
+	}
+}
+
+// derivedSlot aggregates the calls completed within a slot of the window
+type derivedSlot struct {
+	epoch     int64
+	calls     int64
+	panics    int64
+	durations []float64
+}
+
+// derivedState tracks the calls of an operation the derived gauges are
+// computed from, shared by every call of the operation
+type derivedState struct {
+	inFlight atomic.Int64
+
+	mu     sync.Mutex
+	window time.Duration
+	limit  int
+	slo    *objective
+	slots  [derivedSlots]derivedSlot
+}
+
+var derived struct {
+	mu         sync.Mutex
+	operations map[string]*derivedState
+}
+
+// startDerived counts a call of the operation as in flight and registers the
+// derived gauges of the operation, returning its state
+func startDerived(ctx context.Context, tel Telemetry, operation string, opt operationOpts) *derivedState {
+	derived.mu.Lock()
+	if derived.operations == nil {
+		derived.operations = make(map[string]*derivedState)
+	}
+	d, ok := derived.operations[operation]
+	if !ok {
+		d = &derivedState{}
+		derived.operations[operation] = d
+	}
+	derived.mu.Unlock()
+
+	d.mu.Lock()
+	if opt.derivedWindow > 0 {
+		d.window = opt.derivedWindow
+	}
+	if opt.inFlightLimit > 0 {
+		d.limit = opt.inFlightLimit
+	}
+	if opt.objective != nil {
+		d.slo = opt.objective
+	}
+	window, limit, slo := d.window, d.limit, d.slo
+	d.mu.Unlock()
+
+	d.inFlight.Add(1)
+
+	var errs error
+	if window > 0 {
+		errs = errors.Join(errs, d.gauge(tel, operation, "panic_rate", d.panicRate,
+			"ratio of calls of the operation which panicked over the window"))
+	}
+	if window > 0 && slo != nil {
+		errs = errors.Join(errs, d.gauge(tel, operation, "slo_p99_ratio", d.p99Ratio,
+			"p99 latency of the operation over the window divided by its latency objective"))
+	}
+	if limit > 0 {
+		errs = errors.Join(errs, d.gauge(tel, operation, "saturation", d.saturation,
+			"calls of the operation in flight divided by its in-flight limit"))
+	}
+	if errs != nil && !errors.Is(errs, ErrMetricsNotInitialized) {
+		diagnostics.Report(ctx, "koko", "failed to create derived metrics", errs, slog.String("operation", operation))
+	}
+
+	return d
+}
+
+// finish records a call of the operation which completed after dur
+func (d *derivedState) finish(dur time.Duration, panicked bool) {
+	d.inFlight.Add(-1)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.window <= 0 {
+		return
+	}
+
+	epoch := d.epoch(clock.Now())
+	s := &d.slots[epoch%derivedSlots]
+	if s.epoch != epoch {
+		*s = derivedSlot{epoch: epoch, durations: s.durations[:0]}
+	}
+
+	s.calls++
+	if panicked {
+		s.panics++
+	}
+
+	// reservoir sampling keeps a uniform sample of the durations of the slot
+	if len(s.durations) < derivedSamples {
+		s.durations = append(s.durations, dur.Seconds())
+	} else if i := rand.Int64N(s.calls); i < derivedSamples {
+		s.durations[i] = dur.Seconds()
+	}
+}
+
+func (d *derivedState) epoch(t time.Time) int64 {
+	return t.UnixNano() / max(int64(d.window/derivedSlots), 1)
+}
+
+// current calls f with every slot within the window, must be called with the
+// lock held
+func (d *derivedState) current(f func(s *derivedSlot)) {
+	now := d.epoch(clock.Now())
+	for i := range d.slots {
+		s := &d.slots[i]
+		if s.calls > 0 && s.epoch > now-derivedSlots {
+			f(s)
+		}
+	}
+}
+
+func (d *derivedState) panicRate() float64 {
+	var calls, panics int64
+	d.current(func(s *derivedSlot) {
+		calls += s.calls
+		panics += s.panics
+	})
+	if calls == 0 {
+		return 0
+	}
+
+	return float64(panics) / float64(calls)
+}
+
+func (d *derivedState) p99Ratio() float64 {
+	if d.slo == nil || d.slo.latency <= 0 {
+		return 0
+	}
+
+	var durations []float64
+	d.current(func(s *derivedSlot) {
+		durations = append(durations, s.durations...)
+	})
+	if len(durations) == 0 {
+		return 0
+	}
+
+	slices.Sort(durations)
+	i := int(math.Ceil(0.99*float64(len(durations)))) - 1
+
+	return durations[i] / d.slo.latency.Seconds()
+}
+
+func (d *derivedState) saturation() float64 {
+	if d.limit <= 0 {
+		return 0
+	}
+
+	return float64(d.inFlight.Load()) / float64(d.limit)
+}
+
+// gauge registers the derived gauge of the operation reporting value, named
+// like the other metrics of the operation, see OperationMetric
+func (d *derivedState) gauge(tel Telemetry, operation, signal string, value func() float64, desc string) error {
+	name, labelNames, labels := operationMetric(operation, signal)
+
+	_, err := tel.observableGaugeSeries(name, operation, func(context.Context) (float64, []metrics.MeasurementOption) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		return value(), labels
+	}, metrics.WithDescription(desc), metrics.WithLabelNames(labelNames))
+
+	return err
+}
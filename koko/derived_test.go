@@ -0,0 +1,84 @@
+package koko
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kzs0/kokoro/internal/clock"
+)
+
+func TestDerivedState(t *testing.T) {
+	type call struct {
+		advance  time.Duration
+		dur      time.Duration
+		panicked bool
+	}
+
+	tests := []struct {
+		name          string
+		calls         []call
+		advance       time.Duration
+		wantPanicRate float64
+		wantP99Ratio  float64
+	}{
+		{name: "no calls"},
+		{
+			name: "within objective",
+			calls: []call{
+				{dur: 50 * time.Millisecond},
+				{dur: 100 * time.Millisecond},
+			},
+			wantPanicRate: 0,
+			wantP99Ratio:  0.5,
+		},
+		{
+			name: "panics over objective",
+			calls: []call{
+				{dur: 100 * time.Millisecond},
+				{dur: 400 * time.Millisecond, panicked: true},
+				{dur: 100 * time.Millisecond},
+				{dur: 100 * time.Millisecond, panicked: true},
+			},
+			wantPanicRate: 0.5,
+			wantP99Ratio:  2,
+		},
+		{
+			name: "calls leave the window",
+			calls: []call{
+				{dur: 400 * time.Millisecond, panicked: true},
+				{advance: 2 * time.Minute, dur: 100 * time.Millisecond},
+			},
+			wantPanicRate: 0,
+			wantP99Ratio:  0.5,
+		},
+		{
+			name: "window expired",
+			calls: []call{
+				{dur: 400 * time.Millisecond, panicked: true},
+			},
+			advance: 2 * time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := clock.NewFake(time.Unix(0, 0))
+			t.Cleanup(clock.Set(fake))
+
+			d := &derivedState{window: time.Minute, slo: &objective{latency: 200 * time.Millisecond}}
+			for _, c := range tt.calls {
+				fake.Advance(c.advance)
+				d.inFlight.Add(1)
+				d.finish(c.dur, c.panicked)
+			}
+			fake.Advance(tt.advance)
+
+			if got := d.panicRate(); got != tt.wantPanicRate {
+				t.Errorf("panicRate() = %v, want %v", got, tt.wantPanicRate)
+			}
+			if got := d.p99Ratio(); got != tt.wantP99Ratio {
+				t.Errorf("p99Ratio() = %v, want %v", got, tt.wantP99Ratio)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package koko
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+// DurationUnit is the unit the duration histogram of every operation records
+// in, which is also the signal it is named with, e.g. checkout_seconds
+type DurationUnit string
+
+const (
+	// Millis records durations in milliseconds, the default
+	Millis DurationUnit = "millis"
+	// Seconds records durations in seconds, as the OpenTelemetry semantic
+	// conventions recommend
+	Seconds DurationUnit = "seconds"
+)
+
+// secondsBuckets are the bucket boundaries the OpenTelemetry semantic
+// conventions recommend for durations in seconds, the defaults of the SDK
+// being suited to milliseconds
+var secondsBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10}
+
+var durationUnit atomic.Value
+
+// SetDurationUnit sets the unit operation durations are recorded in, which
+// also names the histogram, e.g. checkout_millis or checkout_seconds. It
+// applies to histograms created after it is set, so it should be set before
+// any operation is started, as kokoro.Init does from OPERATION_DURATION_UNIT.
+// Bucket boundaries set with SetOperationBuckets are in the same unit.
+func SetDurationUnit(u DurationUnit) error {
+	switch u {
+	case "":
+		u = Millis
+	case Millis, Seconds:
+	default:
+		return fmt.Errorf("%q is not a duration unit, expected %s or %s", u, Millis, Seconds)
+	}
+
+	durationUnit.Store(u)
+
+	return nil
+}
+
+func currentDurationUnit() DurationUnit {
+	u, _ := durationUnit.Load().(DurationUnit)
+	if u == "" {
+		return Millis
+	}
+
+	return u
+}
+
+// measure converts d to the unit
+func (u DurationUnit) measure(d time.Duration) float64 {
+	if u == Seconds {
+		return d.Seconds()
+	}
+
+	return float64(d.Milliseconds())
+}
+
+// symbol returns the UCUM symbol of the unit, which is also the unit Grafana
+// displays it as
+func (u DurationUnit) symbol() string {
+	if u == Seconds {
+		return "s"
+	}
+
+	return "ms"
+}
+
+// long returns the name of the unit written out, e.g. milliseconds
+func (u DurationUnit) long() string {
+	if u == Seconds {
+		return "seconds"
+	}
+
+	return "milliseconds"
+}
+
+// timerOptions returns the unit and buckets of a histogram of durations in the
+// unit, matching the duration histogram of the operations
+func (u DurationUnit) timerOptions() []metrics.MetricOption {
+	if u != Seconds {
+		return nil
+	}
+
+	return []metrics.MetricOption{
+		metrics.WithUnit(u.symbol()),
+		metrics.WithHistogramBucketsBounds(secondsBuckets...),
+	}
+}
@@ -0,0 +1,46 @@
+package koko
+
+import (
+	"context"
+	"sync"
+)
+
+type errorList struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+func (l *errorList) add(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.errs = append(l.errs, err)
+}
+
+func (l *errorList) list() []error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	errs := make([]error, len(l.errs))
+	copy(errs, l.errs)
+
+	return errs
+}
+
+// AddError attaches an error to the current operation without failing it, for
+// operations that tolerate partial failures.
+//
+// On completion every error added is recorded as a span event, a joined
+// summary is logged, and the number of errors is registered as error_count.
+func AddError(ctx context.Context, err error) {
+	if err == nil {
+		return
+	}
+
+	st, ok := getStack(ctx)
+	if !ok {
+		return
+	}
+
+	st.Errors.add(err)
+}
@@ -0,0 +1,122 @@
+package koko
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+
+	"github.com/kzs0/kokoro/kerr"
+)
+
+// otherErrorType is reported when no more specific type can be derived, as
+// recommended by the OpenTelemetry semantic conventions
+const otherErrorType = "_OTHER"
+
+// ErrorTyper is implemented by errors that name their own type, which takes
+// precedence over the type derived from the error chain
+type ErrorTyper interface {
+	ErrorType() string
+}
+
+type namedError struct {
+	err  error
+	name string
+}
+
+var errorNames = struct {
+	mu    sync.RWMutex
+	names []namedError
+}{
+	names: []namedError{
+		{context.Canceled, "context.Canceled"},
+		{context.DeadlineExceeded, "context.DeadlineExceeded"},
+	},
+}
+
+// NameError names a sentinel error, e.g. NameError(sql.ErrNoRows,
+// "sql.ErrNoRows"), so operations failing with an error matching it with
+// errors.Is report the name as their error type instead of the type of the
+// error
+func NameError(err error, name string) {
+	errorNames.mu.Lock()
+	defer errorNames.mu.Unlock()
+
+	errorNames.names = append(errorNames.names, namedError{err: err, name: name})
+}
+
+// ErrorType derives the type of an error reported as the error.type attribute
+// and status description of operation spans. It is, in order of precedence,
+// the type named by an ErrorTyper in the chain, the name of a sentinel error
+// matched by errors.Is, see NameError, or the Go type of the innermost error
+// of the chain that does more than carry a message or wrap, e.g.
+// *net.OpError. Chains of such errors alone report their kerr category, or
+// _OTHER when uncategorized.
+func ErrorType(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var typer ErrorTyper
+	if errors.As(err, &typer) {
+		return typer.ErrorType()
+	}
+
+	errorNames.mu.RLock()
+	names := errorNames.names
+	errorNames.mu.RUnlock()
+
+	for i := len(names) - 1; i >= 0; i-- {
+		if errors.Is(err, names[i].err) {
+			return names[i].name
+		}
+	}
+
+	switch typed := innermostTyped(err).(type) {
+	case nil:
+		if c := kerr.CategoryOf(err); c != kerr.Internal {
+			return string(c)
+		}
+
+		return otherErrorType
+	case kerr.Category:
+		return string(typed)
+	default:
+		return reflect.TypeOf(typed).String()
+	}
+}
+
+// genericErrors are the types of errors that only carry a message or wrap
+// other errors, which say nothing about the type of the failure
+var genericErrors = map[string]struct{}{
+	"*errors.errorString": {},
+	"*errors.joinError":   {},
+	"*fmt.wrapError":      {},
+	"*fmt.wrapErrors":     {},
+	"*kerr.Error":         {},
+}
+
+// innermostTyped follows the chain of err, taking the first error of joined
+// errors, and returns the innermost error that isn't generic, or nil when
+// every error of the chain is
+func innermostTyped(err error) error {
+	var typed error
+	for err != nil {
+		if _, ok := genericErrors[reflect.TypeOf(err).String()]; !ok {
+			typed = err
+		}
+
+		var next error
+		switch e := err.(type) {
+		case interface{ Unwrap() error }:
+			next = e.Unwrap()
+		case interface{ Unwrap() []error }:
+			if errs := e.Unwrap(); len(errs) > 0 {
+				next = errs[0]
+			}
+		}
+		err = next
+	}
+
+	return typed
+}
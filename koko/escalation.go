@@ -0,0 +1,86 @@
+package koko
+
+import (
+	"errors"
+	"log/slog"
+	"sync/atomic"
+)
+
+// EscalationPolicy determines the level a failed operation is logged at, given
+// the level registered on the operation and the error it returned
+type EscalationPolicy func(level slog.Level, err error) slog.Level
+
+// EscalateOnError logs every failed operation at WARN or above. This is the
+// default policy.
+func EscalateOnError(level slog.Level, _ error) slog.Level {
+	return max(level, slog.LevelWarn)
+}
+
+// RespectLevel logs failed operations at the level registered on them
+func RespectLevel(level slog.Level, _ error) slog.Level {
+	return level
+}
+
+// EscalateUnexpected logs failed operations at WARN or above unless the error
+// matches one of the expected errors
+func EscalateUnexpected(expected ...error) EscalationPolicy {
+	return func(level slog.Level, err error) slog.Level {
+		for _, e := range expected {
+			if errors.Is(err, e) {
+				return level
+			}
+		}
+
+		return EscalateOnError(level, err)
+	}
+}
+
+// EscalateByError logs failed operations at the level mapped to the error
+// they returned. When the error matches several entries the highest level is
+// used, and errors matching none are logged at WARN or above.
+func EscalateByError(levels map[error]slog.Level) EscalationPolicy {
+	return func(level slog.Level, err error) slog.Level {
+		matched := false
+		escalated := level
+		for e, l := range levels {
+			if errors.Is(err, e) {
+				matched = true
+				escalated = max(escalated, l)
+			}
+		}
+
+		if !matched {
+			return EscalateOnError(level, err)
+		}
+
+		return escalated
+	}
+}
+
+var defaultEscalation atomic.Pointer[EscalationPolicy]
+
+// SetEscalationPolicy sets the policy used by operations that are not started
+// WithEscalationPolicy
+func SetEscalationPolicy(policy EscalationPolicy) {
+	defaultEscalation.Store(&policy)
+}
+
+// WithEscalationPolicy sets the policy used to determine the level the
+// operation is logged at when it fails
+func WithEscalationPolicy(policy EscalationPolicy) OperationOption {
+	return func(opts *operationOpts) {
+		opts.escalation = policy
+	}
+}
+
+func escalationPolicy(opts operationOpts) EscalationPolicy {
+	if opts.escalation != nil {
+		return opts.escalation
+	}
+
+	if p := defaultEscalation.Load(); p != nil && *p != nil {
+		return *p
+	}
+
+	return EscalateOnError
+}
@@ -0,0 +1,85 @@
+package koko
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// CallKind is the kind of call a Hook is invoked for
+type CallKind string
+
+const (
+	KindOperation CallKind = "operation"
+	KindPure      CallKind = "pure"
+	KindImpure    CallKind = "impure"
+)
+
+// Call describes the Operation, Pure, or Impure call a Hook is invoked for
+type Call struct {
+	Name  string
+	Kind  CallKind
+	Start time.Time
+}
+
+// Hook observes every Operation, Pure, and Impure call started by the process,
+// enabling org-wide policies such as auditing, chaos injection, SLO recording,
+// or rate-limit accounting without wrapping each call site.
+type Hook interface {
+	// Before is called once the span of the call has been started and its
+	// attributes registered. The context it returns is the one the call
+	// continues with, so it can register attributes or attach values.
+	Before(ctx context.Context, call Call) context.Context
+
+	// After is called when the call completes with the error it returned, its
+	// duration, and every attribute registered on it, before it is reported.
+	// Attributes registered on ctx are reported along with the call.
+	After(ctx context.Context, call Call, err error, dur time.Duration, attrs []slog.Attr)
+}
+
+var hooks struct {
+	mu    sync.RWMutex
+	hooks []Hook
+}
+
+// Use registers hooks that are invoked for every call. Before is called in the
+// order they were registered and After in the reverse order, so the first
+// registered wraps all the others.
+func Use(hs ...Hook) {
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+
+	hooks.hooks = append(hooks.hooks, hs...)
+}
+
+func registeredHooks() []Hook {
+	hooks.mu.RLock()
+	defer hooks.mu.RUnlock()
+
+	return hooks.hooks
+}
+
+func runBeforeHooks(ctx context.Context, call Call) context.Context {
+	for _, h := range registeredHooks() {
+		ctx = h.Before(ctx, call)
+	}
+
+	return ctx
+}
+
+func runAfterHooks(ctx context.Context, call Call, err error, dur time.Duration) {
+	hs := registeredHooks()
+	if len(hs) == 0 {
+		return
+	}
+
+	var attrs []slog.Attr
+	if st, ok := getStack(ctx); ok {
+		attrs = st.attrs()
+	}
+
+	for i := len(hs) - 1; i >= 0; i-- {
+		hs[i].After(ctx, call, err, dur, attrs)
+	}
+}
@@ -0,0 +1,42 @@
+package koko
+
+import (
+	"log/slog"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/kzs0/kokoro/internal/clock"
+)
+
+var leakTimeout atomic.Int64
+
+// DetectLeaks enables a debug mode where every operation that has not called
+// its Done within the provided duration logs a warning along with the stack
+// that started it. This catches forgotten `defer done(&ctx, &err)` calls.
+//
+// A duration of zero disables leak detection, which is the default.
+func DetectLeaks(after time.Duration) {
+	leakTimeout.Store(int64(after))
+}
+
+// watchLeak will warn if the returned func is not called before the leak
+// timeout elapses
+func watchLeak(operation string) func() {
+	after := time.Duration(leakTimeout.Load())
+	if after <= 0 {
+		return func() {}
+	}
+
+	stack := string(debug.Stack())
+	stop := clock.AfterFunc(after, func() {
+		slog.Warn("operation done was not called",
+			slog.String("operation", operation),
+			slog.Duration("after", after),
+			slog.String("stack", stack))
+	})
+
+	return func() {
+		stop()
+	}
+}
@@ -0,0 +1,180 @@
+package koko
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/kzs0/kokoro/diagnostics"
+	"github.com/kzs0/kokoro/internal/clock"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+var ErrThrottled = errors.New("rate limit exceeded")
+
+type limitOpts struct {
+	wait bool
+}
+
+type LimitOption func(*limitOpts)
+
+// WithDelay will delay calls until the limiter permits them rather than
+// rejecting them with ErrThrottled
+func WithDelay() LimitOption {
+	return func(opts *limitOpts) {
+		opts.wait = true
+	}
+}
+
+// Limiter is a token bucket rate limiter which reports the calls it allows and
+// throttles
+type Limiter struct {
+	name  string
+	rate  float64
+	burst float64
+	wait  bool
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	allowed   metrics.Counter
+	throttled metrics.Counter
+	waits     metrics.Histogram
+	unit      DurationUnit
+}
+
+// Limit creates a Limiter permitting rate calls per second with bursts of up
+// to burst calls.
+//
+// Allowed and throttled calls are counted in <name>_allowed and
+// <name>_throttled, and the time calls spend waiting on the limiter is
+// observed in <name>_wait_millis, or <name>_wait_seconds when durations are
+// recorded in seconds, see SetDurationUnit.
+func Limit(name string, rate float64, burst int, opts ...LimitOption) (*Limiter, error) {
+	opt := limitOpts{}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	if rate <= 0 || burst < 1 {
+		return nil, fmt.Errorf("rate and burst must be positive, got rate %v and burst %d", rate, burst)
+	}
+
+	allowed, err := Counter(fmt.Sprintf("%s_allowed", name))
+	if err != nil {
+		return nil, err
+	}
+
+	throttled, err := Counter(fmt.Sprintf("%s_throttled", name))
+	if err != nil {
+		return nil, err
+	}
+
+	unit := currentDurationUnit()
+	waitOpts := append([]metrics.MetricOption{
+		metrics.WithDescription(fmt.Sprintf("time spent waiting on the limiter in %s", unit.long())),
+	}, unit.timerOptions()...)
+
+	waits, err := Histogram(fmt.Sprintf("%s_wait_%s", name, unit), waitOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Limiter{
+		name:      name,
+		rate:      rate,
+		burst:     float64(burst),
+		wait:      opt.wait,
+		tokens:    float64(burst),
+		last:      clock.Now(),
+		allowed:   allowed,
+		throttled: throttled,
+		waits:     waits,
+		unit:      unit,
+	}, nil
+}
+
+// reserve takes a token from the bucket, returning how long the caller must
+// wait before the token is available. When take is false a token is only
+// taken if one is available immediately.
+func (l *Limiter) reserve(take bool) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := clock.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0, true
+	}
+
+	if !take {
+		return 0, false
+	}
+
+	wait := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	l.tokens--
+
+	return wait, true
+}
+
+func (l *Limiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens = math.Min(l.burst, l.tokens+1)
+}
+
+// Do calls fn if the limiter permits it, delaying the call when created
+// WithDelay and otherwise rejecting it with ErrThrottled.
+//
+// Whether the call was throttled and how long it waited are registered on the
+// current operation.
+func (l *Limiter) Do(ctx context.Context, fn func(context.Context) error) error {
+	wait, ok := l.reserve(l.wait)
+	if !ok {
+		l.record(ctx, l.throttled)
+		Register(ctx, Bool("throttled", true))
+		return ErrThrottled
+	}
+
+	if wait > 0 {
+		timer := clock.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			l.cancel()
+			l.record(ctx, l.throttled)
+			Register(ctx, Bool("throttled", true))
+			return errors.Join(ErrThrottled, ctx.Err())
+		case <-timer.C():
+		}
+	}
+
+	l.record(ctx, l.allowed)
+	err := l.waits.Record(ctx, l.unit.measure(wait))
+	if err != nil {
+		diagnostics.Report(ctx, "koko", "failed to record limiter wait", err, slog.String("limiter", l.name))
+	}
+
+	ctx = Register(ctx,
+		Bool("throttled", wait > 0),
+		Float64("limit_wait_ms", float64(wait.Microseconds())/1000, LogOnly(), TraceOnly()),
+	)
+
+	return fn(ctx)
+}
+
+func (l *Limiter) record(ctx context.Context, counter metrics.Counter) {
+	err := counter.Incr(ctx)
+	if err != nil {
+		diagnostics.Report(ctx, "koko", "failed to record limiter outcome", err, slog.String("limiter", l.name))
+	}
+}
@@ -0,0 +1,73 @@
+package koko
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kzs0/kokoro/internal/clock"
+)
+
+func TestLimiterReserve(t *testing.T) {
+	type step struct {
+		advance  time.Duration
+		take     bool
+		wantWait time.Duration
+		wantOK   bool
+	}
+
+	tests := []struct {
+		name  string
+		rate  float64
+		burst float64
+		steps []step
+	}{
+		{
+			name: "burst then refused", rate: 1, burst: 2,
+			steps: []step{
+				{wantOK: true},
+				{wantOK: true},
+				{wantOK: false},
+			},
+		},
+		{
+			name: "refills over time", rate: 2, burst: 1,
+			steps: []step{
+				{wantOK: true},
+				{advance: 250 * time.Millisecond, wantOK: false},
+				{advance: 250 * time.Millisecond, wantOK: true},
+			},
+		},
+		{
+			name: "refill capped at burst", rate: 10, burst: 1,
+			steps: []step{
+				{advance: time.Minute, wantOK: true},
+				{wantOK: false},
+			},
+		},
+		{
+			name: "waits for the next token", rate: 4, burst: 1,
+			steps: []step{
+				{wantOK: true},
+				{take: true, wantWait: 250 * time.Millisecond, wantOK: true},
+				{take: true, wantWait: 500 * time.Millisecond, wantOK: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := clock.NewFake(time.Unix(0, 0))
+			t.Cleanup(clock.Set(fake))
+
+			l := &Limiter{rate: tt.rate, burst: tt.burst, tokens: tt.burst, last: fake.Now()}
+			for i, s := range tt.steps {
+				fake.Advance(s.advance)
+
+				wait, ok := l.reserve(s.take)
+				if wait != s.wantWait || ok != s.wantOK {
+					t.Fatalf("step %d: reserve(%v) = %v, %v, want %v, %v", i, s.take, wait, ok, s.wantWait, s.wantOK)
+				}
+			}
+		})
+	}
+}
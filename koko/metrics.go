@@ -1,15 +1,83 @@
 package koko
 
-import "github.com/kzs0/kokoro/telemetry/metrics"
+import (
+	"context"
 
+	"github.com/kzs0/kokoro/telemetry/metrics"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Counter creates a counter, or returns the one previously created by name.
+// Measurements made within an operation are labeled with the labels
+// registered on it which the metric accepts, see MetricLabel, labels provided
+// to the measurement taking precedence. Like any metric, it only keeps the
+// labels declared WithLabelNames, or every label WithAnyLabels.
 func Counter(name string, opts ...metrics.MetricOption) (metrics.Counter, error) {
-	return metrics.DefaultFactory.NewCounter(name, opts...)
+	c, err := telemetryFrom(context.Background()).counter(name, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return operationCounter{Counter: c}, nil
 }
 
+// Histogram creates a histogram, or returns the one previously created by
+// name. Measurements made within an operation are labeled like those of
+// Counter.
 func Histogram(name string, opts ...metrics.MetricOption) (metrics.Histogram, error) {
-	return metrics.DefaultFactory.NewHistogram(name, opts...)
+	h, err := telemetryFrom(context.Background()).histogram(name, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return operationHistogram{Histogram: h}, nil
 }
 
 func Gauge(name string, opts ...metrics.MetricOption) (metrics.Gauge, error) {
-	return metrics.DefaultFactory.NewGauge(name, opts...)
+	return telemetryFrom(context.Background()).gauge(name, opts...)
+}
+
+// ObservableGauge creates a gauge whose value is returned by the callback
+// whenever metrics are collected, or returns the one previously created by
+// name, see metrics.Factory
+func ObservableGauge(name string, callback func(context.Context) (float64, []metrics.MeasurementOption), opts ...metrics.MetricOption) (metrics.ObservableGauge, error) {
+	return telemetryFrom(context.Background()).observableGauge(name, callback, opts...)
+}
+
+// ObservableGaugeSeries adds the series reported by the callback to a gauge
+// several callers share, such as one named for many operations by the metric
+// name template, see metrics.ObservableGaugeSeries. The series is created once
+// by name and series.
+func ObservableGaugeSeries(name, series string, callback func(context.Context) (float64, []metrics.MeasurementOption), opts ...metrics.MetricOption) (metrics.ObservableGauge, error) {
+	return telemetryFrom(context.Background()).observableGaugeSeries(name, series, callback, opts...)
+}
+
+// withOperationLabels prepends the labels of the operation of ctx to opts
+func withOperationLabels(ctx context.Context, opts []metrics.MeasurementOption) []metrics.MeasurementOption {
+	st, ok := getStack(ctx)
+	if !ok {
+		return opts
+	}
+
+	return append(st.metricLabels(trace.SpanContextFromContext(ctx).IsSampled()), opts...)
+}
+
+type operationCounter struct {
+	metrics.Counter
+}
+
+func (c operationCounter) Incr(ctx context.Context, opts ...metrics.MeasurementOption) error {
+	return c.Counter.Incr(ctx, withOperationLabels(ctx, opts)...)
+}
+
+func (c operationCounter) Add(ctx context.Context, addend float64, opts ...metrics.MeasurementOption) error {
+	return c.Counter.Add(ctx, addend, withOperationLabels(ctx, opts)...)
+}
+
+type operationHistogram struct {
+	metrics.Histogram
+}
+
+func (h operationHistogram) Record(ctx context.Context, measurement float64, opts ...metrics.MeasurementOption) error {
+	return h.Histogram.Record(ctx, measurement, withOperationLabels(ctx, opts)...)
 }
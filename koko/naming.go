@@ -0,0 +1,153 @@
+package koko
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+var callerPrefixes struct {
+	mu       sync.RWMutex
+	prefixes []string
+}
+
+// TrimCallerPrefixes configures the module prefixes trimmed from operation
+// names derived from the calling function.
+//
+// When no configured prefix matches, everything up to the final path element
+// of the package is trimmed, e.g. "github.com/acme/shop/cart.(*Cart).Checkout"
+// becomes "cart_Cart_Checkout".
+func TrimCallerPrefixes(prefixes ...string) {
+	callerPrefixes.mu.Lock()
+	defer callerPrefixes.mu.Unlock()
+
+	callerPrefixes.prefixes = prefixes
+}
+
+// callerOperationName derives an operation name from the function skip frames
+// above it
+func callerOperationName(skip int) string {
+	return operationNameFromFunc(callerName(skip + 1))
+}
+
+func operationNameFromFunc(fn string) string {
+	callerPrefixes.mu.RLock()
+	prefixes := callerPrefixes.prefixes
+	callerPrefixes.mu.RUnlock()
+
+	trimmed := false
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(fn, prefix) {
+			fn = strings.TrimPrefix(fn, prefix)
+			trimmed = true
+			break
+		}
+	}
+
+	if !trimmed {
+		if i := strings.LastIndex(fn, "/"); i >= 0 {
+			fn = fn[i+1:]
+		}
+	}
+
+	return sanitizeName(fn)
+}
+
+// sanitizeName replaces every run of characters that are not valid in metric
+// names with a single underscore
+func sanitizeName(name string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range name {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+			underscore = false
+			continue
+		}
+
+		if !underscore && b.Len() > 0 {
+			b.WriteRune('_')
+			underscore = true
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "_")
+}
+
+const defaultMetricNameTemplate = "{operation}_{signal}"
+
+var metricNameTemplate struct {
+	mu       sync.RWMutex
+	template string
+}
+
+// SetMetricNameTemplate configures how the metrics of every operation are
+// named, from the {operation} name and the {signal}, e.g. success or millis.
+// Defaults to {operation}_{signal}.
+//
+// When the template has no {operation}, e.g. operation_{signal}, operations
+// share their metrics and are told apart by the operation label instead. The
+// service prefix is applied by the metrics factory, see
+// metrics.WithNameTemplate.
+func SetMetricNameTemplate(template string) error {
+	if template == "" {
+		template = defaultMetricNameTemplate
+	}
+
+	if !strings.Contains(template, "{signal}") {
+		return fmt.Errorf("metric name template %q has no {signal}", template)
+	}
+
+	rest := strings.NewReplacer("{operation}", "", "{signal}", "").Replace(template)
+	if strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("metric name template %q only supports {operation} and {signal}", template)
+	}
+
+	metricNameTemplate.mu.Lock()
+	defer metricNameTemplate.mu.Unlock()
+
+	metricNameTemplate.template = template
+
+	return nil
+}
+
+// OperationMetric returns the name of the metric an operation reports the
+// signal provided to, e.g. success, failures, canceled, expected, count, or
+// millis, along with the labels identifying the operation when operations
+// share the metric, see SetMetricNameTemplate
+func OperationMetric(operation, signal string) (string, map[string]string) {
+	metricNameTemplate.mu.RLock()
+	template := metricNameTemplate.template
+	metricNameTemplate.mu.RUnlock()
+
+	if template == "" {
+		template = defaultMetricNameTemplate
+	}
+
+	name := strings.NewReplacer("{operation}", operation, "{signal}", signal).Replace(template)
+	if strings.Contains(template, "{operation}") {
+		return name, nil
+	}
+
+	return name, map[string]string{"operation": operation}
+}
+
+// operationMetric returns the name of the metric an operation reports the
+// signal to, see OperationMetric, along with the names of the labels
+// identifying the operation, to be declared WithLabelNames, and the labels to
+// measure it with
+func operationMetric(operation, signal string) (string, []string, []metrics.MeasurementOption) {
+	name, naming := OperationMetric(operation, signal)
+
+	names := make([]string, 0, len(naming))
+	labels := make([]metrics.MeasurementOption, 0, len(naming))
+	for k, v := range naming {
+		names = append(names, k)
+		labels = append(labels, metrics.WithLabel(k, v))
+	}
+
+	return name, names, labels
+}
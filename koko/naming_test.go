@@ -0,0 +1,91 @@
+package koko_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/kokoro/kokotest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestMetricNameTemplate(t *testing.T) {
+	if err := koko.SetMetricNameTemplate("operation_{signal}"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = koko.SetMetricNameTemplate("") })
+
+	ctx, tel := kokotest.Init(t)
+
+	for _, operation := range []string{"checkout", "refund"} {
+		func() {
+			ctx, done := koko.Operation(ctx, operation,
+				koko.WithObjective(time.Second, 0.99),
+				koko.WithDerivedMetrics(time.Minute),
+				koko.WithInFlightLimit(10),
+				koko.WithThroughputHistograms(),
+			)
+			defer done(&ctx, new(error))
+
+			ctx = koko.Register(ctx, koko.Count("items", 3))
+		}()
+
+		err := koko.Batch(ctx, operation, []int{1, 2}, func(context.Context, int) error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	signals := []string{
+		"slo_within", "slo_good", "slo_events", "slo_target",
+		"panic_rate", "slo_p99_ratio", "saturation",
+		"items", "items_success",
+	}
+
+	operations := make(map[string]map[string]bool)
+	rm := tel.Metrics(t)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			for _, attrs := range attributeSets(m.Data) {
+				op, ok := attrs.Value("operation")
+				if !ok {
+					continue
+				}
+				if operations[m.Name] == nil {
+					operations[m.Name] = make(map[string]bool)
+				}
+				operations[m.Name][op.AsString()] = true
+			}
+		}
+	}
+
+	for _, signal := range signals {
+		name := tel.Name("operation_" + signal)
+		if !operations[name]["checkout"] || !operations[name]["refund"] {
+			t.Errorf("%s reported for operations %v, want checkout and refund", name, operations[name])
+		}
+	}
+}
+
+// attributeSets returns the label sets of the data points of a metric
+func attributeSets(data metricdata.Aggregation) []attribute.Set {
+	var sets []attribute.Set
+	switch d := data.(type) {
+	case metricdata.Sum[float64]:
+		for _, dp := range d.DataPoints {
+			sets = append(sets, dp.Attributes)
+		}
+	case metricdata.Gauge[float64]:
+		for _, dp := range d.DataPoints {
+			sets = append(sets, dp.Attributes)
+		}
+	case metricdata.Histogram[float64]:
+		for _, dp := range d.DataPoints {
+			sets = append(sets, dp.Attributes)
+		}
+	}
+
+	return sets
+}
@@ -2,71 +2,90 @@ package koko
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"runtime"
+	"runtime/debug"
 	"strings"
 	"time"
 
+	"github.com/kzs0/kokoro/diagnostics"
+	"github.com/kzs0/kokoro/internal/clock"
+	"github.com/kzs0/kokoro/kerr"
 	"github.com/kzs0/kokoro/telemetry/logs"
 	"github.com/kzs0/kokoro/telemetry/metrics"
-	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 )
 
-var tracerName string = "kzs0/kokoro"
+type outcome int
+
+const (
+	outcomeSuccess outcome = iota
+	outcomeFailure
+	outcomeCanceled
+	outcomeExpected
+)
+
+// outcomeOf classifies the result of an operation. Errors caused by a context
+// being canceled or exceeding its deadline, and errors in an expected kerr
+// category, are not considered genuine failures. An operation failing for
+// another reason after its context is done is still a failure.
+func outcomeOf(ctx context.Context, err error) outcome {
+	switch {
+	case err == nil:
+		return outcomeSuccess
+	case errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded),
+		context.Cause(ctx) != nil && errors.Is(err, context.Cause(ctx)):
+		return outcomeCanceled
+	case kerr.IsExpected(err):
+		return outcomeExpected
+	default:
+		return outcomeFailure
+	}
+}
 
 type recorder struct {
 	operation string
+	labels    []metrics.MeasurementOption
 	successes metrics.Counter
 	failures  metrics.Counter
+	canceled  metrics.Counter
+	expected  metrics.Counter
 	count     metrics.Counter
+	unit      DurationUnit
 	timer     metrics.Histogram
 }
 
-func (r *recorder) AddLabels(opts ...metrics.MeasurementOption) {
-	r.successes.Load(opts...)
-	r.failures.Load(opts...)
-	r.count.Load(opts...)
-	r.timer.Load(opts...)
-}
-
-func (r *recorder) Record(ctx context.Context, dur time.Duration, success bool) error {
-	if success {
-		successes, err := Counter(fmt.Sprintf("%s_success", r.operation))
-		if err != nil {
-			return err
-		}
-
-		err = successes.Incr(ctx)
-		if err != nil {
-			return err
-		}
-	} else {
-		failures, err := Counter(fmt.Sprintf("%s_failures", r.operation))
-		if err != nil {
-			return err
-		}
-
-		err = failures.Incr(ctx)
-		if err != nil {
-			return err
-		}
+func (r *recorder) Record(ctx context.Context, dur time.Duration, out outcome, opts ...metrics.MeasurementOption) error {
+	opts = append(opts, r.labels...)
+
+	var err error
+	switch out {
+	case outcomeSuccess:
+		err = r.successes.Incr(ctx, opts...)
+	case outcomeCanceled:
+		err = r.canceled.Incr(ctx, opts...)
+	case outcomeExpected:
+		err = r.expected.Incr(ctx, opts...)
+	default:
+		err = r.failures.Incr(ctx, opts...)
 	}
-
-	ops, err := Counter(fmt.Sprintf("%s_count", r.operation))
 	if err != nil {
 		return err
 	}
 
-	err = ops.Incr(ctx)
+	err = r.count.Incr(ctx, opts...)
 	if err != nil {
 		return err
 	}
 
-	timer, err := Histogram(fmt.Sprintf("%s_millis", r.operation))
-	err = timer.Record(ctx, float64(dur.Milliseconds()))
+	// ctx carries the operation span so the measurement is linked to the trace
+	// as an exemplar
+	err = r.timer.Record(ctx, r.unit.measure(dur), opts...)
 	if err != nil {
 		return err
 	}
@@ -74,34 +93,62 @@ func (r *recorder) Record(ctx context.Context, dur time.Duration, success bool)
 	return nil
 }
 
-func newRecorder(op string) (*recorder, error) {
-	successes, err := Counter(fmt.Sprintf("%s_success", op))
-	if err != nil {
-		return nil, err
+func newRecorder(tel Telemetry, op string) (*recorder, error) {
+	r := &recorder{operation: op}
+
+	counters := []struct {
+		signal  string
+		counter *metrics.Counter
+	}{
+		{"success", &r.successes},
+		{"failures", &r.failures},
+		{"canceled", &r.canceled},
+		{"expected", &r.expected},
+		{"count", &r.count},
 	}
 
-	failures, err := Counter(fmt.Sprintf("%s_failures", op))
-	if err != nil {
-		return nil, err
+	var labels map[string]string
+	for _, c := range counters {
+		var name string
+		name, labels = OperationMetric(op, c.signal)
+
+		counter, err := tel.counter(name, metrics.WithAnyLabels())
+		if err != nil {
+			return nil, err
+		}
+		*c.counter = counter
 	}
 
-	count, err := Counter(fmt.Sprintf("%s_count", op))
-	if err != nil {
-		return nil, err
+	r.unit = currentDurationUnit()
+	timerOpts := []metrics.MetricOption{
+		metrics.WithDescription(fmt.Sprintf("duration of the operation in %s", r.unit.long())),
+		metrics.WithAnyLabels(),
+	}
+	// the prometheus exporter appends _milliseconds to metrics in ms, so the
+	// unit is only set in seconds, which the name already ends with
+	if r.unit == Seconds {
+		timerOpts = append(timerOpts, metrics.WithUnit(r.unit.symbol()))
 	}
 
-	timer, err := Histogram(fmt.Sprintf("%s_millis", op))
+	switch buckets := registry.buckets(op); {
+	case len(buckets) > 0:
+		timerOpts = append(timerOpts, metrics.WithHistogramBucketsBounds(buckets...))
+	case r.unit == Seconds:
+		timerOpts = append(timerOpts, metrics.WithHistogramBucketsBounds(secondsBuckets...))
+	}
+
+	name, _ := OperationMetric(op, string(r.unit))
+	timer, err := tel.histogram(name, timerOpts...)
 	if err != nil {
 		return nil, err
 	}
+	r.timer = timer
 
-	return &recorder{
-		operation: op,
-		successes: successes,
-		failures:  failures,
-		count:     count,
-		timer:     timer,
-	}, nil
+	for k, v := range labels {
+		r.labels = append(r.labels, metrics.WithLabel(k, v))
+	}
+
+	return r, nil
 }
 
 type Done func(*context.Context, *error)
@@ -112,89 +159,262 @@ type NoErrDone func(*context.Context)
 // and logs automatically.
 //
 // An operation is assumed to have some failure condition due to side effects.
-func Operation(ctx context.Context, operation string) (context.Context, Done) {
-	ctx = initStack(ctx)
-	start := time.Now()
+//
+// An operation started within another is its child: its span is a child of
+// the span of the parent, it inherits the attributes registered on the parent,
+// including the metric labels, and registers the parent_operation attribute.
+// Attributes registered on the child do not reach the parent, and done
+// restores the context of the parent so the caller continues within it.
+//
+// If the operation name is empty it is the one provided WithName, or derived
+// from the calling function, see TrimCallerPrefixes.
+func Operation(ctx context.Context, operation string, opts ...OperationOption) (context.Context, Done) {
+	opt := operationOpts{}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	if operation == "" {
+		operation = opt.name
+	}
+	if operation == "" {
+		operation = callerOperationName(2 + opt.callerSkip)
+	}
 
-	tracer := otel.Tracer(tracerName)
-	ctx, _ = tracer.Start(ctx, operation)
+	registry.declare(operation, opt)
+	stopWatch := watchLeak(operation)
 
-	r, err := newRecorder(operation)
-	if err != nil {
-		slog.Warn("failed to create metrics", slog.String("error", err.Error()))
-		return ctx, func(ctx *context.Context, err *error) {}
+	start := clock.Now()
+	budget, hasDeadline := deadlineBudget(ctx)
+	parent, nested := getStack(ctx)
+	parentCtx := ctx
+	ctx = initStack(ctx, operation, start, opt)
+
+	tel := telemetryFrom(ctx)
+	spanOpts := append(opt.spanOpts, trace.WithTimestamp(start))
+	ctx, _ = tel.tracerFor(opt.scope).Start(ctx, operation, spanOpts...)
+	if nested {
+		ctx = Register(ctx, Str("parent_operation", parent.Operation, LogOnly(), TraceOnly()))
+	}
+	ctx = registerBaggage(ctx, opt.baggage)
+	ctx = registerRequestID(ctx)
+	ctx = registerTenant(ctx)
+	ctx = Register(ctx, opt.attrs...)
+	call := Call{Name: operation, Kind: KindOperation, Start: start}
+	ctx = runBeforeHooks(ctx, call)
+
+	r, err := newRecorder(tel, operation)
+	switch {
+	case errors.Is(err, ErrMetricsNotInitialized):
+		tel.Logger.Debug("metrics are not initialized, skipping operation metrics")
+	case err != nil:
+		diagnostics.Report(ctx, "koko", "failed to create metrics", err, slog.String("operation", operation))
+	}
+
+	var slo *sloRecorder
+	if opt.objective != nil {
+		slo, err = newSLORecorder(tel, operation, *opt.objective)
+		if err != nil && !errors.Is(err, ErrMetricsNotInitialized) {
+			diagnostics.Report(ctx, "koko", "failed to create slo metrics", err, slog.String("operation", operation))
+		}
+	}
+
+	var derived *derivedState
+	if opt.derivedWindow > 0 || opt.inFlightLimit > 0 {
+		derived = startDerived(ctx, tel, operation, opt)
 	}
 
 	done := func(ctx *context.Context, err *error) {
-		stop := time.Since(start)
+		// recover only stops a panic when called by the deferred func itself
+		var p *Panic
+		if opt.recover != recoverNone {
+			if r := recover(); r != nil {
+				described := DescribePanic(r)
+				p = &described
+				*err = p.Err()
+
+				if opt.recover == recoverRepanic {
+					defer panic(r)
+				}
+			}
+		}
+
+		// pops the operation, so the caller continues within its parent
+		defer func() { *ctx = parentCtx }()
+
+		stop := clock.Since(start)
+		stopWatch()
+		if derived != nil {
+			derived.finish(stop, p != nil)
+		}
 
 		st, ok := pop(*ctx)
 		if !ok {
 			return
 		}
 
+		*ctx = Register(*ctx, throughputAttributes(st, stop)...)
+
+		var stack []byte
+		if p != nil {
+			stack = debug.Stack()
+			*ctx = Register(*ctx,
+				Str(PanicTypeKey, p.Type, LogOnly(), TraceOnly()),
+				Str(PanicMessageKey, p.Message, LogOnly(), TraceOnly()),
+				Str(PanicStackHashKey, p.StackHash, LogOnly(), TraceOnly()),
+				Str("stack", string(stack), LogOnly()),
+			)
+		}
+
+		added := st.Errors.list()
+		if len(added) > 0 {
+			*ctx = Register(*ctx, Int64("error_count", int64(len(added)), LogOnly(), TraceOnly()))
+		}
+
+		if hasDeadline {
+			*ctx = Register(*ctx, deadlineAttributes(budget, stop)...)
+		}
+
+		out := outcomeOf(*ctx, *err)
+		if out == outcomeCanceled {
+			*ctx = Register(*ctx, Bool("canceled", true, LogOnly(), TraceOnly()))
+			if cause := context.Cause(*ctx); cause != nil {
+				*ctx = Register(*ctx, Str("cancel_cause", cause.Error(), LogOnly(), TraceOnly()))
+			}
+		}
+		if out == outcomeFailure || out == outcomeExpected {
+			*ctx = Register(*ctx, Str("error_category", string(kerr.CategoryOf(*err))))
+		}
+		runAfterHooks(*ctx, call, *err, stop)
+
 		var level slog.Level
 		level, lerr := logs.ParseLevel(st.LogLevel)
 		if lerr != nil {
-			slog.Debug("failed to parse log level, using default",
+			tel.Logger.Debug("failed to parse log level, using default",
 				slog.String("log_level", strings.ToUpper(st.LogLevel)))
 			level = slog.LevelDebug
 		}
 
-		if *err != nil && slog.LevelWarn > level {
-			level = slog.LevelWarn
+		if *err != nil && out != outcomeExpected {
+			level = escalationPolicy(opt)(level, *err)
+		}
+		if p != nil {
+			level = max(level, slog.LevelError)
 		}
 
 		span := trace.SpanFromContext(*ctx)
-		span.SetStatus(codes.Error, "error encountered")
-
-		if *err == nil {
-			// OK > Error so this will overwrite the previous status
+		switch out {
+		case outcomeSuccess:
 			span.SetStatus(codes.Ok, "success")
+		case outcomeCanceled:
+			span.SetStatus(codes.Error, "canceled")
+		case outcomeExpected:
+			// expected errors are a response to the request, not a failure of
+			// the operation, so the status is left unset
+		default:
+			errType := ErrorType(*err)
+			if p != nil {
+				errType = p.Type
+			}
+			span.SetStatus(codes.Error, errType)
+			span.SetAttributes(attribute.String("error.type", errType))
 		}
 
 		attrs := []slog.Attr{
-			slog.Duration("duration", time.Since(start)),
+			slog.Duration("duration", clock.Since(start)),
 			slog.String("operation", operation),
 		}
-
 		for k, f := range st.Floats {
-			attrs = append(attrs, slog.Float64(k, f))
-			r.AddLabels(metrics.WithLabel(k, fmt.Sprint(f)))
+			if st.sends(k, toLogs) {
+				attrs = append(attrs, slog.Float64(k, f))
+			}
 		}
 		for k, i := range st.Ints {
-			attrs = append(attrs, slog.Int64(k, i))
-			r.AddLabels(metrics.WithLabel(k, fmt.Sprint(i)))
+			if st.sends(k, toLogs) {
+				attrs = append(attrs, slog.Int64(k, i))
+			}
 		}
 		for k, s := range st.Strs {
-			attrs = append(attrs, slog.String(k, s))
-			r.AddLabels(metrics.WithLabel(k, s))
+			if st.sends(k, toLogs) {
+				attrs = append(attrs, slog.String(k, s))
+			}
 		}
 		for k, b := range st.Bools {
-			attrs = append(attrs, slog.Bool(k, b))
-			r.AddLabels(metrics.WithLabel(k, fmt.Sprint(b)))
+			if st.sends(k, toLogs) {
+				attrs = append(attrs, slog.Bool(k, b))
+			}
 		}
+		labels := st.metricLabels(span.SpanContext().IsSampled())
 
 		if *err != nil {
 			attrs = append(attrs, slog.String("error", (*err).Error()))
 			span.RecordError(*err)
 		}
 
-		slog.LogAttrs(*ctx, level, operation, attrs...)
-		span.End()
+		if len(added) > 0 {
+			attrs = append(attrs, slog.String("errors", errors.Join(added...).Error()))
+			for _, e := range added {
+				span.RecordError(e)
+			}
+		}
+
+		registry.observe(operation, st)
+
+		if out == outcomeFailure {
+			ReportError(*ctx, ErrorReport{
+				Operation: operation,
+				Err:       *err,
+				Stack:     stack,
+				Attrs:     st.attrs(),
+				Panic:     p != nil,
+			})
+		}
 
-		rerr := r.Record(*ctx, stop, *err == nil)
-		if rerr != nil {
-			slog.Debug("failed to record metrics for operation",
-				slog.String("operation", operation))
+		span.End(trace.WithTimestamp(start.Add(stop)))
+
+		// the log and metrics are all that is left, which are completed in the
+		// background when the operation is asynchronous
+		complete := func(ctx context.Context) {
+			tel.Logger.LogAttrs(ctx, level, operation, attrs...)
+
+			if slo != nil {
+				rerr := slo.Record(ctx, stop, out == outcomeSuccess || out == outcomeExpected, labels...)
+				if rerr != nil {
+					diagnostics.Report(ctx, "koko", "failed to record slo metrics for operation", rerr,
+						slog.String("operation", operation))
+				}
+			}
+
+			if p != nil {
+				recordPanic(ctx, tel, operation, *p, labels...)
+			}
+
+			if r == nil {
+				return
+			}
+
+			rerr := r.Record(ctx, stop, out, labels...)
+			if rerr != nil {
+				diagnostics.Report(ctx, "koko", "failed to record metrics for operation", rerr,
+					slog.String("operation", operation))
+			}
 		}
+
+		if !opt.async {
+			complete(*ctx)
+			return
+		}
+
+		completeCtx := context.WithoutCancel(*ctx)
+		completeAsync(completeCtx, opt.asyncPolicy, func() { complete(completeCtx) })
 	}
 
 	return ctx, done
 }
 
-func getCallerName() string {
-	pc, _, _, ok := runtime.Caller(2)
+// callerName returns the name of the function skip frames above it
+func callerName(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip)
 	if !ok {
 		return "span"
 	}
@@ -208,12 +428,16 @@ func getCallerName() string {
 }
 
 // Pure will initiate a new span that cannot encounter an error during
-// operation
-func Pure(ctx context.Context) (context.Context, NoErrDone) {
-	tracer := otel.Tracer(tracerName)
-	ctx, span := tracer.Start(ctx, getCallerName())
+// operation. The span is named after the calling function unless WithName is
+// provided.
+//
+// Attributes registered within it are set on its span without reaching the
+// operation it is part of, which they are inherited from.
+func Pure(ctx context.Context, opts ...OperationOption) (context.Context, NoErrDone) {
+	ctx, span, call := startSpan(ctx, KindPure, opts)
 
 	done := func(ctx *context.Context) {
+		runAfterHooks(*ctx, call, nil, clock.Since(call.Start))
 		span.SetStatus(codes.Ok, "success")
 		span.End()
 	}
@@ -222,16 +446,18 @@ func Pure(ctx context.Context) (context.Context, NoErrDone) {
 }
 
 // Impure will initiate a new span that can encounter an error during
-// operation
-func Impure(ctx context.Context) (context.Context, Done) {
-	tracer := otel.Tracer(tracerName)
-	ctx, span := tracer.Start(ctx, getCallerName())
+// operation. The span is named and carries attributes like that of Pure.
+func Impure(ctx context.Context, opts ...OperationOption) (context.Context, Done) {
+	ctx, span, call := startSpan(ctx, KindImpure, opts)
 
 	done := func(ctx *context.Context, err *error) {
+		runAfterHooks(*ctx, call, *err, clock.Since(call.Start))
 		if *err == nil {
 			span.SetStatus(codes.Ok, "success")
 		} else {
-			span.SetStatus(codes.Error, "error encountered")
+			errType := ErrorType(*err)
+			span.SetStatus(codes.Error, errType)
+			span.SetAttributes(attribute.String("error.type", errType))
 			span.RecordError(*err)
 		}
 		span.End()
@@ -239,3 +465,32 @@ func Impure(ctx context.Context) (context.Context, Done) {
 
 	return ctx, done
 }
+
+// startSpan starts the span of Pure or Impure along with its own attribute
+// stack, a copy of the stack of the operation it is part of, and runs the
+// hooks before it
+func startSpan(ctx context.Context, kind CallKind, opts []OperationOption) (context.Context, trace.Span, Call) {
+	opt := operationOpts{}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	name := opt.name
+	if name == "" {
+		// skips callerName, startSpan, and Pure or Impure
+		name = callerName(3 + opt.callerSkip)
+	}
+
+	call := Call{Name: name, Kind: kind, Start: clock.Now()}
+	if st, ok := getStack(ctx); ok {
+		ctx = saveStack(ctx, st.clone())
+	} else {
+		ctx = initStack(ctx, name, call.Start, opt)
+	}
+
+	ctx, span := telemetryFrom(ctx).tracerFor(opt.scope).Start(ctx, name, opt.spanOpts...)
+	ctx = Register(ctx, opt.attrs...)
+	ctx = runBeforeHooks(ctx, call)
+
+	return ctx, span, call
+}
@@ -0,0 +1,40 @@
+package koko
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/kzs0/kokoro/kerr"
+)
+
+func TestOutcomeOf(t *testing.T) {
+	cause := errors.New("client went away")
+
+	canceled, cancel := context.WithCancelCause(context.Background())
+	cancel(cause)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want outcome
+	}{
+		{"nil", context.Background(), nil, outcomeSuccess},
+		{"canceled", context.Background(), context.Canceled, outcomeCanceled},
+		{"wrapped deadline", context.Background(), fmt.Errorf("query: %w", context.DeadlineExceeded), outcomeCanceled},
+		{"cause", canceled, fmt.Errorf("send: %w", cause), outcomeCanceled},
+		{"unrelated on canceled context", canceled, errors.New("boom"), outcomeFailure},
+		{"expected", context.Background(), kerr.New(kerr.NotFound, "no such user"), outcomeExpected},
+		{"failure", context.Background(), errors.New("boom"), outcomeFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := outcomeOf(tt.ctx, tt.err); got != tt.want {
+				t.Errorf("outcomeOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package koko
+
+import (
+	"time"
+
+	"github.com/kzs0/kokoro/telemetry/traces"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type operationOpts struct {
+	name        string
+	spanOpts    []trace.SpanStartOption
+	objective   *objective
+	description string
+	labels      []string
+	baggage     []string
+	escalation  EscalationPolicy
+	level       string
+	attrs       []Attribute
+	recover     recoverMode
+	async       bool
+	scope       *instrumentationScope
+	asyncPolicy AsyncPolicy
+
+	derivedWindow time.Duration
+	inFlightLimit int
+
+	throughputHistograms bool
+	callerSkip           int
+}
+
+type OperationOption func(*operationOpts)
+
+// WithDescription describes what the operation does. The description is
+// published in the operation registry.
+func WithDescription(desc string) OperationOption {
+	return func(opts *operationOpts) {
+		opts.description = desc
+	}
+}
+
+// WithName names the span of Pure and Impure instead of naming it after the
+// calling function, and operations started without a name
+func WithName(name string) OperationOption {
+	return func(opts *operationOpts) {
+		opts.name = name
+	}
+}
+
+// WithAttributes registers attributes as soon as the operation, Pure, or
+// Impure span starts, see Register
+func WithAttributes(attrs ...Attribute) OperationOption {
+	return func(opts *operationOpts) {
+		opts.attrs = append(opts.attrs, attrs...)
+	}
+}
+
+// WithLabels declares the labels the operation is expected to report. The
+// labels are published in the operation registry.
+func WithLabels(labels ...string) OperationOption {
+	return func(opts *operationOpts) {
+		opts.labels = append(opts.labels, labels...)
+	}
+}
+
+// WithObjective declares a service level objective for the operation.
+//
+// An operation conforms to the objective when it succeeds within the latency
+// provided. The target is the ratio of operations expected to conform, e.g.
+// 0.999 for three nines.
+func WithObjective(latency time.Duration, target float64) OperationOption {
+	return func(opts *operationOpts) {
+		opts.objective = &objective{
+			latency: latency,
+			target:  target,
+		}
+	}
+}
+
+// WithLevel sets the level the operation is logged at on completion, e.g.
+// "INFO". The level can be changed while the operation is running with Level.
+func WithLevel(level string) OperationOption {
+	return func(opts *operationOpts) {
+		opts.level = level
+	}
+}
+
+// WithCallerSkip skips additional stack frames when an unnamed operation is
+// named after its caller, allowing Operation to be wrapped
+func WithCallerSkip(skip int) OperationOption {
+	return func(opts *operationOpts) {
+		opts.callerSkip += skip
+	}
+}
+
+// WithAlwaysSample requests that the operation is traced even when the
+// configured sampler would drop it, so critical low volume operations are
+// always visible
+func WithAlwaysSample() OperationOption {
+	return withSpanOptions(trace.WithAttributes(traces.SamplingHintKey.String(traces.SamplingHintAlways)))
+}
+
+// WithNeverSample requests that the operation is not traced
+func WithNeverSample() OperationOption {
+	return withSpanOptions(trace.WithAttributes(traces.SamplingHintKey.String(traces.SamplingHintNever)))
+}
+
+func withSpanOptions(spanOpts ...trace.SpanStartOption) OperationOption {
+	return func(opts *operationOpts) {
+		opts.spanOpts = append(opts.spanOpts, spanOpts...)
+	}
+}
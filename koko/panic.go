@@ -0,0 +1,128 @@
+package koko
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Attribute keys describing a recovered panic on logs and spans
+const (
+	PanicTypeKey      = "panic.type"
+	PanicMessageKey   = "panic.message"
+	PanicStackHashKey = "panic.stack_hash"
+)
+
+// stackHashLength is the number of hex characters kept of the stack hash
+const stackHashLength = 16
+
+// Panic describes a value recovered from a panic
+type Panic struct {
+	Value any
+	// Type is the type of the value, e.g. runtime.boundsError or string.
+	// Errors report their error type when one can be derived, see ErrorType.
+	Type    string
+	Message string
+	// StackHash identifies the code path that panicked, grouping panics of
+	// the same location across goroutines and processes
+	StackHash string
+}
+
+// DescribePanic describes the value returned by recover. It must be called
+// from the deferred func that recovered, while the stack of the panic is
+// still in place, for the stack hash to identify where the panic happened.
+func DescribePanic(r any) Panic {
+	p := Panic{
+		Value:     r,
+		StackHash: panicStackHash(),
+	}
+
+	var rerr runtime.Error
+	switch v := r.(type) {
+	case error:
+		p.Message = v.Error()
+		switch {
+		case errors.As(v, &rerr):
+			p.Type = reflect.TypeOf(rerr).String()
+		case ErrorType(v) != otherErrorType:
+			p.Type = ErrorType(v)
+		default:
+			p.Type = reflect.TypeOf(v).String()
+		}
+	case string:
+		p.Type = "string"
+		p.Message = v
+	default:
+		p.Type = fmt.Sprintf("%T", v)
+		p.Message = fmt.Sprint(v)
+	}
+
+	return p
+}
+
+// Err returns the panic as an error, wrapping the value when it is one so it
+// can be matched with errors.Is and errors.As
+func (p Panic) Err() error {
+	if err, ok := p.Value.(error); ok {
+		return fmt.Errorf("panic: %w", err)
+	}
+
+	return fmt.Errorf("panic: %s", p.Message)
+}
+
+// Attrs returns the attributes describing the panic for logs
+func (p Panic) Attrs() []slog.Attr {
+	return []slog.Attr{
+		slog.String(PanicTypeKey, p.Type),
+		slog.String(PanicMessageKey, p.Message),
+		slog.String(PanicStackHashKey, p.StackHash),
+	}
+}
+
+// KeyValues returns the attributes describing the panic for spans
+func (p Panic) KeyValues() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String(PanicTypeKey, p.Type),
+		attribute.String(PanicMessageKey, p.Message),
+		attribute.String(PanicStackHashKey, p.StackHash),
+	}
+}
+
+// panicStackHash hashes the functions and lines of the goroutine's stack
+// from the frame that panicked, leaving out the runtime and the frames
+// recovering, which differ with where the panic is recovered. Outside of a
+// panic, the whole stack of the caller is hashed.
+func panicStackHash() string {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var b strings.Builder
+	for {
+		frame, more := frames.Next()
+		if frame.Function == "runtime.gopanic" {
+			// frames written so far are the ones recovering
+			b.Reset()
+		} else if !strings.HasPrefix(frame.Function, "runtime.") {
+			b.WriteString(frame.Function)
+			b.WriteByte(':')
+			b.WriteString(strconv.Itoa(frame.Line))
+			b.WriteByte('\n')
+		}
+
+		if !more {
+			break
+		}
+	}
+
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])[:stackHashLength]
+}
@@ -0,0 +1,119 @@
+package koko
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kzs0/kokoro/diagnostics"
+	"github.com/kzs0/kokoro/internal/clock"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+type channelOpts struct {
+	interval time.Duration
+}
+
+type ChannelOption func(*channelOpts)
+
+// WithSampleInterval sets how often the channel depth is sampled, defaults to
+// every 10 seconds, which a non-positive interval keeps
+func WithSampleInterval(interval time.Duration) ChannelOption {
+	return func(opts *channelOpts) {
+		if interval > 0 {
+			opts.interval = interval
+		}
+	}
+}
+
+// InstrumentChannel will periodically report the depth and capacity of the
+// channel in the <name>_queue_depth and <name>_queue_capacity gauges until the
+// returned stop func is called.
+func InstrumentChannel[T any](name string, ch <-chan T, opts ...ChannelOption) (func(), error) {
+	opt := channelOpts{interval: 10 * time.Second}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	depth, err := Gauge(fmt.Sprintf("%s_queue_depth", name),
+		metrics.WithDescription("number of elements queued in the channel"))
+	if err != nil {
+		return nil, err
+	}
+
+	capacity, err := Gauge(fmt.Sprintf("%s_queue_capacity", name),
+		metrics.WithDescription("capacity of the channel"))
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sample := func() {
+		err := depth.Measure(ctx, float64(len(ch)))
+		if err == nil {
+			err = capacity.Measure(ctx, float64(cap(ch)))
+		}
+		if err != nil {
+			diagnostics.Report(ctx, "koko", "failed to sample channel", err, slog.String("queue", name))
+		}
+	}
+
+	go func() {
+		ticker := clock.NewTicker(opt.interval)
+		defer ticker.Stop()
+
+		sample()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+				sample()
+			}
+		}
+	}()
+
+	return cancel, nil
+}
+
+// LagRecorder observes how far behind a consumer is by comparing the time an
+// event was produced against the time it is consumed
+type LagRecorder[T any] struct {
+	timer     metrics.Histogram
+	unit      DurationUnit
+	timestamp func(T) time.Time
+}
+
+// NewLagRecorder creates a LagRecorder observing the consumer lag of events in
+// the <name>_lag_millis histogram, or <name>_lag_seconds when durations are
+// recorded in seconds, see SetDurationUnit. The timestamp func returns the time
+// an event was produced.
+func NewLagRecorder[T any](name string, timestamp func(T) time.Time) (*LagRecorder[T], error) {
+	unit := currentDurationUnit()
+	timerOpts := append([]metrics.MetricOption{
+		metrics.WithDescription(fmt.Sprintf("time between an event being produced and consumed in %s", unit.long())),
+	}, unit.timerOptions()...)
+
+	timer, err := Histogram(fmt.Sprintf("%s_lag_%s", name, unit), timerOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LagRecorder[T]{
+		timer:     timer,
+		unit:      unit,
+		timestamp: timestamp,
+	}, nil
+}
+
+// Record observes the lag of the event being consumed now
+func (l *LagRecorder[T]) Record(ctx context.Context, event T, opts ...metrics.MeasurementOption) error {
+	lag := clock.Since(l.timestamp(event))
+	if lag < 0 {
+		lag = 0
+	}
+
+	return l.timer.Record(ctx, l.unit.measure(lag), opts...)
+}
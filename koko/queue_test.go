@@ -0,0 +1,67 @@
+package koko_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/kokoro/kokotest"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestLagRecorderUnit(t *testing.T) {
+	tests := []struct {
+		unit     koko.DurationUnit
+		wantName string
+		wantSum  float64
+	}{
+		{koko.Millis, "orders_lag_millis", 1500},
+		{koko.Seconds, "orders_lag_seconds", 1.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.unit), func(t *testing.T) {
+			if err := koko.SetDurationUnit(tt.unit); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = koko.SetDurationUnit("") })
+
+			tel := kokotest.Capture(t)
+			clk := kokotest.NewClock(t)
+
+			lag, err := koko.NewLagRecorder("orders", func(produced time.Time) time.Time { return produced })
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = lag.Record(context.Background(), clk.Now().Add(-1500*time.Millisecond))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := histogramSum(tel.Metrics(t), tel.Name(tt.wantName)); got != tt.wantSum {
+				t.Errorf("%s sum = %v, want %v", tt.wantName, got, tt.wantSum)
+			}
+		})
+	}
+}
+
+// histogramSum returns the sum of every data point of the histogram name
+func histogramSum(rm metricdata.ResourceMetrics, name string) float64 {
+	var sum float64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			h, ok := m.Data.(metricdata.Histogram[float64])
+			if m.Name != name || !ok {
+				continue
+			}
+
+			for _, dp := range h.DataPoints {
+				sum += dp.Sum
+			}
+		}
+	}
+
+	return sum
+}
@@ -0,0 +1,72 @@
+package koko
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/kzs0/kokoro/diagnostics"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+type recoverMode int
+
+const (
+	recoverNone recoverMode = iota
+	recoverReturn
+	recoverRepanic
+)
+
+// WithRecover makes done recover a panic of the operation, which must defer
+// done directly. The panic is reported as the failure of the operation: the
+// span ends in error with the panic.type, panic.message, and panic.stack_hash
+// attributes, the stack is logged, the <operation>_panics counter is
+// incremented, and error reporters receive it. The panic then becomes the
+// error of the operation, returned when err is a named result:
+//
+//	func charge(ctx context.Context) (err error) {
+//		ctx, done := koko.Operation(ctx, "charge", koko.WithRecover())
+//		defer done(&ctx, &err)
+//		...
+//	}
+func WithRecover() OperationOption {
+	return func(opts *operationOpts) {
+		opts.recover = recoverReturn
+	}
+}
+
+// WithRepanic reports a panic of the operation like WithRecover, then panics
+// again with the same value so it keeps unwinding, e.g. up to kokoro.Recover
+func WithRepanic() OperationOption {
+	return func(opts *operationOpts) {
+		opts.recover = recoverRepanic
+	}
+}
+
+// recordPanic increments the <operation>_panics counter, labeled with the
+// type of the panic along with the labels of the operation
+func recordPanic(ctx context.Context, tel Telemetry, operation string, p Panic, labels ...metrics.MeasurementOption) {
+	name, naming := OperationMetric(operation, "panics")
+
+	counter, err := tel.counter(name,
+		metrics.WithDescription("panics recovered by the operation"),
+		metrics.WithAnyLabels(),
+	)
+	if err != nil {
+		if !errors.Is(err, ErrMetricsNotInitialized) {
+			diagnostics.Report(ctx, "koko", "failed to create metrics", err, slog.String("operation", operation))
+		}
+		return
+	}
+
+	opts := append([]metrics.MeasurementOption{metrics.WithLabel("panic_type", p.Type)}, labels...)
+	for k, v := range naming {
+		opts = append(opts, metrics.WithLabel(k, v))
+	}
+
+	err = counter.Incr(ctx, opts...)
+	if err != nil {
+		diagnostics.Report(ctx, "koko", "failed to record metrics for operation", err,
+			slog.String("operation", operation))
+	}
+}
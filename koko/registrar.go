@@ -9,23 +9,99 @@ import (
 
 type Attribute func(context.Context) context.Context
 
-func Str(k, s string) Attribute {
+// destination is a set of the signals an attribute is reported to
+type destination uint8
+
+const (
+	toLogs destination = 1 << iota
+	toTraces
+	toMetrics
+	// onlySampled restricts the metric label to operations whose trace is
+	// sampled, it is not a destination of its own
+	onlySampled
+
+	toAll = toLogs | toTraces | toMetrics
+)
+
+type attributeOpts struct {
+	dest destination
+}
+
+type AttributeOption func(*attributeOpts)
+
+// LogOnly will report the attribute in the operation log.
+//
+// Destination options can be combined, e.g. LogOnly() and TraceOnly() will
+// keep a high cardinality identifier out of metric labels. When no destination
+// is provided the attribute is reported everywhere.
+func LogOnly() AttributeOption {
+	return func(opts *attributeOpts) {
+		opts.dest |= toLogs
+	}
+}
+
+// TraceOnly will report the attribute on the operation span.
+func TraceOnly() AttributeOption {
+	return func(opts *attributeOpts) {
+		opts.dest |= toTraces
+	}
+}
+
+// MetricLabel will report the attribute as a label on the operation metrics.
+func MetricLabel() AttributeOption {
+	return func(opts *attributeOpts) {
+		opts.dest |= toMetrics
+	}
+}
+
+// SampledOnly reports the attribute as a metric label only on operations
+// whose trace is sampled, the metrics of other operations are recorded with
+// the rest of their labels. High cardinality labels such as a user ID can then
+// be kept on a sample of the series, so totals stay exact across labels.
+// Other destinations are unaffected, it can be combined with them, e.g.
+// SampledOnly() and MetricLabel() only report a metric label.
+func SampledOnly() AttributeOption {
+	return func(opts *attributeOpts) {
+		opts.dest |= onlySampled
+	}
+}
+
+func destinationOf(opts []AttributeOption) destination {
+	opt := attributeOpts{}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	if opt.dest&^onlySampled == 0 {
+		return toAll | opt.dest
+	}
+
+	return opt.dest
+}
+
+// Str registers a string attribute, whose value is rewritten by the sanitizer
+// first, see SetSanitizer
+func Str(k, s string, opts ...AttributeOption) Attribute {
 	return func(ctx context.Context) context.Context {
 		st, ok := getStack(ctx)
 		if !ok {
 			return ctx
 		}
 
+		s := sanitize(k, s)
 		st.Strs[k] = s
+		st.Dests[k] = destinationOf(opts)
 
-		span := trace.SpanFromContext(ctx)
-		span.SetAttributes(attribute.String(k, s))
+		if st.sends(k, toTraces) {
+			span := trace.SpanFromContext(ctx)
+			span.SetAttributes(attribute.String(k, s))
+		}
 
 		return saveStack(ctx, st)
 	}
 }
 
-func Bool(k string, b bool) Attribute {
+func Bool(k string, b bool, opts ...AttributeOption) Attribute {
 	return func(ctx context.Context) context.Context {
 		st, ok := getStack(ctx)
 		if !ok {
@@ -33,15 +109,18 @@ func Bool(k string, b bool) Attribute {
 		}
 
 		st.Bools[k] = b
+		st.Dests[k] = destinationOf(opts)
 
-		span := trace.SpanFromContext(ctx)
-		span.SetAttributes(attribute.Bool(k, b))
+		if st.sends(k, toTraces) {
+			span := trace.SpanFromContext(ctx)
+			span.SetAttributes(attribute.Bool(k, b))
+		}
 
 		return saveStack(ctx, st)
 	}
 }
 
-func intAttr(k string, i int64) Attribute {
+func intAttr(k string, i int64, opts []AttributeOption) Attribute {
 	return func(ctx context.Context) context.Context {
 		st, ok := getStack(ctx)
 		if !ok {
@@ -49,42 +128,45 @@ func intAttr(k string, i int64) Attribute {
 		}
 
 		st.Ints[k] = i
+		st.Dests[k] = destinationOf(opts)
 
-		span := trace.SpanFromContext(ctx)
-		span.SetAttributes(attribute.Int64(k, i))
+		if st.sends(k, toTraces) {
+			span := trace.SpanFromContext(ctx)
+			span.SetAttributes(attribute.Int64(k, i))
+		}
 
 		return saveStack(ctx, st)
 	}
 }
 
-func Uint8(k string, u uint8) Attribute {
-	return intAttr(k, int64(u))
+func Uint8(k string, u uint8, opts ...AttributeOption) Attribute {
+	return intAttr(k, int64(u), opts)
 }
 
-func Uint16(k string, u uint16) Attribute {
-	return intAttr(k, int64(u))
+func Uint16(k string, u uint16, opts ...AttributeOption) Attribute {
+	return intAttr(k, int64(u), opts)
 }
 
-func Uint32(k string, u uint32) Attribute {
-	return intAttr(k, int64(u))
+func Uint32(k string, u uint32, opts ...AttributeOption) Attribute {
+	return intAttr(k, int64(u), opts)
 }
-func Int8(k string, i int8) Attribute {
-	return intAttr(k, int64(i))
+func Int8(k string, i int8, opts ...AttributeOption) Attribute {
+	return intAttr(k, int64(i), opts)
 }
 
-func Int16(k string, i int16) Attribute {
-	return intAttr(k, int64(i))
+func Int16(k string, i int16, opts ...AttributeOption) Attribute {
+	return intAttr(k, int64(i), opts)
 }
 
-func Int32(k string, i int32) Attribute {
-	return intAttr(k, int64(i))
+func Int32(k string, i int32, opts ...AttributeOption) Attribute {
+	return intAttr(k, int64(i), opts)
 }
 
-func Int64(k string, i int64) Attribute {
-	return intAttr(k, i)
+func Int64(k string, i int64, opts ...AttributeOption) Attribute {
+	return intAttr(k, i, opts)
 }
 
-func floatAttr(k string, f float64) Attribute {
+func floatAttr(k string, f float64, opts []AttributeOption) Attribute {
 	return func(ctx context.Context) context.Context {
 		st, ok := getStack(ctx)
 		if !ok {
@@ -92,20 +174,46 @@ func floatAttr(k string, f float64) Attribute {
 		}
 
 		st.Floats[k] = f
+		st.Dests[k] = destinationOf(opts)
 
-		span := trace.SpanFromContext(ctx)
-		span.SetAttributes(attribute.Float64(k, f))
+		if st.sends(k, toTraces) {
+			span := trace.SpanFromContext(ctx)
+			span.SetAttributes(attribute.Float64(k, f))
+		}
 
 		return saveStack(ctx, st)
 	}
 }
 
-func Float32(k string, f float32) Attribute {
-	return floatAttr(k, float64(f))
+func Float32(k string, f float32, opts ...AttributeOption) Attribute {
+	return floatAttr(k, float64(f), opts)
+}
+
+func Float64(k string, f float64, opts ...AttributeOption) Attribute {
+	return floatAttr(k, f, opts)
 }
 
-func Float64(k string, f float64) Attribute {
-	return floatAttr(k, f)
+// SetLogLevel changes the level the operation of ctx is logged at on
+// completion, e.g. "WARN" to surface a single suspicious call, without
+// changing the level of any other operation. It is the same as registering
+// Level.
+func SetLogLevel(ctx context.Context, level string) context.Context {
+	return Register(ctx, Level(level))
+}
+
+// Level sets the level the operation is logged at on completion, e.g. "INFO".
+// Operations are logged at DEBUG by default.
+func Level(level string) Attribute {
+	return func(ctx context.Context) context.Context {
+		st, ok := getStack(ctx)
+		if !ok {
+			return ctx
+		}
+
+		st.LogLevel = level
+
+		return saveStack(ctx, st)
+	}
 }
 
 func Register(ctx context.Context, attrs ...Attribute) context.Context {
@@ -115,3 +223,49 @@ func Register(ctx context.Context, attrs ...Attribute) context.Context {
 
 	return ctx
 }
+
+// Unregister will remove the attributes registered under the provided keys so
+// they are not reported by the operation.
+//
+// Attributes already set on the span are not removed.
+func Unregister(ctx context.Context, keys ...string) context.Context {
+	st, ok := getStack(ctx)
+	if !ok {
+		return ctx
+	}
+
+	for _, k := range keys {
+		st.remove(k)
+	}
+
+	return saveStack(ctx, st)
+}
+
+// Scoped will register attributes that are removed when the returned release
+// func is called. Any attribute shadowed by a scoped attribute is restored on
+// release.
+//
+// This keeps loop-local or sensitive values from leaking into later telemetry
+// within the same operation.
+func Scoped(ctx context.Context, attrs ...Attribute) (context.Context, func()) {
+	st, ok := getStack(ctx)
+	if !ok {
+		return ctx, func() {}
+	}
+
+	before := st.clone()
+	ctx = Register(ctx, attrs...)
+	scoped := st.changedSince(before)
+
+	release := func() {
+		for _, k := range scoped {
+			if before.has(k) {
+				st.restore(k, before)
+				continue
+			}
+			st.remove(k)
+		}
+	}
+
+	return ctx, release
+}
@@ -0,0 +1,158 @@
+package koko
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OperationInfo describes an operation known to the process
+type OperationInfo struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Labels      []string       `json:"labels,omitempty"`
+	Objective   *ObjectiveInfo `json:"objective,omitempty"`
+}
+
+// ObjectiveInfo describes the service level objective of an operation
+type ObjectiveInfo struct {
+	Latency time.Duration `json:"latency"`
+	Target  float64       `json:"target"`
+}
+
+type operationEntry struct {
+	description string
+	labels      map[string]struct{}
+	objective   *objective
+	buckets     []float64
+}
+
+type operationRegistry struct {
+	mu         sync.RWMutex
+	operations map[string]*operationEntry
+}
+
+var registry = &operationRegistry{
+	operations: make(map[string]*operationEntry),
+}
+
+func (r *operationRegistry) entry(name string) *operationEntry {
+	e, ok := r.operations[name]
+	if !ok {
+		e = &operationEntry{labels: make(map[string]struct{})}
+		r.operations[name] = e
+	}
+
+	return e
+}
+
+// declare will record the metadata an operation was started with
+func (r *operationRegistry) declare(name string, opts operationOpts) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e := r.entry(name)
+	if opts.description != "" {
+		e.description = opts.description
+	}
+	if opts.objective != nil {
+		e.objective = opts.objective
+	}
+	for _, l := range opts.labels {
+		e.labels[l] = struct{}{}
+	}
+}
+
+// SetOperationBuckets overrides the bucket boundaries of the duration
+// histogram of an operation, in the unit set with SetDurationUnit. The
+// boundaries apply when the histogram is first created, so they should be set
+// before the operation is started, and operations sharing their metrics, see
+// SetMetricNameTemplate, share the boundaries of the first one started.
+// Setting no boundaries restores the defaults.
+func SetOperationBuckets(operation string, buckets ...float64) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	registry.entry(operation).buckets = buckets
+}
+
+func (r *operationRegistry) buckets(name string) []float64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	e, ok := r.operations[name]
+	if !ok {
+		return nil
+	}
+
+	return e.buckets
+}
+
+// observe will record the metric labels an operation reported on completion
+func (r *operationRegistry) observe(name string, st stack) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e := r.entry(name)
+	for k := range st.Dests {
+		if st.sends(k, toMetrics) {
+			e.labels[k] = struct{}{}
+		}
+	}
+}
+
+func (r *operationRegistry) list() []OperationInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	infos := make([]OperationInfo, 0, len(r.operations))
+	for name, e := range r.operations {
+		info := OperationInfo{
+			Name:        name,
+			Description: e.description,
+			Labels:      make([]string, 0, len(e.labels)),
+		}
+
+		for l := range e.labels {
+			info.Labels = append(info.Labels, l)
+		}
+		sort.Strings(info.Labels)
+
+		if e.objective != nil {
+			info.Objective = &ObjectiveInfo{
+				Latency: e.objective.latency,
+				Target:  e.objective.target,
+			}
+		}
+
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+
+	return infos
+}
+
+// Operations returns every operation started by the process along with its
+// declared metadata and the labels it has reported, sorted by name
+func Operations() []OperationInfo {
+	return registry.list()
+}
+
+// OperationsHandler serves the operation registry as JSON so dashboards and
+// alert generators can enumerate what the service measures
+func OperationsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		err := json.NewEncoder(w).Encode(Operations())
+		if err != nil {
+			slog.Debug("failed to write operation registry", slog.String("error", err.Error()))
+		}
+	})
+}
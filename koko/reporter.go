@@ -0,0 +1,104 @@
+package koko
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"runtime/debug"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrorReport describes a failure sent to error reporters
+type ErrorReport struct {
+	// Operation is the name of the failed operation, empty for panics
+	// recovered outside of an operation
+	Operation string
+	Err       error
+	Stack     []byte
+	Attrs     []slog.Attr
+	TraceID   string
+	SpanID    string
+	Panic     bool
+}
+
+// ErrorReporter receives every operation failure and recovered panic, allowing
+// integration with services such as Sentry, Bugsnag, or Rollbar
+type ErrorReporter interface {
+	Report(ctx context.Context, report ErrorReport)
+}
+
+var reporters struct {
+	mu        sync.RWMutex
+	reporters []ErrorReporter
+}
+
+// AddErrorReporter registers reporters that are sent every operation failure.
+// Canceled operations are not reported.
+func AddErrorReporter(rs ...ErrorReporter) {
+	reporters.mu.Lock()
+	defer reporters.mu.Unlock()
+
+	reporters.reporters = append(reporters.reporters, rs...)
+}
+
+// RemoveErrorReporter unregisters reporters added by AddErrorReporter.
+// Reporters whose type can't be compared, e.g. structs holding a slice, are
+// never removed.
+func RemoveErrorReporter(rs ...ErrorReporter) {
+	reporters.mu.Lock()
+	defer reporters.mu.Unlock()
+
+	kept := make([]ErrorReporter, 0, len(reporters.reporters))
+	for _, r := range reporters.reporters {
+		if !containsReporter(rs, r) {
+			kept = append(kept, r)
+		}
+	}
+
+	reporters.reporters = kept
+}
+
+// containsReporter reports whether r is in rs, skipping reporters that can't
+// be compared
+func containsReporter(rs []ErrorReporter, r ErrorReporter) bool {
+	if r == nil || !reflect.TypeOf(r).Comparable() {
+		return false
+	}
+
+	for _, candidate := range rs {
+		if candidate != nil && reflect.TypeOf(candidate) == reflect.TypeOf(r) && candidate == r {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ReportError sends the report to every registered reporter, filling in the
+// trace and span IDs from ctx and the current stack when they are missing
+func ReportError(ctx context.Context, report ErrorReport) {
+	reporters.mu.RLock()
+	rs := reporters.reporters
+	reporters.mu.RUnlock()
+
+	if len(rs) == 0 {
+		return
+	}
+
+	sc := trace.SpanContextFromContext(ctx)
+	if report.TraceID == "" && sc.HasTraceID() {
+		report.TraceID = sc.TraceID().String()
+	}
+	if report.SpanID == "" && sc.HasSpanID() {
+		report.SpanID = sc.SpanID().String()
+	}
+	if report.Stack == nil {
+		report.Stack = debug.Stack()
+	}
+
+	for _, r := range rs {
+		r.Report(ctx, report)
+	}
+}
@@ -0,0 +1,79 @@
+package koko
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"go.opentelemetry.io/otel/baggage"
+)
+
+// RequestIDKey is the baggage member and attribute the request ID is stored
+// as
+const RequestIDKey = "request_id"
+
+// maxRequestIDLength bounds request IDs accepted from callers
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestID returns the request ID of ctx, generating one and storing it in
+// the returned context when ctx has none. The ID is propagated to other
+// services as baggage and registered as an attribute of every operation, on
+// logs and traces only.
+func RequestID(ctx context.Context) (context.Context, string) {
+	if id := requestIDFrom(ctx); id != "" {
+		return ctx, id
+	}
+
+	id := newRequestID()
+
+	return WithRequestID(ctx, id), id
+}
+
+// WithRequestID returns a context carrying id as its request ID, e.g. one
+// received from the caller. IDs longer than 128 bytes are truncated.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	if len(id) > maxRequestIDLength {
+		id = id[:maxRequestIDLength]
+	}
+
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+
+	m, err := baggage.NewMemberRaw(RequestIDKey, id)
+	if err != nil {
+		return ctx
+	}
+
+	bag, err := baggage.FromContext(ctx).SetMember(m)
+	if err != nil {
+		return ctx
+	}
+
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+// requestIDFrom returns the request ID set on ctx, or received as baggage
+func requestIDFrom(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		return id
+	}
+
+	return baggage.FromContext(ctx).Member(RequestIDKey).Value()
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+func registerRequestID(ctx context.Context) context.Context {
+	id := requestIDFrom(ctx)
+	if id == "" {
+		return ctx
+	}
+
+	return Register(ctx, Str(RequestIDKey, id, LogOnly(), TraceOnly()))
+}
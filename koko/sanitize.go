@@ -0,0 +1,224 @@
+package koko
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	idPlaceholder    = "{id}"
+	tokenPlaceholder = "{token}"
+)
+
+// Sanitizer rewrites the value of a string attribute registered under key
+// before it reaches logs, spans, or metric labels
+type Sanitizer func(key, value string) string
+
+var sanitizer atomic.Pointer[Sanitizer]
+
+func init() {
+	SetSanitizer(RedactURLs())
+}
+
+// SetSanitizer replaces the sanitizer applied to every string attribute,
+// RedactURLs by default. A nil sanitizer reports values as registered.
+func SetSanitizer(s Sanitizer) {
+	sanitizer.Store(&s)
+}
+
+func sanitize(k, v string) string {
+	s := sanitizer.Load()
+	if s == nil || *s == nil {
+		return v
+	}
+
+	return (*s)(k, v)
+}
+
+type redactOpts struct {
+	keys   map[string]struct{}
+	ids    []*regexp.Regexp
+	tokens []*regexp.Regexp
+}
+
+type RedactOption func(*redactOpts)
+
+// WithRedactedKeys redacts the values of the attributes registered under keys
+// along with the well-known keys
+func WithRedactedKeys(keys ...string) RedactOption {
+	return func(opts *redactOpts) {
+		for _, k := range keys {
+			opts.keys[k] = struct{}{}
+		}
+	}
+}
+
+// WithIDPattern masks path segments matching pattern as {id}, along with
+// numbers, UUIDs, and long hexadecimal strings
+func WithIDPattern(pattern *regexp.Regexp) RedactOption {
+	return func(opts *redactOpts) {
+		opts.ids = append(opts.ids, pattern)
+	}
+}
+
+// WithTokenPattern masks path segments matching pattern as {token}, along
+// with JWTs and long strings mixing letters and digits
+func WithTokenPattern(pattern *regexp.Regexp) RedactOption {
+	return func(opts *redactOpts) {
+		opts.tokens = append(opts.tokens, pattern)
+	}
+}
+
+var (
+	// redactedKeys are the well-known keys of attributes holding URLs, paths,
+	// or query strings
+	redactedKeys = []string{
+		"url", "path", "query",
+		"url.full", "url.path", "url.query",
+		"http.url", "http.target",
+	}
+
+	defaultIDPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`^[0-9]+$`),
+		regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`),
+		regexp.MustCompile(`^[0-9a-fA-F]{16,}$`),
+	}
+
+	defaultTokenPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`^eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]*\.[A-Za-z0-9_-]*$`),
+	}
+)
+
+// minTokenLength is the length from which strings mixing letters and digits,
+// like API keys and session tokens, are masked as tokens
+const minTokenLength = 24
+
+// RedactURLs returns a Sanitizer for the attributes holding URLs, paths, and
+// query strings under well-known keys, e.g. url, path, and query. It strips
+// the query string, fragment, and credentials of URLs and paths, masks path
+// segments which are IDs as {id} and those which are tokens as {token}, and
+// keeps only the parameter names of query strings, so identifiers and secrets
+// do not reach logs, spans, or labels.
+func RedactURLs(opts ...RedactOption) Sanitizer {
+	opt := redactOpts{keys: make(map[string]struct{})}
+	for _, k := range redactedKeys {
+		opt.keys[k] = struct{}{}
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+	opt.ids = append(opt.ids, defaultIDPatterns...)
+	opt.tokens = append(opt.tokens, defaultTokenPatterns...)
+
+	return func(k, v string) string {
+		if _, ok := opt.keys[k]; !ok {
+			return v
+		}
+
+		if k == "query" || strings.HasSuffix(k, ".query") {
+			return redactQuery(v)
+		}
+
+		return opt.redactURL(v)
+	}
+}
+
+// redactURL strips everything but the scheme, host, and masked path of the
+// URL or path v
+func (opt redactOpts) redactURL(v string) string {
+	u, err := url.Parse(v)
+	if err != nil {
+		// an unparsable value is cut at the query rather than reported whole
+		v, _, _ = strings.Cut(v, "?")
+		v, _, _ = strings.Cut(v, "#")
+		return opt.redactPath(v)
+	}
+
+	u.User = nil
+	u.RawQuery = ""
+	u.ForceQuery = false
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	path := opt.redactPath(u.EscapedPath())
+	u.Path, u.RawPath = "", ""
+
+	return u.String() + path
+}
+
+func (opt redactOpts) redactPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if s == "" {
+			continue
+		}
+
+		segments[i] = opt.redactSegment(s)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+func (opt redactOpts) redactSegment(s string) string {
+	for _, p := range opt.ids {
+		if p.MatchString(s) {
+			return idPlaceholder
+		}
+	}
+
+	for _, p := range opt.tokens {
+		if p.MatchString(s) {
+			return tokenPlaceholder
+		}
+	}
+	if looksRandom(s) {
+		return tokenPlaceholder
+	}
+
+	return s
+}
+
+// looksRandom reports whether s is long and mixes letters and digits, which
+// words in paths rarely do
+func looksRandom(s string) bool {
+	if len(s) < minTokenLength {
+		return false
+	}
+
+	var letters, digits bool
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits = true
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+			letters = true
+		case strings.ContainsRune("-_~+=.%", r):
+		default:
+			return false
+		}
+	}
+
+	return letters && digits
+}
+
+// redactQuery keeps only the names of the parameters of the query string v
+func redactQuery(v string) string {
+	v = strings.TrimPrefix(v, "?")
+
+	var names []string
+	for _, param := range strings.Split(v, "&") {
+		name, _, _ := strings.Cut(param, "=")
+		if name == "" {
+			continue
+		}
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+
+		names = append(names, name)
+	}
+
+	return strings.Join(names, "&")
+}
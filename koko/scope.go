@@ -0,0 +1,65 @@
+package koko
+
+import (
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultScopeName is the instrumentation scope spans are attributed to
+// unless another is set
+const defaultScopeName = "kzs0/kokoro"
+
+type instrumentationScope struct {
+	name    string
+	version string
+}
+
+var scope atomic.Pointer[instrumentationScope]
+
+// SetInstrumentationScope attributes the spans of operations to the
+// instrumentation scope provided, e.g. the service or library starting them,
+// instead of kzs0/kokoro. An empty name restores the default.
+func SetInstrumentationScope(name, version string) {
+	if name == "" {
+		scope.Store(nil)
+		return
+	}
+
+	scope.Store(&instrumentationScope{name: name, version: version})
+}
+
+// WithInstrumentationScope attributes the span of the operation to the
+// instrumentation scope provided, e.g. the library wrapped by the operation,
+// instead of the one set by SetInstrumentationScope. Operation metrics are
+// still attributed to the scope of the metrics factory.
+func WithInstrumentationScope(name, version string) OperationOption {
+	return func(opts *operationOpts) {
+		opts.scope = &instrumentationScope{name: name, version: version}
+	}
+}
+
+// Tracer returns the tracer of tp attributed to the scope set by
+// SetInstrumentationScope, kzs0/kokoro by default, which operation spans are
+// started with
+func Tracer(tp trace.TracerProvider) trace.Tracer {
+	return scopedTracer(tp, scope.Load())
+}
+
+// tracerFor returns the tracer of the scope provided, or of the scope set by
+// SetInstrumentationScope when it is nil
+func (tel Telemetry) tracerFor(s *instrumentationScope) trace.Tracer {
+	if s == nil {
+		return Tracer(tel.TracerProvider)
+	}
+
+	return scopedTracer(tel.TracerProvider, s)
+}
+
+func scopedTracer(tp trace.TracerProvider, s *instrumentationScope) trace.Tracer {
+	if s == nil {
+		return tp.Tracer(defaultScopeName)
+	}
+
+	return tp.Tracer(s.name, trace.WithInstrumentationVersion(s.version))
+}
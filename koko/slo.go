@@ -0,0 +1,101 @@
+package koko
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+type objective struct {
+	latency time.Duration
+	target  float64
+}
+
+// sloRecorder exports the conformance of an operation to its objective.
+//
+// The within/outside counters describe latency conformance alone, while the
+// good/total pair feeds burn rate alerts directly:
+//
+//	burn rate = (1 - rate(good) / rate(total)) / (1 - target)
+type sloRecorder struct {
+	objective objective
+	within    metrics.Counter
+	outside   metrics.Counter
+	good      metrics.Counter
+	total     metrics.Counter
+	target    metrics.Gauge
+	// labels identify the operation when operations share their metrics
+	labels []metrics.MeasurementOption
+}
+
+func (s *sloRecorder) Record(ctx context.Context, dur time.Duration, success bool, opts ...metrics.MeasurementOption) error {
+	opts = append(opts, s.labels...)
+	met := dur <= s.objective.latency
+
+	var err error
+	if met {
+		err = s.within.Incr(ctx, opts...)
+	} else {
+		err = s.outside.Incr(ctx, opts...)
+	}
+	if err != nil {
+		return err
+	}
+
+	if met && success {
+		err = s.good.Incr(ctx, opts...)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.total.Incr(ctx, opts...)
+	if err != nil {
+		return err
+	}
+
+	return s.target.Measure(ctx, s.objective.target, opts...)
+}
+
+func newSLORecorder(tel Telemetry, op string, obj objective) (*sloRecorder, error) {
+	if obj.target <= 0 || obj.target >= 1 {
+		return nil, fmt.Errorf("objective target must be between 0 and 1, got %v", obj.target)
+	}
+
+	s := &sloRecorder{objective: obj}
+
+	counters := []struct {
+		signal  string
+		desc    string
+		counter *metrics.Counter
+	}{
+		{"slo_within", "operations completed within the latency objective", &s.within},
+		{"slo_outside", "operations completed outside the latency objective", &s.outside},
+		{"slo_good", "operations that succeeded within the latency objective", &s.good},
+		{"slo_events", "operations evaluated against the objective", &s.total},
+	}
+
+	for _, c := range counters {
+		name, _, labels := operationMetric(op, c.signal)
+		s.labels = labels
+
+		counter, err := tel.counter(name, metrics.WithDescription(c.desc), metrics.WithAnyLabels())
+		if err != nil {
+			return nil, err
+		}
+		*c.counter = counter
+	}
+
+	name, _, _ := operationMetric(op, "slo_target")
+	target, err := tel.gauge(name,
+		metrics.WithDescription("target ratio of operations meeting the objective"),
+		metrics.WithAnyLabels())
+	if err != nil {
+		return nil, err
+	}
+	s.target = target
+
+	return s, nil
+}
@@ -0,0 +1,68 @@
+package koko
+
+import (
+	"net"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	SpanKindInternal = trace.SpanKindInternal
+	SpanKindServer   = trace.SpanKindServer
+	SpanKindClient   = trace.SpanKindClient
+	SpanKindProducer = trace.SpanKindProducer
+	SpanKindConsumer = trace.SpanKindConsumer
+)
+
+// WithSpanKind sets the kind of the operation span, e.g. SpanKindClient for
+// operations wrapping outbound calls
+func WithSpanKind(kind trace.SpanKind) OperationOption {
+	return withSpanOptions(trace.WithSpanKind(kind))
+}
+
+// WithPeer describes the remote service an operation communicates with so
+// service maps can be built from its spans. The address may be a host or a
+// host:port pair.
+//
+// The peer service is also registered as the peer.service attribute.
+func WithPeer(service, addr string) OperationOption {
+	attrs := []attribute.KeyValue{semconv.PeerService(service)}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if host != "" {
+		attrs = append(attrs, semconv.ServerAddress(host))
+	}
+	if p, err := strconv.Atoi(port); err == nil {
+		attrs = append(attrs, semconv.ServerPort(p))
+	}
+
+	return func(opts *operationOpts) {
+		withSpanOptions(trace.WithAttributes(attrs...))(opts)
+		opts.attrs = append(opts.attrs, Str(string(semconv.PeerServiceKey), service))
+	}
+}
+
+// WithLinks links the operation span to the spans provided, e.g. the span
+// that scheduled work the operation executes much later
+func WithLinks(spans ...trace.SpanContext) OperationOption {
+	links := make([]trace.Link, 0, len(spans))
+	for _, sc := range spans {
+		if sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+
+	return withSpanOptions(trace.WithLinks(links...))
+}
+
+// WithNewRoot starts the operation span as the root of a new trace rather
+// than a child of the span in the context
+func WithNewRoot() OperationOption {
+	return withSpanOptions(trace.WithNewRoot())
+}
@@ -2,30 +2,61 @@ package koko
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kzs0/kokoro/telemetry/metrics"
 )
 
 type stack struct {
-	Strs     map[string]string
-	Ints     map[string]int64
-	Floats   map[string]float64
-	Bools    map[string]bool
-	LogLevel string
+	Operation   string
+	Strs        map[string]string
+	Ints        map[string]int64
+	Floats      map[string]float64
+	Bools       map[string]bool
+	Dests       map[string]destination
+	LogLevel    string
+	Checkpoints *checkpoints
+	Throughput  *throughput
+	Errors      *errorList
 }
 
 type key int
 
 var stackKey key
 
-func initStack(ctx context.Context) context.Context {
+// initStack pushes the stack of an operation onto ctx. An operation started
+// within another inherits a copy of the attributes of its parent, so they are
+// reported by both without attributes of the child reaching the parent.
+func initStack(ctx context.Context, operation string, start time.Time, opts operationOpts) context.Context {
 	st := stack{
-		Strs:     make(map[string]string),
-		Ints:     make(map[string]int64),
-		Floats:   make(map[string]float64),
-		Bools:    make(map[string]bool),
-		LogLevel: "DEBUG",
+		Operation:   operation,
+		Strs:        make(map[string]string),
+		Ints:        make(map[string]int64),
+		Floats:      make(map[string]float64),
+		Bools:       make(map[string]bool),
+		Dests:       make(map[string]destination),
+		LogLevel:    "DEBUG",
+		Checkpoints: &checkpoints{last: start},
+		Throughput:  newThroughput(opts.throughputHistograms),
+		Errors:      &errorList{},
+	}
+
+	if parent, ok := getStack(ctx); ok {
+		inherited := parent.clone()
+		st.Strs = inherited.Strs
+		st.Ints = inherited.Ints
+		st.Floats = inherited.Floats
+		st.Bools = inherited.Bools
+		st.Dests = inherited.Dests
+	}
+
+	if opts.level != "" {
+		st.LogLevel = opts.level
 	}
 
-	return context.WithValue(ctx, stackKey, &st)
+	return context.WithValue(ctx, stackKey, st)
 }
 
 func getStack(ctx context.Context) (stack, bool) {
@@ -45,3 +76,172 @@ func pop(ctx context.Context) (stack, bool) {
 	st, ok := ctx.Value(stackKey).(stack)
 	return st, ok
 }
+
+// sends reports whether the attribute registered under k should be sent to
+// the destination
+func (st stack) sends(k string, dest destination) bool {
+	d, ok := st.Dests[k]
+	if !ok {
+		return true
+	}
+
+	return d&dest != 0
+}
+
+// labels reports whether the attribute registered under k is a metric label
+// of the operation, given whether its trace is sampled
+func (st stack) labels(k string, sampled bool) bool {
+	if !st.sends(k, toMetrics) {
+		return false
+	}
+
+	return sampled || st.Dests[k]&onlySampled == 0
+}
+
+func (st stack) has(k string) bool {
+	_, ok := st.Dests[k]
+	return ok
+}
+
+// changedSince returns the keys of attributes that were added or modified
+// since prev was cloned
+func (st stack) changedSince(prev stack) []string {
+	keys := make([]string, 0)
+	for k, d := range st.Dests {
+		if !prev.has(k) || prev.Dests[k] != d || !prev.same(k, st) {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+// same reports whether the attribute under k holds the same value in both
+// stacks
+func (st stack) same(k string, other stack) bool {
+	if s, ok := st.Strs[k]; ok {
+		o, ok := other.Strs[k]
+		return ok && o == s
+	}
+	if i, ok := st.Ints[k]; ok {
+		o, ok := other.Ints[k]
+		return ok && o == i
+	}
+	if f, ok := st.Floats[k]; ok {
+		o, ok := other.Floats[k]
+		return ok && o == f
+	}
+	if b, ok := st.Bools[k]; ok {
+		o, ok := other.Bools[k]
+		return ok && o == b
+	}
+
+	return false
+}
+
+func (st stack) remove(k string) {
+	delete(st.Strs, k)
+	delete(st.Ints, k)
+	delete(st.Floats, k)
+	delete(st.Bools, k)
+	delete(st.Dests, k)
+}
+
+// restore will reset the attribute under k to the value held by prev
+func (st stack) restore(k string, prev stack) {
+	st.remove(k)
+
+	if s, ok := prev.Strs[k]; ok {
+		st.Strs[k] = s
+	}
+	if i, ok := prev.Ints[k]; ok {
+		st.Ints[k] = i
+	}
+	if f, ok := prev.Floats[k]; ok {
+		st.Floats[k] = f
+	}
+	if b, ok := prev.Bools[k]; ok {
+		st.Bools[k] = b
+	}
+	st.Dests[k] = prev.Dests[k]
+}
+
+// clone returns a copy of the stack whose attributes can be modified without
+// affecting the original
+func (st stack) clone() stack {
+	c := st
+	c.Strs = make(map[string]string, len(st.Strs))
+	c.Ints = make(map[string]int64, len(st.Ints))
+	c.Floats = make(map[string]float64, len(st.Floats))
+	c.Bools = make(map[string]bool, len(st.Bools))
+	c.Dests = make(map[string]destination, len(st.Dests))
+
+	for k, v := range st.Strs {
+		c.Strs[k] = v
+	}
+	for k, v := range st.Ints {
+		c.Ints[k] = v
+	}
+	for k, v := range st.Floats {
+		c.Floats[k] = v
+	}
+	for k, v := range st.Bools {
+		c.Bools[k] = v
+	}
+	for k, v := range st.Dests {
+		c.Dests[k] = v
+	}
+
+	return c
+}
+
+// attrs returns every attribute registered on the stack
+func (st stack) attrs() []slog.Attr {
+	attrs := make([]slog.Attr, 0, len(st.Dests))
+	for k, s := range st.Strs {
+		attrs = append(attrs, slog.String(k, s))
+	}
+	for k, i := range st.Ints {
+		attrs = append(attrs, slog.Int64(k, i))
+	}
+	for k, f := range st.Floats {
+		attrs = append(attrs, slog.Float64(k, f))
+	}
+	for k, b := range st.Bools {
+		attrs = append(attrs, slog.Bool(k, b))
+	}
+
+	return attrs
+}
+
+// metricLabels returns the labels of the attributes reported to metrics,
+// along with the tenant label, see tenantLabel. Labels reported SampledOnly
+// are left out unless the trace is sampled.
+func (st stack) metricLabels(sampled bool) []metrics.MeasurementOption {
+	labels := make([]metrics.MeasurementOption, 0)
+	for k, f := range st.Floats {
+		if st.labels(k, sampled) {
+			labels = append(labels, metrics.WithLabel(k, fmt.Sprint(f)))
+		}
+	}
+	for k, i := range st.Ints {
+		if st.labels(k, sampled) {
+			labels = append(labels, metrics.WithLabel(k, fmt.Sprint(i)))
+		}
+	}
+	for k, s := range st.Strs {
+		if st.labels(k, sampled) {
+			labels = append(labels, metrics.WithLabel(k, s))
+		}
+	}
+	for k, b := range st.Bools {
+		if st.labels(k, sampled) {
+			labels = append(labels, metrics.WithLabel(k, fmt.Sprint(b)))
+		}
+	}
+	if tenant, ok := tenantLabel(st); ok {
+		labels = append(labels, tenant)
+	}
+
+	return labels
+}
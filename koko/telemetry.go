@@ -0,0 +1,99 @@
+package koko
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/kzs0/kokoro/telemetry/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var ErrMetricsNotInitialized = errors.New("metrics have not been initialized")
+
+// Telemetry is where operations send their logs, metrics, and traces. Fields
+// left nil fall back to the process wide defaults.
+type Telemetry struct {
+	Logger         *slog.Logger
+	Metrics        metrics.Factory
+	TracerProvider trace.TracerProvider
+}
+
+type telemetryKey struct{}
+
+// WithTelemetry returns a context whose operations, and the operations nested
+// within them, report to the telemetry provided instead of the process wide
+// defaults
+func WithTelemetry(ctx context.Context, tel Telemetry) context.Context {
+	return context.WithValue(ctx, telemetryKey{}, tel)
+}
+
+// telemetryFrom returns the telemetry carried by ctx with any missing fields
+// filled in from the process wide defaults
+func telemetryFrom(ctx context.Context) Telemetry {
+	tel, _ := ctx.Value(telemetryKey{}).(Telemetry)
+
+	if tel.Logger == nil {
+		tel.Logger = slog.Default()
+	}
+	if tel.Metrics == nil {
+		tel.Metrics = metrics.DefaultFactory
+	}
+	if tel.TracerProvider == nil {
+		tel.TracerProvider = otel.GetTracerProvider()
+	}
+
+	return tel
+}
+
+func (tel Telemetry) tracer() trace.Tracer {
+	return tel.tracerFor(nil)
+}
+
+func (tel Telemetry) counter(name string, opts ...metrics.MetricOption) (metrics.Counter, error) {
+	if tel.Metrics == nil {
+		return nil, ErrMetricsNotInitialized
+	}
+
+	return tel.Metrics.NewCounter(name, opts...)
+}
+
+func (tel Telemetry) histogram(name string, opts ...metrics.MetricOption) (metrics.Histogram, error) {
+	if tel.Metrics == nil {
+		return nil, ErrMetricsNotInitialized
+	}
+
+	return tel.Metrics.NewHistogram(name, opts...)
+}
+
+func (tel Telemetry) gauge(name string, opts ...metrics.MetricOption) (metrics.Gauge, error) {
+	if tel.Metrics == nil {
+		return nil, ErrMetricsNotInitialized
+	}
+
+	return tel.Metrics.NewGauge(name, opts...)
+}
+
+func (tel Telemetry) observableGauge(name string, callback func(context.Context) (float64, []metrics.MeasurementOption), opts ...metrics.MetricOption) (metrics.ObservableGauge, error) {
+	if tel.Metrics == nil {
+		return nil, ErrMetricsNotInitialized
+	}
+
+	return tel.Metrics.NewObservableGauge(name, callback, opts...)
+}
+
+// observableGaugeSeries registers the callback reporting the series of a gauge
+// operations may share, see metrics.ObservableGaugeSeries. Factories which
+// cannot share a gauge report the series registered first.
+func (tel Telemetry) observableGaugeSeries(name, series string, callback func(context.Context) (float64, []metrics.MeasurementOption), opts ...metrics.MetricOption) (metrics.ObservableGauge, error) {
+	if tel.Metrics == nil {
+		return nil, ErrMetricsNotInitialized
+	}
+
+	if f, ok := tel.Metrics.(metrics.ObservableGaugeSeries); ok {
+		return f.NewObservableGaugeSeries(name, series, callback, opts...)
+	}
+
+	return tel.Metrics.NewObservableGauge(name, callback, opts...)
+}
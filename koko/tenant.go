@@ -0,0 +1,123 @@
+package koko
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/kzs0/kokoro/telemetry/metrics"
+	"go.opentelemetry.io/otel/baggage"
+)
+
+// DefaultTenantKey is the attribute tenants are reported as unless another is
+// set with SetTenantAttribute
+const DefaultTenantKey = "tenant"
+
+// otherTenant is the metric label of tenants missing from the allowlist
+const otherTenant = "_OTHER"
+
+type tenantPolicy struct {
+	key     string
+	allowed map[string]struct{}
+	labeled bool
+}
+
+var tenants atomic.Pointer[tenantPolicy]
+
+// SetTenantAttribute designates the attribute identifying the tenant of a
+// request, set with WithTenant. Every operation of the request registers the
+// tenant on its logs and span, and labels its metrics with it when it is one
+// of the allowed tenants, or with _OTHER when it isn't, so the number of
+// series stays bounded. An empty key uses DefaultTenantKey.
+func SetTenantAttribute(key string, allowed ...string) {
+	if key == "" {
+		key = DefaultTenantKey
+	}
+
+	p := &tenantPolicy{
+		key:     key,
+		allowed: make(map[string]struct{}, len(allowed)),
+		labeled: true,
+	}
+	for _, t := range allowed {
+		p.allowed[t] = struct{}{}
+	}
+
+	tenants.Store(p)
+}
+
+// ResetTenantAttribute stops labeling operation metrics with the tenant,
+// which is then registered on logs and spans as DefaultTenantKey
+func ResetTenantAttribute() {
+	tenants.Store(nil)
+}
+
+func currentTenants() *tenantPolicy {
+	p := tenants.Load()
+	if p == nil {
+		return &tenantPolicy{key: DefaultTenantKey}
+	}
+
+	return p
+}
+
+type tenantKey struct{}
+
+// WithTenant returns a context whose operations report the tenant provided,
+// see SetTenantAttribute. The tenant is propagated to other services as
+// baggage.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	ctx = context.WithValue(ctx, tenantKey{}, tenant)
+
+	m, err := baggage.NewMemberRaw(currentTenants().key, tenant)
+	if err != nil {
+		return ctx
+	}
+
+	bag, err := baggage.FromContext(ctx).SetMember(m)
+	if err != nil {
+		return ctx
+	}
+
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+// Tenant returns the tenant of ctx, set with WithTenant or received as
+// baggage, or an empty string when it has none
+func Tenant(ctx context.Context) string {
+	if t, ok := ctx.Value(tenantKey{}).(string); ok {
+		return t
+	}
+
+	return baggage.FromContext(ctx).Member(currentTenants().key).Value()
+}
+
+// registerTenant registers the tenant on the logs and span of the operation,
+// its metrics are labeled on completion, see tenantLabel
+func registerTenant(ctx context.Context) context.Context {
+	t := Tenant(ctx)
+	if t == "" {
+		return ctx
+	}
+
+	return Register(ctx, Str(currentTenants().key, t, LogOnly(), TraceOnly()))
+}
+
+// tenantLabel returns the label of the tenant registered on the stack, when
+// operation metrics are labeled with the tenant
+func tenantLabel(st stack) (metrics.MeasurementOption, bool) {
+	p := currentTenants()
+	if !p.labeled {
+		return nil, false
+	}
+
+	t, ok := st.Strs[p.key]
+	if !ok || t == "" {
+		return nil, false
+	}
+
+	if _, ok := p.allowed[t]; !ok {
+		t = otherTenant
+	}
+
+	return metrics.WithLabel(p.key, t), true
+}
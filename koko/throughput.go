@@ -0,0 +1,121 @@
+package koko
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/kzs0/kokoro/diagnostics"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+type throughput struct {
+	mu         sync.Mutex
+	histograms bool
+	keys       map[string]struct{}
+}
+
+func newThroughput(histograms bool) *throughput {
+	return &throughput{
+		histograms: histograms,
+		keys:       make(map[string]struct{}),
+	}
+}
+
+func (t *throughput) add(k string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.keys[k] = struct{}{}
+}
+
+func (t *throughput) list() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	keys := make([]string, 0, len(t.keys))
+	for k := range t.keys {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+// WithThroughputHistograms observes every Bytes and Count attribute registered
+// on the operation in a histogram named <operation>_<key>, or as the other
+// metrics of the operation are, see OperationMetric
+func WithThroughputHistograms() OperationOption {
+	return func(opts *operationOpts) {
+		opts.throughputHistograms = true
+	}
+}
+
+// Bytes registers the size in bytes of a result or payload. On completion the
+// operation also reports the rate as <key>_per_sec.
+//
+// Sizes are unbounded so they are not used as metric labels.
+func Bytes(k string, n int64) Attribute {
+	return throughputAttr(k, n)
+}
+
+// Count registers the number of items a result or payload holds. On completion
+// the operation also reports the rate as <key>_per_sec.
+//
+// Counts are unbounded so they are not used as metric labels.
+func Count(k string, n int64) Attribute {
+	return throughputAttr(k, n)
+}
+
+func throughputAttr(k string, n int64) Attribute {
+	return func(ctx context.Context) context.Context {
+		st, ok := getStack(ctx)
+		if !ok {
+			return ctx
+		}
+
+		ctx = Int64(k, n, LogOnly(), TraceOnly())(ctx)
+		st.Throughput.add(k)
+
+		if st.Throughput.histograms {
+			observeThroughput(ctx, st.Operation, k, n)
+		}
+
+		return ctx
+	}
+}
+
+func observeThroughput(ctx context.Context, operation, k string, n int64) {
+	tel := telemetryFrom(ctx)
+	name, labelNames, labels := operationMetric(operation, k)
+	h, err := tel.histogram(name, metrics.WithLabelNames(labelNames))
+	if err == nil {
+		err = h.Record(ctx, float64(n), labels...)
+	}
+	if err != nil {
+		diagnostics.Report(ctx, "koko", "failed to observe throughput", err,
+			slog.String("operation", operation), slog.String("key", k))
+	}
+}
+
+// throughputAttributes returns the per second rate of every throughput
+// attribute registered on the operation
+func throughputAttributes(st stack, elapsed time.Duration) []Attribute {
+	if st.Throughput == nil || elapsed <= 0 {
+		return nil
+	}
+
+	attrs := make([]Attribute, 0)
+	for _, k := range st.Throughput.list() {
+		n, ok := st.Ints[k]
+		if !ok {
+			continue
+		}
+
+		rate := float64(n) / elapsed.Seconds()
+		attrs = append(attrs, Float64(fmt.Sprintf("%s_per_sec", k), rate, LogOnly(), TraceOnly()))
+	}
+
+	return attrs
+}
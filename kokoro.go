@@ -3,21 +3,86 @@ package kokoro
 import (
 	"context"
 	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
-	"github.com/kzs0/kokoro/env"
+	"github.com/kzs0/kokoro/admin"
+	"github.com/kzs0/kokoro/diagnostics"
+	"github.com/kzs0/kokoro/health"
+	"github.com/kzs0/kokoro/koko"
 	"github.com/kzs0/kokoro/telemetry/logs"
 	"github.com/kzs0/kokoro/telemetry/metrics"
+	"github.com/kzs0/kokoro/telemetry/profiling"
 	"github.com/kzs0/kokoro/telemetry/traces"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+const defaultGracePeriod = 5 * time.Second
+
 type options struct {
-	ctx    context.Context
-	config Config
+	ctx         context.Context
+	config      Config
+	metricsOpts []metrics.FactoryOption
+	tracesOpts  []traces.Option
+	handlers    map[string]http.Handler
+	admin       bool
+	reload      bool
+	exitOnCrash bool
+	reporters   []ErrorReporter
+	exitCode    int
+	signals     bool
+
+	withoutLogs        bool
+	withoutMetrics     bool
+	withoutTraces      bool
+	gracePeriod        time.Duration
+	heartbeat          time.Duration
+	maxProcs           bool
+	memLimitRatio      float64
+	profile            string
+	envFiles           envFiles
+	metricNameTemplate string
+	profiler           profiling.Pusher
+	profilingOpts      []profiling.Option
+	build              build
+	diagnostics        func(Diagnostic)
+	partitioned        bool
+	tenantKey          string
+	tenants            []string
+	scopeName          string
+	scopeVersion       string
 }
 
 type Option func(*options)
-type Done func()
 
+// ErrorReporter receives operation failures and recovered panics, see
+// koko.ErrorReporter
+type ErrorReporter = koko.ErrorReporter
+
+// ErrorReport describes a failure sent to an ErrorReporter
+type ErrorReport = koko.ErrorReport
+
+// Done shuts down everything started by Init, running the shutdown hooks and
+// flushing traces and metrics before returning. Shutdown gives up once the
+// context provided is done, or after the grace period when none is provided.
+// The context returned by Init is canceled by Done, so it can't be used to
+// bound shutdown.
+//
+// Every hook, server, or exporter that failed to shut down or flush is
+// reported in the error returned. Only the first call shuts down, later calls
+// return the same error.
+type Done func(ctx ...context.Context) error
+
+// WithConfig uses the config provided instead of parsing it from the
+// environment. Logs, metrics, and traces are started unless their Enabled
+// field is false, their Disabled field is set, or they are turned off WithoutLogs, WithoutMetrics, or
+// WithoutTraces, so the zero Config starts all of them.
 func WithConfig(config Config) Option {
 	return func(o *options) {
 		o.config = config
@@ -30,8 +95,138 @@ func WithContext(ctx context.Context) Option {
 	}
 }
 
-func Init(opts ...Option) (context.Context, Done, error) {
-	opt := options{}
+// WithoutLogs leaves the default logger untouched, equivalent to setting
+// LOGS_ENABLED=false or LOGS_DISABLED=true
+func WithoutLogs() Option {
+	return func(o *options) {
+		o.withoutLogs = true
+	}
+}
+
+// WithoutMetrics skips starting the metrics exporter and server, leaving a
+// factory that discards measurements so instrumentation keeps working.
+// Equivalent to setting METRICS_ENABLED=false or METRICS_DISABLED=true.
+func WithoutMetrics() Option {
+	return func(o *options) {
+		o.withoutMetrics = true
+	}
+}
+
+// WithoutTraces skips starting the trace exporter, leaving spans unrecorded.
+// Equivalent to setting TRACES_ENABLED=false or TRACES_DISABLED=true.
+func WithoutTraces() Option {
+	return func(o *options) {
+		o.withoutTraces = true
+	}
+}
+
+// WithErrorReporter sends every operation failure and panic recovered by
+// Recover to the reporter provided
+func WithErrorReporter(r ErrorReporter) Option {
+	return func(o *options) {
+		o.reporters = append(o.reporters, r)
+	}
+}
+
+// WithSignalHandling cancels the context returned by Init and runs the shutdown
+// hooks when the process receives SIGINT or SIGTERM
+func WithSignalHandling() Option {
+	return func(o *options) {
+		o.signals = true
+	}
+}
+
+// WithGracePeriod bounds how long Done waits for telemetry in flight to be
+// flushed. Defaults to 5 seconds.
+func WithGracePeriod(d time.Duration) Option {
+	return func(o *options) {
+		o.gracePeriod = d
+	}
+}
+
+// WithOperationsEndpoint serves the operation registry as JSON from
+// /debug/operations on the metrics or admin server
+func WithOperationsEndpoint() Option {
+	return withHandler("/debug/operations", koko.OperationsHandler())
+}
+
+// WithAdminServer replaces the metrics server with an admin server on the same
+// port, serving metrics from /metrics alongside health checks, pprof, runtime
+// log level control, and a dump of the config
+func WithAdminServer() Option {
+	return func(o *options) {
+		o.admin = true
+	}
+}
+
+func withHandler(pattern string, handler http.Handler) Option {
+	return func(o *options) {
+		if o.handlers == nil {
+			o.handlers = make(map[string]http.Handler)
+		}
+
+		o.handlers[pattern] = handler
+	}
+}
+
+var instance struct {
+	// mu serializes Init and Reinit
+	mu      sync.Mutex
+	running atomic.Pointer[running]
+}
+
+// running is the instance started by Init
+type running struct {
+	ctx  context.Context
+	done Done
+}
+
+// Init starts logs, metrics, and traces, returning the default instance
+// reporting to them, see Default. Calling Init again before the Done it
+// returned has been called returns the context and Done of the running
+// instance along with ErrAlreadyInitialized, use Reinit to replace it.
+func Init(opts ...Option) (*Kokoro, context.Context, Done, error) {
+	instance.mu.Lock()
+	defer instance.mu.Unlock()
+
+	if r := instance.running.Load(); r != nil {
+		return Default(), r.ctx, r.done, ErrAlreadyInitialized
+	}
+
+	return start(opts)
+}
+
+// Reinit shuts down the running instance, if any, and initializes a new one
+// with the options provided. It is intended for tests, which may need to
+// initialize differently configured instances in the same process.
+func Reinit(opts ...Option) (*Kokoro, context.Context, Done, error) {
+	instance.mu.Lock()
+	defer instance.mu.Unlock()
+
+	if r := instance.running.Load(); r != nil {
+		r.done()
+	}
+
+	return start(opts)
+}
+
+// start initializes the instance, instance.mu must be held
+func start(opts []Option) (*Kokoro, context.Context, Done, error) {
+	ctx, done, err := initialize(opts...)
+	if err != nil {
+		return Default(), ctx, done, err
+	}
+
+	instance.running.Store(&running{ctx: ctx, done: done})
+	koko.SetRoot(ctx)
+
+	return Default(), ctx, done, nil
+}
+
+func initialize(opts ...Option) (context.Context, Done, error) {
+	opt := options{
+		gracePeriod: defaultGracePeriod,
+	}
 	for _, o := range opts {
 		o(&opt)
 	}
@@ -40,39 +235,276 @@ func Init(opts ...Option) (context.Context, Done, error) {
 	def := Config{}
 	ctx := context.Background()
 
+	s := configSettings(config)
 	if opt.config == def {
-		err := env.Parse(&config)
+		var err error
+		s, err = parseConfig(&config, opt.profile, opt.envFiles)
 		if err != nil {
 			return ctx, nil, errors.Join(ErrEnvLoadFailed, err)
 		}
 	}
 
-	if opt.ctx != nil {
-		ctx = opt.ctx
+	if opt.withoutLogs {
+		config.Logs.Disabled = true
+		s.override("LOGS_DISABLED", true)
+		s.override("LOGS_ENABLED", false)
+	}
+	if opt.withoutMetrics {
+		config.Metrics.Disabled = true
+		s.override("METRICS_DISABLED", true)
+		s.override("METRICS_ENABLED", false)
+	}
+	if opt.withoutTraces {
+		config.Traces.Disabled = true
+		s.override("TRACES_DISABLED", true)
+		s.override("TRACES_ENABLED", false)
 	}
 
-	ctx, cancel := context.WithCancel(ctx)
+	err := config.Validate()
+	if err != nil {
+		return ctx, nil, errors.Join(ErrInitializationFailed, err)
+	}
 
-	err := logs.Init(config.Logs)
+	namingOpts, err := applyMetricNameTemplate(opt.metricNameTemplate)
 	if err != nil {
-		cancel()
 		return ctx, nil, errors.Join(ErrInitializationFailed, err)
 	}
 
-	err = metrics.Init(config.Metrics)
+	buckets, err := metrics.ParseOperationBuckets(config.OperationBuckets)
 	if err != nil {
-		cancel()
 		return ctx, nil, errors.Join(ErrInitializationFailed, err)
 	}
 
-	err = traces.Init(ctx, config.Traces)
+	err = koko.SetDurationUnit(koko.DurationUnit(config.DurationUnit))
 	if err != nil {
-		cancel()
 		return ctx, nil, errors.Join(ErrInitializationFailed, err)
 	}
+	for op, b := range buckets {
+		koko.SetOperationBuckets(op, b...)
+	}
 
-	done := func() {
+	if opt.partitioned {
+		koko.SetTenantAttribute(opt.tenantKey, opt.tenants...)
+	}
+
+	// resetOperations restores the defaults of how operations are recorded
+	// set above
+	resetOperations := func() {
+		_ = koko.SetDurationUnit("")
+		for op := range buckets {
+			koko.SetOperationBuckets(op)
+		}
+		if opt.partitioned {
+			koko.ResetTenantAttribute()
+		}
+	}
+
+	if opt.ctx != nil {
+		ctx = opt.ctx
+	}
+	ctx = parentContext(ctx)
+
+	ctx, cancel := context.WithCancel(ctx)
+	parent := ctx
+
+	var signalled context.Context
+	if opt.signals {
+		var stop context.CancelFunc
+		signalled, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		ctx = signalled
+		cancelParent := cancel
+		cancel = func() {
+			stop()
+			cancelParent()
+		}
+	}
+
+	var closers []func(context.Context) error
+	// fail stops the servers and telemetry started so far, so Init can be
+	// retried without them holding on to their ports
+	fail := func(err error) (context.Context, Done, error) {
 		cancel()
+		resetOperations()
+
+		stopCtx, cancelStop := context.WithTimeout(context.Background(), opt.gracePeriod)
+		defer cancelStop()
+
+		return ctx, nil, errors.Join(ErrInitializationFailed, err,
+			closeAll(stopCtx, closers), stopTelemetry(stopCtx))
+	}
+
+	build := opt.build.resolve()
+	fingerprint := s.fingerprint()
+
+	if config.Logs.IsEnabled() {
+		logAttrs := append(build.logAttrs(), slog.String("config_fingerprint", fingerprint))
+		err := logs.Init(config.Logs, logs.WithAttributes(logAttrs...))
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	s.report()
+
+	limits := detectLimits()
+	limits.tune(opt)
+
+	metricsOpts := append(opt.metricsOpts, namingOpts...)
+	metricsOpts = append(metricsOpts, applyInstrumentationScope(opt.scopeName, opt.scopeVersion)...)
+	if opt.admin || !config.Metrics.IsEnabled() {
+		metricsOpts = append(metricsOpts, metrics.WithoutServer())
+	} else {
+		metricsOpts = append(metricsOpts,
+			metrics.WithHandler("/healthz", health.LivenessHandler()),
+			metrics.WithHandler("/readyz", health.ReadinessHandler()),
+		)
+		for pattern, handler := range opt.handlers {
+			metricsOpts = append(metricsOpts, metrics.WithHandler(pattern, handler))
+		}
+		if config.Profiling.Enabled && config.Profiling.Port == 0 {
+			metricsOpts = append(metricsOpts, metrics.WithHandler(profiling.HandlerPattern, profiling.Handler()))
+		}
+	}
+
+	reportOtelErrors()
+
+	if config.Metrics.IsEnabled() {
+		err := metrics.Init(config.Metrics, metricsOpts...)
+		if err != nil {
+			return fail(err)
+		}
+	} else {
+		metrics.DefaultFactory = metrics.NewNoopFactory()
+	}
+
+	if opt.admin {
+		// the settings are served redacted, the config itself holds secrets
+		// like the headers of the exporters
+		adminOpts := []admin.Option{admin.WithConfig(s.dump())}
+		for pattern, handler := range opt.handlers {
+			adminOpts = append(adminOpts, admin.WithHandler(pattern, handler))
+		}
+
+		server := admin.New(config.MetricsPort, adminOpts...)
+		err := server.Start()
+		if err != nil {
+			return fail(err)
+		}
+		closers = append(closers, server.Shutdown)
+	}
+
+	// the admin and metrics servers serve the profiling endpoints unless they
+	// are given a port of their own
+	if config.Profiling.Enabled && (config.Profiling.Port != 0 || (!opt.admin && !config.Metrics.IsEnabled())) {
+		port := config.Profiling.Port
+		if port == 0 {
+			port = config.MetricsPort
+		}
+
+		stop, err := profiling.Serve(port)
+		if err != nil {
+			return fail(err)
+		}
+		closers = append(closers, stop)
+	}
+
+	err = errors.Join(build.record(ctx), limits.record(ctx), recordFingerprint(ctx, fingerprint, ""))
+	if err != nil {
+		return fail(err)
+	}
+
+	resourceAttrs := append(build.traceAttrs(), limits.traceAttrs()...)
+	resourceAttrs = append(resourceAttrs, attribute.String("service.config.fingerprint", fingerprint))
+
+	if config.Traces.IsEnabled() {
+		tracesOpts := append([]traces.Option{traces.WithAttributes(resourceAttrs...)}, opt.tracesOpts...)
+		err = traces.Init(ctx, config.Traces, tracesOpts...)
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	koko.AddErrorReporter(opt.reporters...)
+	if opt.diagnostics != nil {
+		diagnostics.OnError(opt.diagnostics)
+	}
+
+	health.Start(ctx)
+
+	crash.mu.Lock()
+	crash.exit = opt.exitOnCrash
+	crash.exitCode = opt.exitCode
+	crash.grace = opt.gracePeriod
+	crash.mu.Unlock()
+
+	loaded.mu.Lock()
+	loaded.fromEnv = opt.config == def
+	loaded.profile = opt.profile
+	loaded.envFiles = opt.envFiles
+	loaded.settings = s
+	loaded.mu.Unlock()
+
+	if opt.reload {
+		watchReload(ctx)
+	}
+
+	closers = append(closers, watchUptime(ctx, opt.heartbeat))
+
+	profiler, profilingOpts := opt.profiler, opt.profilingOpts
+	if profiler == nil && config.Profiling.Enabled && config.Profiling.PyroscopeURL != "" {
+		profiler = profiling.NewPyroscope(config.Profiling.PyroscopeURL, config.Traces.ServiceName)
+		profilingOpts = append([]profiling.Option{profiling.WithInterval(config.Profiling.Interval)}, profilingOpts...)
+	}
+
+	if profiler != nil {
+		labels := profilingLabels(config.Traces.ServiceName, config.Logs.Environment, resourceAttrs)
+		profiling.Start(ctx, profiler, append([]profiling.Option{profiling.WithLabels(labels)}, profilingOpts...)...)
+	}
+
+	var once sync.Once
+	var shutdownErr error
+	done := func(ctxs ...context.Context) error {
+		once.Do(func() {
+			cancel()
+			health.Stop()
+
+			shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), opt.gracePeriod)
+			defer cancelShutdown()
+			if len(ctxs) > 0 && ctxs[0] != nil {
+				shutdownCtx = ctxs[0]
+			}
+
+			shutdownErr = shutdown(shutdownCtx, closers...)
+			if shutdownErr != nil {
+				slog.Error("failed to shutdown cleanly", slog.String("error", shutdownErr.Error()))
+			}
+
+			koko.RemoveErrorReporter(opt.reporters...)
+			if opt.diagnostics != nil {
+				diagnostics.OnError(nil)
+			}
+
+			// only clear the instance this Done belongs to
+			if r := instance.running.Load(); r != nil && r.ctx == ctx {
+				instance.running.CompareAndSwap(r, nil)
+			}
+			koko.SetRoot(nil)
+			if opt.partitioned {
+				koko.ResetTenantAttribute()
+			}
+			koko.SetInstrumentationScope("", "")
+		})
+
+		return shutdownErr
+	}
+
+	if opt.signals {
+		go func() {
+			<-signalled.Done()
+			if parent.Err() == nil {
+				done()
+			}
+		}()
 	}
 
 	return ctx, done, nil
@@ -0,0 +1,90 @@
+package kokoro
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+)
+
+func TestInitRetry(t *testing.T) {
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	metricsPort := freePort(t)
+	t.Setenv("SERVICE_NAME", "kokoro_test")
+	t.Setenv("LOGS_DISABLED", "true")
+	t.Setenv("TRACES_DISABLED", "true")
+	t.Setenv("METRICS_PORT", strconv.Itoa(metricsPort))
+	t.Setenv("PROFILING_ENABLED", "true")
+	t.Setenv("PROFILING_PORT", strconv.Itoa(busy.Addr().(*net.TCPAddr).Port))
+
+	_, _, done, err := Init()
+	if !errors.Is(err, ErrInitializationFailed) {
+		t.Fatalf("Init() error = %v, want %v", err, ErrInitializationFailed)
+	}
+	if done != nil {
+		t.Fatal("Init() returned a Done along with an error")
+	}
+
+	// the metrics server started before the profiling server failed must
+	// have released its port
+	l, err := net.Listen("tcp", ":"+strconv.Itoa(metricsPort))
+	if err != nil {
+		t.Fatalf("metrics port still held after a failed Init: %v", err)
+	}
+	l.Close()
+
+	busy.Close()
+
+	_, _, done, err = Init()
+	if err != nil {
+		t.Fatalf("Init() after a failed Init error = %v", err)
+	}
+
+	_, _, _, err = Init()
+	if !errors.Is(err, ErrAlreadyInitialized) {
+		t.Errorf("Init() while initialized error = %v, want %v", err, ErrAlreadyInitialized)
+	}
+
+	if err := done(); err != nil {
+		t.Errorf("done() error = %v", err)
+	}
+
+	_, _, done, err = Init()
+	if err != nil {
+		t.Fatalf("Init() after done error = %v", err)
+	}
+
+	_, ctx, reinitDone, err := Reinit()
+	if err != nil {
+		t.Fatalf("Reinit() error = %v", err)
+	}
+	if err := done(); err != nil {
+		t.Errorf("done() of the replaced instance error = %v", err)
+	}
+
+	_, running, _, err := Init()
+	if !errors.Is(err, ErrAlreadyInitialized) || running != ctx {
+		t.Errorf("Init() after Reinit error = %v, want %v with the context of Reinit", err, ErrAlreadyInitialized)
+	}
+
+	if err := reinitDone(); err != nil {
+		t.Errorf("done() error = %v", err)
+	}
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
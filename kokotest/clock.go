@@ -0,0 +1,54 @@
+package kokotest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kzs0/kokoro/internal/clock"
+)
+
+// ClockStart is the time a Clock starts at
+var ClockStart = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Clock controls the time seen by operation timing, periodic jobs, and
+// samplers, which only moves when advanced
+type Clock struct {
+	fake *clock.Fake
+}
+
+// NewClock replaces the clock until the test completes, starting at
+// ClockStart. The clock is process wide, so tests using it must not run in
+// parallel.
+//
+//	clk := kokotest.NewClock(t)
+//	ctx, done := koko.Operation(ctx, "checkout")
+//	clk.Advance(150 * time.Millisecond)
+//	done(&ctx, &err) // recorded as taking 150ms
+func NewClock(t testing.TB) *Clock {
+	t.Helper()
+
+	c := &Clock{fake: clock.NewFake(ClockStart)}
+	t.Cleanup(clock.Set(c.fake))
+
+	return c
+}
+
+// Now returns the current time of the clock
+func (c *Clock) Now() time.Time {
+	return c.fake.Now()
+}
+
+// Advance moves the clock forward by d, firing every timer and ticker due by
+// the new time
+func (c *Clock) Advance(d time.Duration) {
+	c.fake.Advance(d)
+}
+
+// BlockUntil waits for n timers and tickers to be waiting on the clock, so a
+// goroutine started by the code under test is waiting before the clock is
+// advanced
+func (c *Clock) BlockUntil(n int) {
+	for c.fake.Waiters() < n {
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,308 @@
+// Package kokotest captures the telemetry produced by koko operations so
+// instrumentation can be verified in unit tests.
+package kokotest
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	api "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// ServiceName is the service name metrics are created with while capturing
+const ServiceName = "kokotest"
+
+type Outcome int
+
+const (
+	Success Outcome = iota
+	Failure
+	Canceled
+	Expected
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case Success:
+		return "success"
+	case Canceled:
+		return "canceled"
+	case Expected:
+		return "expected"
+	default:
+		return "failures"
+	}
+}
+
+// Telemetry holds the metrics, spans, and logs captured during a test
+type Telemetry struct {
+	reader         *api.ManualReader
+	meterProvider  *api.MeterProvider
+	factory        metrics.Factory
+	spans          *tracetest.InMemoryExporter
+	tracerProvider *sdktrace.TracerProvider
+	logs           *logHandler
+}
+
+var current struct {
+	mu        sync.Mutex
+	telemetry *Telemetry
+}
+
+// Init creates in-memory telemetry for the test and returns a context whose
+// operations report to it. Nothing process wide is modified and no listeners
+// are started, so tests using Init may run in parallel. The telemetry is shut
+// down when the test completes.
+func Init(t testing.TB) (context.Context, *Telemetry) {
+	t.Helper()
+
+	tel := newTelemetry()
+	t.Cleanup(tel.shutdown)
+
+	ctx := koko.WithTelemetry(context.Background(), koko.Telemetry{
+		Logger:         slog.New(tel.logs),
+		Metrics:        tel.factory,
+		TracerProvider: tel.tracerProvider,
+	})
+
+	return ctx, tel
+}
+
+// Capture swaps the default metrics factory, tracer provider, and logger for
+// in-memory implementations for the duration of the test. The previous
+// defaults are restored when the test completes.
+//
+// The defaults are process wide, so tests using Capture must not run in
+// parallel, prefer Init where operations are started from a context the test
+// provides.
+func Capture(t testing.TB) *Telemetry {
+	t.Helper()
+
+	tel := newTelemetry()
+
+	prevFactory := metrics.DefaultFactory
+	prevTracerProvider := otel.GetTracerProvider()
+	prevLogger := slog.Default()
+
+	metrics.DefaultFactory = tel.factory
+	otel.SetTracerProvider(tel.tracerProvider)
+	slog.SetDefault(slog.New(tel.logs))
+
+	current.mu.Lock()
+	current.telemetry = tel
+	current.mu.Unlock()
+
+	t.Cleanup(func() {
+		current.mu.Lock()
+		current.telemetry = nil
+		current.mu.Unlock()
+
+		metrics.DefaultFactory = prevFactory
+		otel.SetTracerProvider(prevTracerProvider)
+		slog.SetDefault(prevLogger)
+
+		tel.shutdown()
+	})
+
+	return tel
+}
+
+func newTelemetry() *Telemetry {
+	reader := api.NewManualReader()
+	meterProvider := api.NewMeterProvider(api.WithReader(reader))
+	factory := metrics.NewFactory(metrics.Metrics{
+		ServiceName: ServiceName,
+		Environment: "test",
+	}, meterProvider.Meter("github.com/kzs0/kokoro"))
+
+	spans := tracetest.NewInMemoryExporter()
+
+	return &Telemetry{
+		reader:         reader,
+		meterProvider:  meterProvider,
+		factory:        factory,
+		spans:          spans,
+		tracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans)),
+		logs:           newLogHandler(),
+	}
+}
+
+func (tel *Telemetry) shutdown() {
+	ctx := context.Background()
+	_ = tel.tracerProvider.Shutdown(ctx)
+	_ = tel.meterProvider.Shutdown(ctx)
+}
+
+// Spans returns every span that has ended while capturing
+func (tel *Telemetry) Spans() tracetest.SpanStubs {
+	return tel.spans.GetSpans()
+}
+
+// Logs returns every log record emitted while capturing
+func (tel *Telemetry) Logs() []slog.Record {
+	return tel.logs.Records()
+}
+
+// Metrics collects the current state of every metric created while capturing
+func (tel *Telemetry) Metrics(t testing.TB) metricdata.ResourceMetrics {
+	t.Helper()
+
+	rm := metricdata.ResourceMetrics{}
+	err := tel.reader.Collect(context.Background(), &rm)
+	if err != nil {
+		t.Fatalf("kokotest: failed to collect metrics: %v", err)
+	}
+
+	return rm
+}
+
+// Name returns the exported name of a metric created with the provided name
+func (tel *Telemetry) Name(name string) string {
+	if n, ok := tel.factory.(metrics.Namer); ok {
+		return n.Name(name)
+	}
+
+	return name
+}
+
+type assertOpts struct {
+	labels map[string]string
+}
+
+type AssertOption func(*assertOpts)
+
+// WithLabel requires the operation metrics to carry the label
+func WithLabel(k, v string) AssertOption {
+	return func(opts *assertOpts) {
+		if opts.labels == nil {
+			opts.labels = make(map[string]string)
+		}
+
+		opts.labels[k] = v
+	}
+}
+
+// AssertOperation fails the test unless an operation with the name completed
+// with the outcome provided, producing a matching metric, span, and log.
+func AssertOperation(t testing.TB, name string, outcome Outcome, opts ...AssertOption) {
+	t.Helper()
+
+	current.mu.Lock()
+	tel := current.telemetry
+	current.mu.Unlock()
+
+	if tel == nil {
+		t.Fatalf("kokotest: AssertOperation called without Capture, use the Telemetry returned by Init instead")
+		return
+	}
+
+	tel.AssertOperation(t, name, outcome, opts...)
+}
+
+// AssertOperation fails the test unless an operation with the name completed
+// with the outcome provided, producing a matching metric, span, and log.
+func (tel *Telemetry) AssertOperation(t testing.TB, name string, outcome Outcome, opts ...AssertOption) {
+	t.Helper()
+
+	opt := assertOpts{}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	counter, labels := koko.OperationMetric(name, outcome.String())
+	for k, v := range opt.labels {
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[k] = v
+	}
+	if tel.sum(t, tel.Name(counter), labels) <= 0 {
+		t.Errorf("kokotest: no %s recorded for operation %q with labels %v", outcome, name, opt.labels)
+	}
+
+	status := codes.Error
+	switch outcome {
+	case Success:
+		status = codes.Ok
+	case Expected:
+		status = codes.Unset
+	}
+
+	found := false
+	for _, span := range tel.Spans() {
+		if span.Name == name && span.Status.Code == status {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Errorf("kokotest: no span %q ended with status %s", name, status)
+	}
+
+	found = false
+	for _, r := range tel.Logs() {
+		if r.Message == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Errorf("kokotest: no log emitted for operation %q", name)
+	}
+}
+
+// Sum returns the total of the counter across every data point carrying the
+// labels provided
+func (tel *Telemetry) Sum(t testing.TB, name string, labels map[string]string) float64 {
+	t.Helper()
+
+	return tel.sum(t, tel.Name(name), labels)
+}
+
+func (tel *Telemetry) sum(t testing.TB, exported string, labels map[string]string) float64 {
+	t.Helper()
+
+	total := 0.0
+	rm := tel.Metrics(t)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != exported {
+				continue
+			}
+
+			sum, ok := m.Data.(metricdata.Sum[float64])
+			if !ok {
+				continue
+			}
+
+			for _, dp := range sum.DataPoints {
+				if hasLabels(dp.Attributes, labels) {
+					total += dp.Value
+				}
+			}
+		}
+	}
+
+	return total
+}
+
+func hasLabels(set attribute.Set, labels map[string]string) bool {
+	for k, v := range labels {
+		got, ok := set.Value(attribute.Key(k))
+		if !ok || got.Emit() != v {
+			return false
+		}
+	}
+
+	return true
+}
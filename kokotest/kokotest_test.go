@@ -0,0 +1,98 @@
+package kokotest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/kzs0/kokoro/kerr"
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/kokoro/kokotest"
+)
+
+// recorder records the failures of assertions instead of failing the test
+type recorder struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...any) {
+	r.Errorf(format, args...)
+}
+
+func checkout(ctx context.Context, tier string, result error) (err error) {
+	ctx, done := koko.Operation(ctx, "checkout")
+	defer done(&ctx, &err)
+
+	ctx = koko.Register(ctx, koko.Str("tier", tier))
+
+	return result
+}
+
+func TestAssertOperation(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  error
+		outcome kokotest.Outcome
+		label   string
+	}{
+		{"success", nil, kokotest.Success, "gold"},
+		{"failure", errors.New("card declined"), kokotest.Failure, "gold"},
+		{"expected", kerr.New(kerr.NotFound, "no such cart"), kokotest.Expected, "gold"},
+		{"canceled", context.Canceled, kokotest.Canceled, "gold"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, tel := kokotest.Init(t)
+
+			if err := checkout(ctx, tt.label, tt.result); !errors.Is(err, tt.result) {
+				t.Fatalf("checkout() error = %v, want %v", err, tt.result)
+			}
+
+			tel.AssertOperation(t, "checkout", tt.outcome, kokotest.WithLabel("tier", tt.label))
+
+			r := &recorder{TB: t}
+			for _, other := range []kokotest.Outcome{kokotest.Success, kokotest.Failure, kokotest.Expected, kokotest.Canceled} {
+				if other == tt.outcome {
+					continue
+				}
+
+				r.failures = nil
+				tel.AssertOperation(r, "checkout", other)
+				if len(r.failures) == 0 {
+					t.Errorf("AssertOperation(%s) passed for an operation completed with %s", other, tt.outcome)
+				}
+			}
+
+			r.failures = nil
+			tel.AssertOperation(r, "checkout", tt.outcome, kokotest.WithLabel("tier", "silver"))
+			if len(r.failures) == 0 {
+				t.Errorf("AssertOperation() passed with a label the operation was not recorded with")
+			}
+		})
+	}
+}
+
+func TestCapture(t *testing.T) {
+	kokotest.Capture(t)
+
+	if err := checkout(context.Background(), "gold", nil); err != nil {
+		t.Fatalf("checkout() error = %v", err)
+	}
+
+	kokotest.AssertOperation(t, "checkout", kokotest.Success, kokotest.WithLabel("tier", "gold"))
+
+	r := &recorder{TB: t}
+	kokotest.AssertOperation(r, "refund", kokotest.Success)
+	if len(r.failures) == 0 {
+		t.Errorf("AssertOperation() passed for an operation which never ran")
+	}
+}
@@ -0,0 +1,60 @@
+package kokotest
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+type logRecords struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+// logHandler captures every log record at any level
+type logHandler struct {
+	records *logRecords
+	attrs   []slog.Attr
+	groups  []string
+}
+
+func newLogHandler() *logHandler {
+	return &logHandler{records: &logRecords{}}
+}
+
+func (h *logHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *logHandler) Handle(_ context.Context, r slog.Record) error {
+	r = r.Clone()
+	r.AddAttrs(h.attrs...)
+
+	h.records.mu.Lock()
+	defer h.records.mu.Unlock()
+
+	h.records.records = append(h.records.records, r)
+	return nil
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+	return &c
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.groups = append(append([]string{}, h.groups...), name)
+	return &c
+}
+
+func (h *logHandler) Records() []slog.Record {
+	h.records.mu.Lock()
+	defer h.records.mu.Unlock()
+
+	records := make([]slog.Record, len(h.records.records))
+	copy(records, h.records.records)
+
+	return records
+}
@@ -0,0 +1,148 @@
+// Package kpubsub instruments publishers and subscribers of any pub/sub
+// system with koko operations, propagating trace context through message
+// headers.
+//
+// Messages expose their headers as a propagation.TextMapCarrier. NATS and
+// Google Cloud Pub/Sub messages are adapted with NATS and PubSub:
+//
+//	msg := nats.NewMsg("orders.created")
+//	err := kpubsub.Publish(ctx, msg.Subject, kpubsub.NATS(msg.Header), func(ctx context.Context) error {
+//		return conn.PublishMsg(msg)
+//	}, kpubsub.WithSystem("nats"))
+package kpubsub
+
+import (
+	"context"
+
+	"github.com/kzs0/kokoro/koko"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultPublishOperation = "publish"
+	defaultReceiveOperation = "receive"
+)
+
+type pubsubOpts struct {
+	operation string
+	system    string
+	opOpts    []koko.OperationOption
+}
+
+type Option func(*pubsubOpts)
+
+// WithOperationName sets the name of the operation started for each message.
+// Defaults to publish or receive.
+func WithOperationName(name string) Option {
+	return func(opts *pubsubOpts) {
+		opts.operation = name
+	}
+}
+
+// WithSystem reports the messaging system on the span, e.g. nats or
+// gcp_pubsub
+func WithSystem(system string) Option {
+	return func(opts *pubsubOpts) {
+		opts.system = system
+	}
+}
+
+// WithOperationOptions applies additional options to the operations started
+func WithOperationOptions(opts ...koko.OperationOption) Option {
+	return func(o *pubsubOpts) {
+		o.opOpts = append(o.opOpts, opts...)
+	}
+}
+
+// Publish sends a message with publish within a producer operation, writing
+// the trace context to the headers of the message first. The destination is
+// reported as a label so it must be low cardinality, e.g. a subject without
+// identifiers.
+func Publish(ctx context.Context, destination string, headers propagation.TextMapCarrier, publish func(context.Context) error, opts ...Option) (err error) {
+	ctx, done := start(ctx, defaultPublishOperation, koko.SpanKindProducer, destination, opts)
+	defer done(&ctx, &err)
+
+	otel.GetTextMapPropagator().Inject(ctx, headers)
+
+	return publish(ctx)
+}
+
+// Receive processes a message with fn within a consumer operation continuing
+// the trace of the publisher. The destination should be the subscription, e.g.
+// a wildcard subject, so the label stays low cardinality.
+func Receive(ctx context.Context, destination string, headers propagation.TextMapCarrier, fn func(context.Context) error, opts ...Option) (err error) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, headers)
+
+	ctx, done := start(ctx, defaultReceiveOperation, koko.SpanKindConsumer, destination, opts)
+	defer done(&ctx, &err)
+
+	return fn(ctx)
+}
+
+// Subscriber returns a message handler that processes each message with
+// Receive, for clients that deliver messages to a callback
+func Subscriber[M any](destination string, headers func(M) propagation.TextMapCarrier, fn func(context.Context, M) error, opts ...Option) func(context.Context, M) error {
+	return func(ctx context.Context, msg M) error {
+		return Receive(ctx, destination, headers(msg), func(ctx context.Context) error {
+			return fn(ctx, msg)
+		}, opts...)
+	}
+}
+
+func start(ctx context.Context, operation string, kind trace.SpanKind, destination string, opts []Option) (context.Context, func(*context.Context, *error)) {
+	opt := pubsubOpts{operation: operation}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	opOpts := append([]koko.OperationOption{
+		koko.WithSpanKind(kind),
+		koko.WithLabels("destination"),
+	}, opt.opOpts...)
+
+	ctx, done := koko.Operation(ctx, opt.operation, opOpts...)
+
+	ctx = koko.Register(ctx, koko.Str("destination", destination))
+	if opt.system != "" {
+		ctx = koko.Register(ctx, koko.Str("messaging.system", opt.system, koko.TraceOnly()))
+	}
+
+	return ctx, done
+}
+
+// NATS adapts the headers of a NATS message, which must not be nil when
+// publishing
+func NATS[H ~map[string][]string](header H) propagation.TextMapCarrier {
+	return natsHeader(header)
+}
+
+type natsHeader map[string][]string
+
+func (h natsHeader) Get(key string) string {
+	if v := h[key]; len(v) > 0 {
+		return v[0]
+	}
+
+	return ""
+}
+
+func (h natsHeader) Set(key, value string) {
+	h[key] = []string{value}
+}
+
+func (h natsHeader) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+// PubSub adapts the attributes of a Google Cloud Pub/Sub message, which must
+// not be nil when publishing
+func PubSub[A ~map[string]string](attributes A) propagation.TextMapCarrier {
+	return propagation.MapCarrier(attributes)
+}
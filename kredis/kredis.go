@@ -0,0 +1,241 @@
+// Package kredis instruments Redis commands with koko operations without
+// depending on a particular client.
+//
+// Commands are described by Cmd, which go-redis commands already implement, so
+// a go-redis v9 hook is a thin adapter:
+//
+//	type hook struct{}
+//
+//	func (hook) DialHook(next redis.DialHook) redis.DialHook { return next }
+//
+//	func (hook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+//		return func(ctx context.Context, cmd redis.Cmder) error {
+//			return kredis.Process(ctx, cmd, func(ctx context.Context) error {
+//				return next(ctx, cmd)
+//			})
+//		}
+//	}
+//
+//	func (hook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+//		return func(ctx context.Context, cmds []redis.Cmder) error {
+//			return kredis.ProcessPipeline(ctx, cmds, func(ctx context.Context) error {
+//				return next(ctx, cmds)
+//			})
+//		}
+//	}
+package kredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kzs0/kokoro/internal/clock"
+	"github.com/kzs0/kokoro/kerr"
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+const (
+	defaultOperation    = "redis_command"
+	pipelineCommand     = "pipeline"
+	defaultPoolInterval = 10 * time.Second
+)
+
+// Cmd is a Redis command
+type Cmd interface {
+	// Name is the command name, e.g. get
+	Name() string
+	// Args are the command name followed by its arguments
+	Args() []interface{}
+}
+
+// redisNil is the message of the error go-redis returns when a key doesn't
+// exist
+const redisNil = "redis: nil"
+
+// secretCommands have every argument redacted from the statement
+var secretCommands = map[string]bool{
+	"auth":    true,
+	"hello":   true,
+	"migrate": true,
+}
+
+type redisOpts struct {
+	operation string
+	opOpts    []koko.OperationOption
+}
+
+type Option func(*redisOpts)
+
+// WithOperationName sets the name of the operation started for each command
+// or pipeline. Defaults to redis_command.
+func WithOperationName(name string) Option {
+	return func(opts *redisOpts) {
+		opts.operation = name
+	}
+}
+
+// WithOperationOptions applies additional options to the operations started
+func WithOperationOptions(opts ...koko.OperationOption) Option {
+	return func(o *redisOpts) {
+		o.opOpts = append(o.opOpts, opts...)
+	}
+}
+
+func options(opts []Option) redisOpts {
+	opt := redisOpts{operation: defaultOperation}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	return opt
+}
+
+// Process runs a command with next within a client operation labeled with the
+// command name. The statement is reported on the span with every argument but
+// the key replaced by ?, so values never reach the trace. A missing key is
+// reported as an expected kerr.NotFound outcome rather than a failure, the
+// error returned is the one next returned.
+func Process(ctx context.Context, cmd Cmd, next func(context.Context) error, opts ...Option) error {
+	opt := options(opts)
+
+	return run(ctx, opt, strings.ToLower(cmd.Name()), sanitize(cmd), 1, next)
+}
+
+// ProcessPipeline runs a pipeline of commands with next within a single
+// client operation labeled as pipeline, see Process
+func ProcessPipeline[C Cmd](ctx context.Context, cmds []C, next func(context.Context) error, opts ...Option) error {
+	opt := options(opts)
+
+	statements := make([]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		statements = append(statements, sanitize(cmd))
+	}
+
+	return run(ctx, opt, pipelineCommand, strings.Join(statements, "\n"), len(cmds), next)
+}
+
+func run(ctx context.Context, opt redisOpts, command, statement string, size int, next func(context.Context) error) error {
+	opOpts := append([]koko.OperationOption{
+		koko.WithSpanKind(koko.SpanKindClient),
+		koko.WithLabels("command"),
+	}, opt.opOpts...)
+
+	var err error
+	ctx, done := koko.Operation(ctx, opt.operation, opOpts...)
+	defer func() { done(&ctx, &err) }()
+
+	ctx = koko.Register(ctx,
+		koko.Str("db.system", "redis", koko.TraceOnly()),
+		koko.Str("command", command),
+		koko.Str("db.statement", statement, koko.TraceOnly()),
+	)
+	if command == pipelineCommand {
+		ctx = koko.Register(ctx, koko.Int64("pipeline_size", int64(size), koko.LogOnly(), koko.TraceOnly()))
+	}
+
+	cmdErr := next(ctx)
+	err = cmdErr
+	if cmdErr != nil && cmdErr.Error() == redisNil {
+		err = kerr.Wrap(cmdErr, kerr.NotFound)
+	}
+
+	return cmdErr
+}
+
+// sanitize formats the command with its key, replacing the remaining
+// arguments with ?
+func sanitize(cmd Cmd) string {
+	args := cmd.Args()
+	if len(args) == 0 {
+		return strings.ToLower(cmd.Name())
+	}
+
+	name := strings.ToLower(fmt.Sprint(args[0]))
+	parts := []string{name}
+	for i := range args[1:] {
+		if i == 0 && !secretCommands[name] {
+			parts = append(parts, fmt.Sprint(args[1]))
+			continue
+		}
+
+		parts = append(parts, "?")
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// PoolStats are the statistics of a connection pool, with the same fields as
+// the go-redis PoolStats
+type PoolStats struct {
+	Hits       uint32
+	Misses     uint32
+	Timeouts   uint32
+	TotalConns uint32
+	IdleConns  uint32
+	StaleConns uint32
+}
+
+// RecordPoolStats reports the statistics of the named pool as the
+// redis_pool_connections gauge, by state, and the redis_pool_hits,
+// redis_pool_misses, and redis_pool_timeouts gauges
+func RecordPoolStats(ctx context.Context, pool string, stats PoolStats) error {
+	conns, err := koko.Gauge("redis_pool_connections",
+		metrics.WithDescription("connections in the pool by state"),
+		metrics.WithLabelNames([]string{"pool", "state"}),
+	)
+	if err != nil {
+		return err
+	}
+
+	errs := []error{
+		conns.Measure(ctx, float64(stats.TotalConns), metrics.WithLabel("pool", pool), metrics.WithLabel("state", "total")),
+		conns.Measure(ctx, float64(stats.IdleConns), metrics.WithLabel("pool", pool), metrics.WithLabel("state", "idle")),
+		conns.Measure(ctx, float64(stats.StaleConns), metrics.WithLabel("pool", pool), metrics.WithLabel("state", "stale")),
+	}
+
+	for name, v := range map[string]uint32{
+		"redis_pool_hits":     stats.Hits,
+		"redis_pool_misses":   stats.Misses,
+		"redis_pool_timeouts": stats.Timeouts,
+	} {
+		gauge, err := koko.Gauge(name,
+			metrics.WithDescription("total connection pool "+strings.TrimPrefix(name, "redis_pool_")),
+			metrics.WithLabelNames([]string{"pool"}),
+		)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		errs = append(errs, gauge.Measure(ctx, float64(v), metrics.WithLabel("pool", pool)))
+	}
+
+	return errors.Join(errs...)
+}
+
+// WatchPool records the statistics of the named pool every interval, 10
+// seconds when it is not positive, until ctx is done, see RecordPoolStats
+func WatchPool(ctx context.Context, pool string, interval time.Duration, stats func() PoolStats) {
+	if interval <= 0 {
+		interval = defaultPoolInterval
+	}
+
+	go func() {
+		ticker := clock.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			_ = RecordPoolStats(ctx, pool, stats())
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+			}
+		}
+	}()
+}
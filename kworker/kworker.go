@@ -0,0 +1,143 @@
+// Package kworker instruments workflow engines and task queues, such as
+// Temporal, with koko operations without depending on a particular engine.
+//
+// Work is scheduled and executed at different times, possibly many times when
+// retried, so the span executing a task is linked to the span that scheduled
+// it rather than being its child. The scheduling side writes its trace context
+// to the task headers with Schedule, and the worker runs the task with
+// Execute.
+//
+// With Temporal, Execute is called from the worker interceptors, e.g. for
+// activities, where headerCarrier adapts the Temporal header map:
+//
+//	func (a *activityInbound) ExecuteActivity(ctx context.Context, in *interceptor.ExecuteActivityInput) (any, error) {
+//		info := activity.GetInfo(ctx)
+//		task := kworker.Task{
+//			Kind:     kworker.Activity,
+//			Workflow: info.WorkflowType.Name,
+//			Name:     info.ActivityType.Name,
+//			Queue:    info.TaskQueue,
+//			Attempt:  int(info.Attempt),
+//		}
+//
+//		var res any
+//		err := kworker.Execute(ctx, task, headerCarrier(interceptor.Header(ctx)), func(ctx context.Context) (err error) {
+//			res, err = a.Next.ExecuteActivity(ctx, in)
+//			return err
+//		})
+//
+//		return res, err
+//	}
+package kworker
+
+import (
+	"context"
+
+	"github.com/kzs0/kokoro/koko"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Kind is the kind of task a worker executes
+type Kind string
+
+const (
+	// Workflow tasks advance the state of a workflow
+	Workflow Kind = "workflow"
+	// Activity tasks perform the work of a workflow
+	Activity Kind = "activity"
+)
+
+// Task describes a task executed by a worker
+type Task struct {
+	Kind Kind
+	// Workflow is the type of the workflow the task belongs to
+	Workflow string
+	// Name is the type of the activity, or of the workflow for workflow tasks
+	Name string
+	// Queue is the task queue the task was polled from
+	Queue string
+	// Attempt counts the executions of the task, starting at 1
+	Attempt int
+}
+
+type workerOpts struct {
+	operation string
+	child     bool
+	opOpts    []koko.OperationOption
+}
+
+type Option func(*workerOpts)
+
+// WithOperationName sets the name of the operation started for each task.
+// Defaults to the kind of the task, e.g. activity.
+func WithOperationName(name string) Option {
+	return func(opts *workerOpts) {
+		opts.operation = name
+	}
+}
+
+// WithChildSpans executes tasks as children of the span that scheduled them
+// instead of linking them, so short lived workflows appear as a single trace
+func WithChildSpans() Option {
+	return func(opts *workerOpts) {
+		opts.child = true
+	}
+}
+
+// WithOperationOptions applies additional options to the operation started
+// for each task
+func WithOperationOptions(opts ...koko.OperationOption) Option {
+	return func(o *workerOpts) {
+		o.opOpts = append(o.opOpts, opts...)
+	}
+}
+
+// Schedule writes the trace context of ctx to the headers of a task being
+// scheduled, so its execution can be linked back to it
+func Schedule(ctx context.Context, headers propagation.TextMapCarrier) {
+	otel.GetTextMapPropagator().Inject(ctx, headers)
+}
+
+// Execute runs a task with fn within a consumer operation labeled with the
+// workflow type and the task name. The operation span is the root of a new
+// trace linked to the span that scheduled the task, unless WithChildSpans is
+// set, and retries are distinguished by the attempt attribute.
+func Execute(ctx context.Context, task Task, headers propagation.TextMapCarrier, fn func(context.Context) error, opts ...Option) (err error) {
+	opt := workerOpts{operation: string(task.Kind)}
+	for _, o := range opts {
+		o(&opt)
+	}
+	if opt.operation == "" {
+		opt.operation = "task"
+	}
+
+	ctx = otel.GetTextMapPropagator().Extract(ctx, headers)
+
+	opOpts := []koko.OperationOption{
+		koko.WithSpanKind(koko.SpanKindConsumer),
+		koko.WithLabels("workflow_type", "task"),
+	}
+	if !opt.child {
+		opOpts = append(opOpts,
+			koko.WithNewRoot(),
+			koko.WithLinks(trace.SpanContextFromContext(ctx)),
+		)
+	}
+	opOpts = append(opOpts, opt.opOpts...)
+
+	ctx, done := koko.Operation(ctx, opt.operation, opOpts...)
+	defer done(&ctx, &err)
+
+	ctx = koko.Register(ctx,
+		koko.Str("workflow_type", task.Workflow),
+		koko.Str("task", task.Name),
+		koko.Int64("attempt", int64(task.Attempt), koko.LogOnly(), koko.TraceOnly()),
+	)
+	if task.Queue != "" {
+		ctx = koko.Register(ctx, koko.Str("task_queue", task.Queue, koko.LogOnly(), koko.TraceOnly()))
+	}
+
+	return fn(ctx)
+}
@@ -0,0 +1,162 @@
+package kokoro
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/kzs0/kokoro/telemetry/metrics"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// cgroup v2 and v1 files describing the limits of the container the process
+// runs in
+const (
+	cgroupCPUMax      = "/sys/fs/cgroup/cpu.max"
+	cgroupMemoryMax   = "/sys/fs/cgroup/memory.max"
+	cgroupV1CPUQuota  = "/sys/fs/cgroup/cpu/cpu.cfs_quota_us"
+	cgroupV1CPUPeriod = "/sys/fs/cgroup/cpu/cpu.cfs_period_us"
+	cgroupV1Memory    = "/sys/fs/cgroup/memory/memory.limit_in_bytes"
+)
+
+// cgroupV1Unlimited is the smallest memory limit cgroup v1 reports when no
+// limit is set, the largest page aligned int64
+const cgroupV1Unlimited = math.MaxInt64 &^ (1<<12 - 1)
+
+// WithGOMAXPROCS sets GOMAXPROCS to the CPU limit of the container, rounded
+// up, unless the GOMAXPROCS environment variable is set
+func WithGOMAXPROCS() Option {
+	return func(o *options) {
+		o.maxProcs = true
+	}
+}
+
+// WithGOMEMLIMIT sets the soft memory limit to ratio of the memory limit of
+// the container, e.g. 0.9, unless the GOMEMLIMIT environment variable is set
+func WithGOMEMLIMIT(ratio float64) Option {
+	return func(o *options) {
+		o.memLimitRatio = ratio
+	}
+}
+
+// limits are the resources available to the container, zero when unlimited
+type limits struct {
+	cpu    float64
+	memory int64
+}
+
+func detectLimits() limits {
+	l := limits{}
+
+	if fields := strings.Fields(readCgroup(cgroupCPUMax)); len(fields) == 2 {
+		l.cpu = quota(fields[0], fields[1])
+	} else {
+		l.cpu = quota(readCgroup(cgroupV1CPUQuota), readCgroup(cgroupV1CPUPeriod))
+	}
+
+	if v := readCgroup(cgroupMemoryMax); v != "" {
+		l.memory, _ = strconv.ParseInt(v, 10, 64)
+	} else if v, err := strconv.ParseInt(readCgroup(cgroupV1Memory), 10, 64); err == nil && v < cgroupV1Unlimited {
+		l.memory = v
+	}
+
+	return l
+}
+
+func readCgroup(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(b))
+}
+
+// quota returns the number of CPUs a cgroup quota allows, zero when the quota
+// is max or -1
+func quota(q, period string) float64 {
+	qv, err := strconv.ParseFloat(q, 64)
+	if err != nil || qv <= 0 {
+		return 0
+	}
+
+	pv, err := strconv.ParseFloat(period, 64)
+	if err != nil || pv <= 0 {
+		return 0
+	}
+
+	return qv / pv
+}
+
+// tune applies the limits to the runtime as configured by the options
+func (l limits) tune(opt options) {
+	if opt.maxProcs && l.cpu > 0 && os.Getenv("GOMAXPROCS") == "" {
+		procs := int(math.Ceil(l.cpu))
+		prev := runtime.GOMAXPROCS(procs)
+
+		slog.Info("set GOMAXPROCS from cpu limit",
+			slog.Float64("cpu_limit", l.cpu), slog.Int("previous", prev), slog.Int("gomaxprocs", procs))
+	}
+
+	if opt.memLimitRatio > 0 && l.memory > 0 && os.Getenv("GOMEMLIMIT") == "" {
+		limit := int64(float64(l.memory) * opt.memLimitRatio)
+		debug.SetMemoryLimit(limit)
+
+		slog.Info("set GOMEMLIMIT from memory limit",
+			slog.Int64("memory_limit", l.memory), slog.Int64("gomemlimit", limit))
+	}
+}
+
+func (l limits) traceAttrs() []attribute.KeyValue {
+	attrs := []attribute.KeyValue{}
+	if l.cpu > 0 {
+		attrs = append(attrs, attribute.Float64("container.cpu.limit", l.cpu))
+	}
+	if l.memory > 0 {
+		attrs = append(attrs, attribute.Int64("container.memory.limit", l.memory))
+	}
+
+	return attrs
+}
+
+// record exports the detected limits, skipping those that are unlimited
+func (l limits) record(ctx context.Context) error {
+	if Default().Metrics() == nil {
+		return nil
+	}
+
+	if l.cpu > 0 {
+		gauge, err := Default().Metrics().NewGauge("cpu_limit_cores",
+			metrics.WithDescription("The CPU limit of the container"),
+		)
+		if err != nil {
+			return err
+		}
+
+		err = gauge.Measure(ctx, l.cpu)
+		if err != nil {
+			return err
+		}
+	}
+
+	if l.memory > 0 {
+		gauge, err := Default().Metrics().NewGauge("memory_limit_bytes",
+			metrics.WithDescription("The memory limit of the container"),
+		)
+		if err != nil {
+			return err
+		}
+
+		err = gauge.Measure(ctx, float64(l.memory))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
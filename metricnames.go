@@ -0,0 +1,71 @@
+package kokoro
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+const serviceVar = "{service}"
+
+// WithMetricNameTemplate names operation metrics after the template provided,
+// from the {service} name, the {operation} name, and the {signal}, e.g.
+// success or millis, to match an existing naming standard. Defaults to
+// {service}_{operation}_{signal}.
+//
+// When the template has no {operation}, e.g. operation_{signal}, operations
+// share their metrics and are told apart by the operation label. The service
+// may only lead or trail the template, and where it is placed, or its absence,
+// applies to every metric.
+func WithMetricNameTemplate(template string) Option {
+	return func(o *options) {
+		o.metricNameTemplate = template
+	}
+}
+
+// splitMetricNameTemplate splits a metric name template into the template of
+// the metrics factory, placing the service, and the template of operation
+// metrics
+func splitMetricNameTemplate(template string) (string, string, error) {
+	var factory, operation string
+	switch {
+	case template == "":
+		return "", "", nil
+	case strings.HasPrefix(template, serviceVar+"_"):
+		factory, operation = "{service}_{name}", strings.TrimPrefix(template, serviceVar+"_")
+	case strings.HasSuffix(template, "_"+serviceVar):
+		factory, operation = "{name}_{service}", strings.TrimSuffix(template, "_"+serviceVar)
+	case !strings.Contains(template, serviceVar):
+		factory, operation = "{name}", template
+	default:
+		return "", "", fmt.Errorf("metric name template %q must start or end with %s", template, serviceVar)
+	}
+
+	if strings.Contains(operation, serviceVar) {
+		return "", "", fmt.Errorf("metric name template %q has more than one %s", template, serviceVar)
+	}
+
+	return factory, operation, metrics.ValidateNameTemplate(factory)
+}
+
+// applyMetricNameTemplate configures operation metric names, returning the
+// option naming metrics created by the factory
+func applyMetricNameTemplate(template string) ([]metrics.FactoryOption, error) {
+	factory, operation, err := splitMetricNameTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+
+	err = koko.SetMetricNameTemplate(operation)
+	if err != nil {
+		return nil, err
+	}
+
+	if factory == "" {
+		return nil, nil
+	}
+
+	return []metrics.FactoryOption{metrics.WithNameTemplate(factory)}, nil
+}
@@ -0,0 +1,77 @@
+package kokoro
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kzs0/kokoro/env"
+)
+
+var ErrUnknownProfile = errors.New("unknown profile")
+
+// profiles hold the defaults applied by WithProfile, keyed by the environment
+// variable they stand in for
+var profiles = map[string]map[string]string{
+	"dev": {
+		"ENVIRONMENT":         "dev",
+		"LOG_LEVEL":           "DEBUG",
+		"PRETTY_LOGS":         "true",
+		"TRACES_EXPORTER":     "CONSOLE",
+		"TRACES_SAMPLE_RATIO": "1",
+	},
+	"staging": {
+		"ENVIRONMENT":         "staging",
+		"LOG_LEVEL":           "INFO",
+		"PRETTY_LOGS":         "false",
+		"TRACES_SAMPLE_RATIO": "0.5",
+	},
+	"prod": {
+		"ENVIRONMENT":         "prod",
+		"LOG_LEVEL":           "INFO",
+		"PRETTY_LOGS":         "false",
+		"TRACES_SAMPLE_RATIO": "0.1",
+	},
+}
+
+// WithProfile applies the defaults of an environment, one of dev, staging, or
+// prod. Dev logs prettily at debug and samples every trace, while staging and
+// prod log JSON and sample a ratio of traces. Variables set in the environment
+// take precedence over the profile, and the profile is ignored when a config
+// is provided with WithConfig.
+func WithProfile(name string) Option {
+	return func(o *options) {
+		o.profile = name
+	}
+}
+
+// profileEnvironment returns the environment to parse the config from, the
+// process environment layered over the variables of the env files, layered
+// over the defaults of the profile. The variables set by the env files are
+// returned along with it.
+func profileEnvironment(name string, files envFiles) (map[string]string, map[string]bool, error) {
+	environment := env.ToMap(os.Environ())
+
+	fromFiles, err := loadEnvFiles(environment, files)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if name == "" {
+		return environment, fromFiles, nil
+	}
+
+	defaults, ok := profiles[strings.ToLower(name)]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnknownProfile, name)
+	}
+
+	for k, v := range defaults {
+		if _, set := environment[k]; !set {
+			environment[k] = v
+		}
+	}
+
+	return environment, fromFiles, nil
+}
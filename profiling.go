@@ -0,0 +1,32 @@
+package kokoro
+
+import (
+	"strings"
+
+	"github.com/kzs0/kokoro/telemetry/profiling"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// WithProfiling continuously profiles the process, pushing profiles to pusher,
+// e.g. profiling.NewPyroscope. Profiles are labelled with the service name,
+// environment, and the attributes of the trace resource.
+func WithProfiling(pusher profiling.Pusher, opts ...profiling.Option) Option {
+	return func(o *options) {
+		o.profiler = pusher
+		o.profilingOpts = append(o.profilingOpts, opts...)
+	}
+}
+
+// profilingLabels converts resource attributes to profile labels, which use
+// underscores rather than dots
+func profilingLabels(service, environment string, attrs []attribute.KeyValue) map[string]string {
+	labels := map[string]string{
+		"service_name": service,
+		"environment":  environment,
+	}
+	for _, attr := range attrs {
+		labels[strings.ReplaceAll(string(attr.Key), ".", "_")] = attr.Value.Emit()
+	}
+
+	return labels
+}
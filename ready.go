@@ -0,0 +1,15 @@
+package kokoro
+
+import "github.com/kzs0/kokoro/health"
+
+// NotReady fails /readyz with the reason provided until SetReady is called,
+// holding traffic while e.g. caches warm or migrations run. Readiness checks
+// registered with the health package are still required to pass once ready.
+func NotReady(reason string) {
+	health.NotReady(reason)
+}
+
+// SetReady releases a hold placed by NotReady
+func SetReady() {
+	health.SetReady()
+}
@@ -0,0 +1,142 @@
+package kokoro
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+
+	"github.com/kzs0/kokoro/telemetry/logs"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+	"github.com/kzs0/kokoro/telemetry/traces"
+)
+
+var ErrReloadUnsupported = errors.New("config was not loaded from the environment")
+
+// dynamic lists the settings applied in place by Reload, any other changes
+// require a restart
+var dynamic = map[string]bool{
+	"LOG_LEVEL":             true,
+	"TRACES_SAMPLE_RATIO":   true,
+	"METRICS_STATIC_LABELS": true,
+}
+
+var loaded struct {
+	mu       sync.Mutex
+	fromEnv  bool
+	profile  string
+	envFiles envFiles
+	settings settings
+}
+
+// WithReloadOnSIGHUP reloads the config from the environment whenever the
+// process receives SIGHUP, see Reload
+func WithReloadOnSIGHUP() Option {
+	return func(o *options) {
+		o.reload = true
+	}
+}
+
+func watchReload(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(hup)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				err := Reload()
+				if err != nil {
+					slog.Error("failed to reload config", slog.String("error", err.Error()))
+				}
+			}
+		}
+	}()
+}
+
+// Reload parses the config from the environment again and applies the log
+// level, trace sample ratio, and static metric labels in place. Every setting
+// that changed is logged, including those that only take effect on restart.
+func Reload() error {
+	loaded.mu.Lock()
+	defer loaded.mu.Unlock()
+
+	if !loaded.fromEnv {
+		return ErrReloadUnsupported
+	}
+
+	config := Config{}
+	s, err := parseConfig(&config, loaded.profile, loaded.envFiles)
+	if err != nil {
+		return errors.Join(ErrEnvLoadFailed, err)
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return err
+	}
+
+	// settings overridden by Init options keep their values
+	for k, v := range loaded.settings {
+		if v.source == sourceOption {
+			s[k] = v
+		}
+	}
+
+	changed := make([]string, 0)
+	for k, v := range s {
+		if loaded.settings[k].value != v.value {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+
+	if len(changed) == 0 {
+		slog.Info("kokoro configuration reloaded, nothing changed")
+		return nil
+	}
+
+	var errs error
+	attrs := make([]any, 0, len(changed))
+	for _, k := range changed {
+		applied := dynamic[k]
+		switch k {
+		case "LOG_LEVEL":
+			errs = errors.Join(errs, logs.SetLevel(config.LogLevel))
+		case "TRACES_SAMPLE_RATIO":
+			traces.SetSampleRatio(config.SampleRatio)
+		case "METRICS_STATIC_LABELS":
+			labels, _ := metrics.ParseStaticLabels(config.StaticLabels)
+			if l, ok := Default().Metrics().(metrics.StaticLabeler); ok {
+				l.SetStaticLabels(labels)
+			} else {
+				applied = false
+			}
+		}
+
+		value, previous := s.redacted(k), loaded.settings.redacted(k)
+
+		attrs = append(attrs, slog.Group(k,
+			slog.String("previous", previous),
+			slog.String("value", value),
+			slog.Bool("applied", applied),
+		))
+	}
+
+	fingerprint, previous := s.fingerprint(), loaded.settings.fingerprint()
+	errs = errors.Join(errs, recordFingerprint(context.Background(), fingerprint, previous))
+	loaded.settings = s
+
+	attrs = append([]any{slog.String("fingerprint", fingerprint)}, attrs...)
+	slog.Info("kokoro configuration reloaded", attrs...)
+
+	return errs
+}
@@ -0,0 +1,14 @@
+package kokoro
+
+import (
+	"context"
+
+	"github.com/kzs0/kokoro/koko"
+)
+
+// RequestID returns the request ID of ctx, generating one and storing it in
+// the returned context when ctx has none. The ID is propagated as baggage and
+// registered on the logs and spans of every operation, see koko.RequestID.
+func RequestID(ctx context.Context) (context.Context, string) {
+	return koko.RequestID(ctx)
+}
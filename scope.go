@@ -0,0 +1,29 @@
+package kokoro
+
+import (
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+// WithInstrumentationScope attributes spans and metrics to the
+// instrumentation scope provided, e.g. the service, instead of kokoro, in
+// backends that display it. Single operations can be attributed to another
+// scope with koko.WithInstrumentationScope.
+func WithInstrumentationScope(name, version string) Option {
+	return func(o *options) {
+		o.scopeName = name
+		o.scopeVersion = version
+	}
+}
+
+// applyInstrumentationScope sets the scope of operation spans, returning the
+// option setting the scope of metrics
+func applyInstrumentationScope(name, version string) []metrics.FactoryOption {
+	if name == "" {
+		return nil
+	}
+
+	koko.SetInstrumentationScope(name, version)
+
+	return []metrics.FactoryOption{metrics.WithScope(name, version)}
+}
@@ -0,0 +1,288 @@
+package kokoro
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/kzs0/kokoro/internal/clock"
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+	"github.com/kzs0/kokoro/telemetry/traces"
+	prom "github.com/prometheus/client_golang/prometheus"
+	api "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	defaultSelfTestRate  = 10
+	defaultSelfTestCalls = 10
+)
+
+// SelfTestTarget is an operation exercised by SelfTest
+type SelfTestTarget struct {
+	// Name is the name of the operation
+	Name string
+	// Run is called within the operation, which does nothing when it is nil
+	Run func(ctx context.Context) error
+	// Rate is the number of calls started per second. Defaults to 10.
+	Rate float64
+	// Calls is the number of calls made. Defaults to 10.
+	Calls int
+}
+
+// SelfTestResult is the telemetry produced by the calls to a target
+type SelfTestResult struct {
+	Operation string
+	Calls     int
+	Failures  int
+	// Spans is the number of spans of the operation which ended
+	Spans int
+	// Logs is the number of logs of the operation which were written
+	Logs int
+	// Metrics is the increase of the count metric of the operation
+	Metrics float64
+}
+
+// SelfTest exercises each target at its rate, then verifies that every call
+// produced a span, a log, and a measurement of the operation metrics, and that
+// the spans and metrics could be exported. Only the signals enabled by Init
+// are verified. It is meant for CI and canary deployments, validating the
+// telemetry pipeline end to end.
+//
+// The operations are always sampled and logged at INFO so they are not
+// filtered out. Failures of the calls themselves are counted without failing
+// the self test.
+func SelfTest(ctx context.Context, targets ...SelfTestTarget) ([]SelfTestResult, error) {
+	loaded.mu.Lock()
+	s := loaded.settings
+	loaded.mu.Unlock()
+
+	if s == nil {
+		return nil, errors.New("failed to self test: kokoro has not been initialized")
+	}
+	// a signal is off when its ENABLED setting is false or DISABLED is true
+	disabled := func(signal string) bool {
+		return s[signal+"_ENABLED"].value == "false" || s[signal+"_DISABLED"].value == "true"
+	}
+
+	names := make(map[string]bool, len(targets))
+	for _, t := range targets {
+		names[t.Name] = true
+	}
+
+	spans := &spanCounter{names: names, counts: make(map[string]int)}
+	unregister, tracing := traces.RegisterProcessor(spans)
+	defer unregister()
+
+	logCounts := &logCounter{names: names, counts: make(map[string]int)}
+	ctx = koko.WithTelemetry(ctx, koko.Telemetry{
+		Logger: slog.New(&countingHandler{Handler: Default().Logger().Handler(), counter: logCounts}),
+	})
+
+	before := make(map[string]float64, len(targets))
+	for _, t := range targets {
+		before[t.Name] = operationCount(t.Name)
+	}
+
+	results := make([]SelfTestResult, 0, len(targets))
+	for _, t := range targets {
+		calls, failures := exercise(ctx, t)
+		results = append(results, SelfTestResult{Operation: t.Name, Calls: calls, Failures: failures})
+	}
+
+	errs := koko.FlushAsync(ctx)
+	if tracing {
+		errs = errors.Join(errs, traces.Flush(ctx))
+	}
+	errs = errors.Join(errs, metrics.Flush(ctx))
+
+	for i := range results {
+		r := &results[i]
+		r.Spans = spans.count(r.Operation)
+		r.Logs = logCounts.count(r.Operation)
+		r.Metrics = operationCount(r.Operation) - before[r.Operation]
+
+		if tracing && r.Spans < r.Calls {
+			errs = errors.Join(errs, fmt.Errorf("%s produced %d spans for %d calls", r.Operation, r.Spans, r.Calls))
+		}
+		if !disabled("LOGS") && r.Logs < r.Calls {
+			errs = errors.Join(errs, fmt.Errorf("%s produced %d logs for %d calls", r.Operation, r.Logs, r.Calls))
+		}
+		if !disabled("METRICS") && r.Metrics < float64(r.Calls) {
+			errs = errors.Join(errs, fmt.Errorf("%s counted %v calls of %d", r.Operation, r.Metrics, r.Calls))
+		}
+	}
+
+	if errs != nil {
+		return results, fmt.Errorf("self test failed: %w", errs)
+	}
+
+	return results, nil
+}
+
+// exercise calls the target at its rate, returning the number of calls made
+// and how many of them failed
+func exercise(ctx context.Context, t SelfTestTarget) (int, int) {
+	rate, calls := t.Rate, t.Calls
+	if rate <= 0 {
+		rate = defaultSelfTestRate
+	}
+	if calls <= 0 {
+		calls = defaultSelfTestCalls
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		made     int
+		failures int
+	)
+
+	ticker := clock.NewTicker(time.Duration(float64(time.Second) / rate))
+	defer ticker.Stop()
+
+	for i := 0; i < calls; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				wg.Wait()
+				return made, failures
+			case <-ticker.C():
+			}
+		}
+
+		made++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := call(ctx, t)
+			if err != nil {
+				mu.Lock()
+				failures++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return made, failures
+}
+
+func call(ctx context.Context, t SelfTestTarget) (err error) {
+	ctx, done := koko.Operation(ctx, t.Name, koko.WithAlwaysSample(), koko.WithLevel("INFO"), koko.WithRecover())
+	defer done(&ctx, &err)
+
+	if t.Run == nil {
+		return nil
+	}
+
+	return t.Run(ctx)
+}
+
+// operationCount sums the count metric of the operation as exported to
+// prometheus
+func operationCount(operation string) float64 {
+	name, labels := koko.OperationMetric(operation, "count")
+	if n, ok := Default().Metrics().(metrics.Namer); ok {
+		name = n.Name(name)
+	}
+
+	families, err := prom.DefaultGatherer.Gather()
+	if err != nil {
+		return 0
+	}
+
+	var total float64
+	for _, f := range families {
+		if f.GetName() != name && f.GetName() != name+"_total" {
+			continue
+		}
+
+		for _, m := range f.GetMetric() {
+			matched := 0
+			for _, l := range m.GetLabel() {
+				if v, ok := labels[l.GetName()]; ok && v == l.GetValue() {
+					matched++
+				}
+			}
+			if matched == len(labels) {
+				total += m.GetCounter().GetValue()
+			}
+		}
+	}
+
+	return total
+}
+
+// spanCounter counts the spans of the self tested operations which end
+type spanCounter struct {
+	names map[string]bool
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *spanCounter) OnStart(context.Context, api.ReadWriteSpan) {}
+
+func (c *spanCounter) OnEnd(s api.ReadOnlySpan) {
+	if !c.names[s.Name()] {
+		return
+	}
+
+	c.mu.Lock()
+	c.counts[s.Name()]++
+	c.mu.Unlock()
+}
+
+func (c *spanCounter) Shutdown(context.Context) error   { return nil }
+func (c *spanCounter) ForceFlush(context.Context) error { return nil }
+
+func (c *spanCounter) count(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.counts[name]
+}
+
+// logCounter counts the logs of the self tested operations which are written
+type logCounter struct {
+	names map[string]bool
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *logCounter) count(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.counts[name]
+}
+
+type countingHandler struct {
+	slog.Handler
+	counter *logCounter
+}
+
+func (h *countingHandler) Handle(ctx context.Context, r slog.Record) error {
+	err := h.Handler.Handle(ctx, r)
+	if err == nil && h.counter.names[r.Message] {
+		h.counter.mu.Lock()
+		h.counter.counts[r.Message]++
+		h.counter.mu.Unlock()
+	}
+
+	return err
+}
+
+func (h *countingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &countingHandler{Handler: h.Handler.WithAttrs(attrs), counter: h.counter}
+}
+
+func (h *countingHandler) WithGroup(name string) slog.Handler {
+	return &countingHandler{Handler: h.Handler.WithGroup(name), counter: h.counter}
+}
@@ -0,0 +1,140 @@
+package kokoro
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/kzs0/kokoro/khttp"
+)
+
+const (
+	defaultServeAddr    = ":8080"
+	defaultDrainTimeout = 30 * time.Second
+)
+
+type serveOpts struct {
+	addr         string
+	certFile     string
+	keyFile      string
+	tlsConfig    *tls.Config
+	drainTimeout time.Duration
+	middleware   []khttp.Option
+}
+
+type ServeOption func(*serveOpts)
+
+// WithAddr sets the address the server listens on. Defaults to :8080.
+func WithAddr(addr string) ServeOption {
+	return func(opts *serveOpts) {
+		opts.addr = addr
+	}
+}
+
+// WithTLS serves HTTPS using the certificate and key files provided
+func WithTLS(certFile, keyFile string) ServeOption {
+	return func(opts *serveOpts) {
+		opts.certFile = certFile
+		opts.keyFile = keyFile
+	}
+}
+
+// WithTLSConfig serves HTTPS using the TLS config provided, which must
+// include the certificates unless WithTLS is also provided
+func WithTLSConfig(config *tls.Config) ServeOption {
+	return func(opts *serveOpts) {
+		opts.tlsConfig = config
+	}
+}
+
+// WithDrainTimeout bounds how long requests in flight are given to complete
+// once the server starts shutting down. Defaults to 30 seconds.
+func WithDrainTimeout(d time.Duration) ServeOption {
+	return func(opts *serveOpts) {
+		opts.drainTimeout = d
+	}
+}
+
+// WithMiddlewareOptions configures the khttp middleware wrapping the handler
+func WithMiddlewareOptions(opts ...khttp.Option) ServeOption {
+	return func(o *serveOpts) {
+		o.middleware = append(o.middleware, opts...)
+	}
+}
+
+// Serve serves handler wrapped in the khttp middleware until ctx is done,
+// then stops accepting connections and drains the requests in flight. Using
+// the context returned by Init with signal handling enabled drains the server
+// on SIGINT or SIGTERM.
+//
+// Serve returns nil once the server has drained, or the error that stopped
+// it.
+func Serve(ctx context.Context, handler http.Handler, opts ...ServeOption) error {
+	opt := serveOpts{
+		addr:         defaultServeAddr,
+		drainTimeout: defaultDrainTimeout,
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	server := &http.Server{
+		Addr:              opt.addr,
+		Handler:           khttp.Middleware(handler, opt.middleware...),
+		TLSConfig:         opt.tlsConfig,
+		ReadHeaderTimeout: 5 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return context.WithoutCancel(ctx)
+		},
+	}
+
+	listener, err := net.Listen("tcp", opt.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", opt.addr, err)
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		if opt.tlsConfig != nil || opt.certFile != "" {
+			served <- server.ServeTLS(listener, opt.certFile, opt.keyFile)
+			return
+		}
+
+		served <- server.Serve(listener)
+	}()
+
+	slog.Info("serving http", slog.String("addr", listener.Addr().String()))
+
+	select {
+	case err := <-served:
+		return fmt.Errorf("failed while serving http: %w", err)
+	case <-ctx.Done():
+	}
+
+	slog.Info("draining http server",
+		slog.Int64("in_flight", khttp.InFlight()), slog.Duration("timeout", opt.drainTimeout))
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), opt.drainTimeout)
+	defer cancel()
+
+	err = server.Shutdown(drainCtx)
+	if err != nil {
+		slog.Warn("http server did not drain in time",
+			slog.Int64("in_flight", khttp.InFlight()), slog.String("error", err.Error()))
+
+		return errors.Join(fmt.Errorf("failed to drain http server: %w", err), server.Close())
+	}
+
+	err = <-served
+	if !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed while serving http: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package kokoro
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kzs0/kokoro/koko"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+	"github.com/kzs0/kokoro/telemetry/traces"
+)
+
+type shutdownHook struct {
+	name     string
+	fn       func(context.Context) error
+	priority int
+	timeout  time.Duration
+	seq      int
+}
+
+type shutdownOpts struct {
+	priority int
+	timeout  time.Duration
+}
+
+type ShutdownOption func(*shutdownOpts)
+
+// WithPriority orders the hook relative to the others. Hooks with a lower
+// priority run first, hooks sharing a priority run in the order they were
+// registered. Defaults to 0.
+func WithPriority(priority int) ShutdownOption {
+	return func(opts *shutdownOpts) {
+		opts.priority = priority
+	}
+}
+
+// WithTimeout bounds how long the hook may run. The hook is always bounded by
+// what remains of the grace period.
+func WithTimeout(d time.Duration) ShutdownOption {
+	return func(opts *shutdownOpts) {
+		opts.timeout = d
+	}
+}
+
+var shutdownHooks struct {
+	mu    sync.Mutex
+	hooks []shutdownHook
+}
+
+// OnShutdown registers fn to be called when the application shuts down, either
+// through Done or on receipt of a signal when signal handling is enabled.
+// Telemetry is flushed once every hook has completed, so hooks may still
+// record operations while draining. A fifth of the grace period, up to 2
+// seconds, is reserved for the flush, so hooks are cancelled before it ends.
+// Each hook runs once, by the first shutdown after it is registered.
+func OnShutdown(name string, fn func(ctx context.Context) error, opts ...ShutdownOption) {
+	opt := shutdownOpts{}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	shutdownHooks.mu.Lock()
+	defer shutdownHooks.mu.Unlock()
+
+	shutdownHooks.hooks = append(shutdownHooks.hooks, shutdownHook{
+		name:     name,
+		fn:       fn,
+		priority: opt.priority,
+		timeout:  opt.timeout,
+		seq:      len(shutdownHooks.hooks),
+	})
+}
+
+// takeShutdownHooks returns the registered hooks in the order they run and
+// clears them, so they run once rather than again when a later instance,
+// e.g. one started by Reinit, shuts down
+func takeShutdownHooks() []shutdownHook {
+	shutdownHooks.mu.Lock()
+	defer shutdownHooks.mu.Unlock()
+
+	hs := shutdownHooks.hooks
+	shutdownHooks.hooks = nil
+
+	sort.SliceStable(hs, func(i, j int) bool {
+		return hs[i].priority < hs[j].priority
+	})
+
+	return hs
+}
+
+func (h shutdownHook) run(ctx context.Context) (err error) {
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("shutdown hook %q panicked: %v", h.name, r)
+		}
+	}()
+
+	err = h.fn(ctx)
+	if err != nil {
+		return fmt.Errorf("shutdown hook %q failed: %w", h.name, err)
+	}
+
+	return nil
+}
+
+// flushReserve is the share of the time left to shut down reserved for
+// flushing telemetry, so slow hooks can't leave buffered spans unexported
+const (
+	flushReserve    = 0.2
+	maxFlushReserve = 2 * time.Second
+)
+
+// shutdown runs every registered hook in order, then the closers for the
+// servers started by Init, and finally flushes and stops traces and metrics,
+// giving up once ctx is done. The hooks and closers must complete before the
+// time reserved for flushing, see flushReserve. Operations completed
+// asynchronously are completed first so their metrics are flushed, and logs
+// are written synchronously so there is nothing left to flush.
+func shutdown(ctx context.Context, closers ...func(context.Context) error) error {
+	drainCtx := ctx
+	if deadline, ok := ctx.Deadline(); ok {
+		reserve := min(time.Duration(float64(time.Until(deadline))*flushReserve), maxFlushReserve)
+
+		var cancel context.CancelFunc
+		drainCtx, cancel = context.WithDeadline(ctx, deadline.Add(-reserve))
+		defer cancel()
+	}
+
+	var errs error
+	for _, h := range takeShutdownHooks() {
+		err := h.run(drainCtx)
+		if err != nil {
+			errs = errors.Join(errs, err)
+		}
+	}
+
+	return errors.Join(errs, closeAll(drainCtx, closers), stopTelemetry(ctx))
+}
+
+// closeAll runs the closers for the servers and loops started by Init
+func closeAll(ctx context.Context, closers []func(context.Context) error) error {
+	var errs error
+	for _, closer := range closers {
+		errs = errors.Join(errs, closer(ctx))
+	}
+
+	return errs
+}
+
+// stopTelemetry flushes and stops traces and metrics, along with the metrics
+// server
+func stopTelemetry(ctx context.Context) error {
+	return errors.Join(
+		koko.FlushAsync(ctx),
+		traces.Flush(ctx),
+		metrics.Flush(ctx),
+		traces.Shutdown(ctx),
+		metrics.Shutdown(ctx),
+	)
+}
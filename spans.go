@@ -0,0 +1,32 @@
+package kokoro
+
+import (
+	"github.com/kzs0/kokoro/telemetry/traces"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// WithSpanExporter exports spans to an additional destination, e.g. an OTLP
+// exporter, alongside the exporter configured by TRACES_EXPORTER. Only the
+// spans passing every filter are exported to it.
+func WithSpanExporter(exporter sdktrace.SpanExporter, filters ...traces.Filter) Option {
+	return func(o *options) {
+		o.tracesOpts = append(o.tracesOpts, traces.WithExporter(exporter, filters...))
+	}
+}
+
+// WithSpanFilter only exports the spans passing every filter to the exporter
+// configured by TRACES_EXPORTER, e.g. traces.ErrorsOnly to only print failures
+// to the console while WithSpanExporter sends every span elsewhere
+func WithSpanFilter(filters ...traces.Filter) Option {
+	return func(o *options) {
+		o.tracesOpts = append(o.tracesOpts, traces.WithExporterFilter(filters...))
+	}
+}
+
+// WithSampler samples spans with the sampler provided instead of the one
+// configured by TRACES_SAMPLER, e.g. to combine samplers
+func WithSampler(sampler sdktrace.Sampler) Option {
+	return func(o *options) {
+		o.tracesOpts = append(o.tracesOpts, traces.WithSampler(sampler))
+	}
+}
@@ -0,0 +1,168 @@
+package kokoro
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kzs0/kokoro/internal/clock"
+	"github.com/kzs0/kokoro/koko"
+)
+
+// TaskGroup runs background goroutines which are waited on when the
+// application shuts down, see NewTaskGroup
+type TaskGroup struct {
+	name string
+
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	next    uint64
+	running map[uint64]*task
+}
+
+type task struct {
+	name      string
+	started   time.Time
+	goroutine string
+}
+
+// NewTaskGroup creates a group of background tasks which Done waits on while
+// shutting down, as a shutdown hook. Tasks run within the context returned by
+// Init, so they should return once it is canceled. Tasks still running when
+// the time to shut down runs out are logged as stuck along with their stacks.
+func NewTaskGroup(name string, opts ...ShutdownOption) *TaskGroup {
+	g := &TaskGroup{
+		name:    name,
+		running: make(map[uint64]*task),
+	}
+
+	OnShutdown(fmt.Sprintf("task group %s", name), g.Wait, opts...)
+
+	return g
+}
+
+// Go runs fn in a goroutine as an operation of the name provided, derived
+// from the context returned by Init. A panic of fn is recovered and reported
+// as the failure of the operation, see koko.WithRecover.
+func (g *TaskGroup) Go(name string, fn func(ctx context.Context) error) {
+	g.mu.Lock()
+	id := g.next
+	g.next++
+	t := &task{name: name, started: clock.Now()}
+	g.running[id] = t
+	g.mu.Unlock()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer g.finish(id)
+
+		g.mu.Lock()
+		t.goroutine = goroutineID()
+		g.mu.Unlock()
+
+		_ = g.run(name, fn)
+	}()
+}
+
+func (g *TaskGroup) run(name string, fn func(ctx context.Context) error) (err error) {
+	ctx, done := koko.Background(name, koko.WithRecover())
+	defer done(&ctx, &err)
+
+	ctx = koko.Register(ctx, koko.Str("task_group", g.name, koko.LogOnly(), koko.TraceOnly()))
+
+	return fn(ctx)
+}
+
+func (g *TaskGroup) finish(id uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.running, id)
+}
+
+// Wait blocks until every task has returned, or until ctx is done, in which
+// case the tasks still running are logged along with their stacks and an
+// error is returned
+func (g *TaskGroup) Wait(ctx context.Context) error {
+	finished := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+	}
+
+	g.mu.Lock()
+	stuck := make([]task, 0, len(g.running))
+	for _, t := range g.running {
+		stuck = append(stuck, *t)
+	}
+	g.mu.Unlock()
+
+	if len(stuck) == 0 {
+		return nil
+	}
+
+	stacks := goroutineStacks()
+	for _, t := range stuck {
+		slog.Warn("task did not finish before shutdown",
+			slog.String("task_group", g.name),
+			slog.String("task", t.name),
+			slog.Duration("running", clock.Since(t.started)),
+			slog.String("stack", stacks[t.goroutine]))
+	}
+
+	return fmt.Errorf("%d tasks of group %s did not finish: %w", len(stuck), g.name, ctx.Err())
+}
+
+// goroutineID returns the id of the calling goroutine as it appears in stack
+// traces
+func goroutineID() string {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+
+	// the trace starts with "goroutine <id> [running]:"
+	fields := bytes.Fields(buf)
+	if len(fields) < 2 {
+		return ""
+	}
+	if _, err := strconv.ParseUint(string(fields[1]), 10, 64); err != nil {
+		return ""
+	}
+
+	return string(fields[1])
+}
+
+// goroutineStacks returns the stack of every goroutine by id
+func goroutineStacks() map[string]string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	stacks := make(map[string]string)
+	for _, trace := range bytes.Split(buf, []byte("\n\n")) {
+		fields := bytes.Fields(trace)
+		if len(fields) < 2 {
+			continue
+		}
+		stacks[string(fields[1])] = string(trace)
+	}
+
+	return stacks
+}
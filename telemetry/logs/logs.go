@@ -4,17 +4,28 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
 	"strings"
 )
 
 type Logs struct {
+	// Enabled turns logs off when false, leaving it unset keeps them on
+	Enabled     *bool  `env:"LOGS_ENABLED"`
+	Disabled    bool   `env:"LOGS_DISABLED" envDefault:"false"`
 	LogLevel    string `env:"LOG_LEVEL" envDefault:"INFO"`
 	Pretty      bool   `env:"PRETTY_LOGS" envDefault:"false"`
 	ServiceName string `env:"SERVICE_NAME" envDefault:"_"`
 	Environment string `env:"ENVIRONMENT" envDefault:"dev"`
+	// SpanEvents mirrors records of WARN and above logged within a span as
+	// events of the span, see SpanEventHandler
+	SpanEvents bool `env:"LOGS_SPAN_EVENTS" envDefault:"false"`
 }
 
+// level is shared by every handler created by Init so it can be changed while
+// the process is running
+var level slog.LevelVar
+
 var (
 	ErrInitFailed  = errors.New("failed to initialize logs")
 	ErrBadLogLevel = errors.New("invalid log level")
@@ -24,16 +35,13 @@ var (
 // The string is trimmed of whitespaced and converted to uppercase
 func ParseLevel(level string) (slog.Level, error) {
 	switch strings.TrimSpace(strings.ToUpper(level)) {
-	case "TRACE":
-	case "DEBUG":
+	case "TRACE", "DEBUG":
 		return slog.LevelDebug, nil
 	case "INFO":
 		return slog.LevelInfo, nil
 	case "WARN":
 		return slog.LevelWarn, nil
-	case "ERROR":
-	case "FATAL":
-	case "PANIC":
+	case "ERROR", "FATAL", "PANIC":
 		return slog.LevelError, nil
 	default:
 	}
@@ -42,13 +50,55 @@ func ParseLevel(level string) (slog.Level, error) {
 	return slog.LevelInfo, errors.Join(ErrBadLogLevel, err)
 }
 
-func Init(config Logs) error {
-	level, err := ParseLevel(config.LogLevel)
+type logOpts struct {
+	attrs          []slog.Attr
+	spanEvents     bool
+	spanEventLevel slog.Level
+}
+
+type Option func(*logOpts)
+
+// WithAttributes adds attributes to every log written by the default logger
+func WithAttributes(attrs ...slog.Attr) Option {
+	return func(opts *logOpts) {
+		opts.attrs = append(opts.attrs, attrs...)
+	}
+}
+
+// WithSpanEvents mirrors records of at least level logged within a span as
+// events of the span, like LOGS_SPAN_EVENTS does for WARN
+func WithSpanEvents(level slog.Level) Option {
+	return func(opts *logOpts) {
+		opts.spanEvents = true
+		opts.spanEventLevel = level
+	}
+}
+
+// IsEnabled reports whether logs are turned on, which they are unless Enabled
+// is false or Disabled is set
+func (config Logs) IsEnabled() bool {
+	return !config.Disabled && (config.Enabled == nil || *config.Enabled)
+}
+
+// Validate reports whether the config can be used to initialize logs
+func (config Logs) Validate() error {
+	_, err := ParseLevel(config.LogLevel)
+	return err
+}
+
+func Init(config Logs, options ...Option) error {
+	opt := logOpts{spanEventLevel: slog.LevelWarn}
+	for _, o := range options {
+		o(&opt)
+	}
+
+	lvl, err := ParseLevel(config.LogLevel)
 	if err != nil {
 		return errors.Join(ErrInitFailed, err)
 	}
+	level.Set(lvl)
 
-	opts := slog.HandlerOptions{AddSource: true}
+	opts := slog.HandlerOptions{AddSource: true, Level: &level}
 	var handler slog.Handler = slog.NewJSONHandler(os.Stdout, &opts)
 
 	if config.Pretty {
@@ -59,12 +109,58 @@ func Init(config Logs) error {
 		slog.String("environment", config.Environment),
 		slog.String("service", config.ServiceName),
 	}
+	defaultAttrs = append(defaultAttrs, opt.attrs...)
 
 	handler = handler.WithAttrs(defaultAttrs)
+	if config.SpanEvents || opt.spanEvents {
+		handler = SpanEventHandler(handler, opt.spanEventLevel)
+	}
 	logger := slog.New(handler)
 
-	slog.SetLogLoggerLevel(level)
+	slog.SetLogLoggerLevel(lvl)
 	slog.SetDefault(logger)
 
 	return nil
 }
+
+// Level returns the minimum level logged by the handlers created by Init
+func Level() slog.Level {
+	return level.Level()
+}
+
+// SetLevel changes the minimum level logged by the handlers created by Init
+func SetLevel(l string) error {
+	lvl, err := ParseLevel(l)
+	if err != nil {
+		return err
+	}
+
+	level.Set(lvl)
+	slog.SetLogLoggerLevel(lvl)
+
+	return nil
+}
+
+// LevelHandler reports the current log level on GET and changes it on PUT or
+// POST, reading the new level from the level query parameter
+func LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			err := SetLevel(r.URL.Query().Get("level"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			slog.Info("log level changed", slog.String("level", Level().String()))
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		fmt.Fprintln(w, Level().String())
+	})
+}
@@ -0,0 +1,123 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanEventHandler mirrors the records of at least its level which are logged
+// within a recording span as events of the span, carrying the message and the
+// attributes of the record
+type spanEventHandler struct {
+	slog.Handler
+	min    slog.Level
+	attrs  []attribute.KeyValue
+	prefix string
+}
+
+// SpanEventHandler wraps handler so records of at least level logged within a
+// recording span are also added to the span as events. Records below the
+// level of handler are mirrored without being logged.
+func SpanEventHandler(handler slog.Handler, level slog.Level) slog.Handler {
+	return &spanEventHandler{Handler: handler, min: level}
+}
+
+func (h *spanEventHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return h.Handler.Enabled(ctx, l) || h.mirrors(ctx, l)
+}
+
+func (h *spanEventHandler) mirrors(ctx context.Context, l slog.Level) bool {
+	return l >= h.min && trace.SpanFromContext(ctx).IsRecording()
+}
+
+func (h *spanEventHandler) Handle(ctx context.Context, r slog.Record) error {
+	if h.mirrors(ctx, r.Level) {
+		attrs := make([]attribute.KeyValue, 0, len(h.attrs)+r.NumAttrs()+1)
+		attrs = append(attrs, attribute.String("level", r.Level.String()))
+		attrs = append(attrs, h.attrs...)
+		r.Attrs(func(a slog.Attr) bool {
+			attrs = appendAttr(attrs, h.prefix, a)
+			return true
+		})
+
+		opts := []trace.EventOption{trace.WithAttributes(attrs...)}
+		if !r.Time.IsZero() {
+			opts = append(opts, trace.WithTimestamp(r.Time))
+		}
+
+		trace.SpanFromContext(ctx).AddEvent(r.Message, opts...)
+	}
+
+	if !h.Handler.Enabled(ctx, r.Level) {
+		return nil
+	}
+
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *spanEventHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.Handler = h.Handler.WithAttrs(attrs)
+	c.attrs = make([]attribute.KeyValue, 0, len(h.attrs)+len(attrs))
+	c.attrs = append(c.attrs, h.attrs...)
+	for _, a := range attrs {
+		c.attrs = appendAttr(c.attrs, h.prefix, a)
+	}
+
+	return &c
+}
+
+func (h *spanEventHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	c := *h
+	c.Handler = h.Handler.WithGroup(name)
+	c.prefix = h.prefix + name + "."
+
+	return &c
+}
+
+// appendAttr converts a to span attributes, flattening groups into keys
+// joined by dots
+func appendAttr(attrs []attribute.KeyValue, prefix string, a slog.Attr) []attribute.KeyValue {
+	v := a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return attrs
+	}
+
+	key := prefix + a.Key
+	switch v.Kind() {
+	case slog.KindGroup:
+		groupPrefix := prefix
+		if a.Key != "" {
+			groupPrefix = key + "."
+		}
+		for _, ga := range v.Group() {
+			attrs = appendAttr(attrs, groupPrefix, ga)
+		}
+		return attrs
+	case slog.KindString:
+		return append(attrs, attribute.String(key, v.String()))
+	case slog.KindInt64:
+		return append(attrs, attribute.Int64(key, v.Int64()))
+	case slog.KindUint64:
+		return append(attrs, attribute.Int64(key, int64(v.Uint64())))
+	case slog.KindFloat64:
+		return append(attrs, attribute.Float64(key, v.Float64()))
+	case slog.KindBool:
+		return append(attrs, attribute.Bool(key, v.Bool()))
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return append(attrs, attribute.String(key, err.Error()))
+		}
+		return append(attrs, attribute.String(key, fmt.Sprint(v.Any())))
+	default:
+		return append(attrs, attribute.String(key, v.String()))
+	}
+}
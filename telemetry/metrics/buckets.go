@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseOperationBuckets parses histogram bucket boundaries per operation,
+// formatted as op1=b1,b2,b3;op2=b1,b2. The boundaries of each operation must
+// be increasing.
+func ParseOperationBuckets(buckets string) (map[string][]float64, error) {
+	parsed := make(map[string][]float64)
+	if strings.TrimSpace(buckets) == "" {
+		return parsed, nil
+	}
+
+	for _, entry := range strings.Split(buckets, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		op, bounds, ok := strings.Cut(entry, "=")
+		op = strings.TrimSpace(op)
+		if !ok || op == "" {
+			return nil, fmt.Errorf("operation buckets %q are not formatted as operation=b1,b2", entry)
+		}
+
+		parsedBounds := make([]float64, 0)
+		for _, b := range strings.Split(bounds, ",") {
+			bound, err := strconv.ParseFloat(strings.TrimSpace(b), 64)
+			if err != nil {
+				return nil, fmt.Errorf("bucket %q of operation %s: %w", b, op, err)
+			}
+
+			if n := len(parsedBounds); n > 0 && bound <= parsedBounds[n-1] {
+				return nil, fmt.Errorf("buckets of operation %s are not increasing", op)
+			}
+			parsedBounds = append(parsedBounds, bound)
+		}
+
+		parsed[op] = parsedBounds
+	}
+
+	return parsed, nil
+}
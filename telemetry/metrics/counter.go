@@ -3,7 +3,6 @@ package metrics
 import (
 	"context"
 	"fmt"
-	"strings"
 
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
@@ -22,8 +21,10 @@ type Counter interface {
 type defaultCounter struct {
 	counter      metric.Float64Counter
 	staticLabels []attribute.KeyValue
+	labels       *labelSet
 	opts         []MeasurementOption
 	labelNames   map[string]struct{}
+	guard        *seriesGuard
 }
 
 func (c *defaultCounter) Incr(ctx context.Context, opts ...MeasurementOption) error {
@@ -36,20 +37,29 @@ func (c *defaultCounter) Add(ctx context.Context, addend float64, opts ...Measur
 	}
 
 	opt := metricOpts{}
+	for _, o := range c.opts {
+		o(&opt)
+	}
 	for _, o := range opts {
 		o(&opt)
 	}
 
-	labels := c.staticLabels
+	static := c.labels.get()
+	labels := make([]attribute.KeyValue, 0, len(static)+len(c.staticLabels)+len(opt.labels))
+	labels = append(labels, static...)
+	labels = append(labels, c.staticLabels...)
 	for k, v := range opt.labels {
-		if c.labelNames != nil {
-			if _, ok := c.labelNames[k]; ok {
-				labels = append(labels, attribute.Key(k).String(v))
-			}
+		if acceptsLabel(c.labelNames, k) {
+			labels = append(labels, attribute.Key(k).String(SanitizeLabel(k, v)))
 		}
 	}
 
-	c.counter.Add(ctx, addend, metric.WithAttributeSet(attribute.NewSet(labels...)))
+	set := attribute.NewSet(labels...)
+	if !c.guard.admit(ctx, set) {
+		return nil
+	}
+
+	c.counter.Add(ctx, addend, metric.WithAttributeSet(set))
 
 	return nil
 }
@@ -63,6 +73,11 @@ func (c *defaultCounter) Load(opts ...MeasurementOption) {
 // It will create a new counter on first invocation, or return a cached counter
 // previously created by name
 func (mf *defaultMetricsFactory) NewCounter(name string, opts ...MetricOption) (Counter, error) {
+	name = mf.Name(name)
+
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+
 	if c, ok := mf.counters[name]; ok {
 		return c, nil
 	}
@@ -72,9 +87,7 @@ func (mf *defaultMetricsFactory) NewCounter(name string, opts ...MetricOption) (
 		o(&opt)
 	}
 
-	name = strings.TrimSpace(strings.ReplaceAll(fmt.Sprintf("%s_%s", mf.config.ServiceName, name), "-", "_"))
-
-	counter := &defaultCounter{}
+	counter := &defaultCounter{labels: mf.labels, guard: mf.newSeriesGuard(name)}
 
 	otelOpts := make([]metric.Float64CounterOption, 0)
 	if opt.desc != "" {
@@ -84,7 +97,7 @@ func (mf *defaultMetricsFactory) NewCounter(name string, opts ...MetricOption) (
 		otelOpts = append(otelOpts, metric.WithUnit(opt.unit))
 	}
 	if len(opt.staticLabels) > 0 {
-		attr := make([]attribute.KeyValue, len(opt.staticLabels))
+		attr := make([]attribute.KeyValue, 0, len(opt.staticLabels))
 		for k, v := range opt.staticLabels {
 			attr = append(attr, attribute.Key(k).String(v))
 		}
@@ -99,14 +112,7 @@ func (mf *defaultMetricsFactory) NewCounter(name string, opts ...MetricOption) (
 	counter.counter = otelCounter
 	counter.opts = make([]MeasurementOption, 0)
 
-	labelNames := make(map[string]struct{})
-	if opt.labelNames != nil {
-		for _, label := range opt.labelNames {
-			labelNames[label] = struct{}{}
-		}
-	}
-
-	counter.labelNames = labelNames
+	counter.labelNames = labelNameSet(opt)
 
 	if len(counter.staticLabels) == 0 {
 		counter.staticLabels = make([]attribute.KeyValue, 0)
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// The signals whose dropped data is counted by RecordDropped
+const (
+	SignalSpans   = "spans"
+	SignalMetrics = "metrics"
+	SignalLogs    = "logs"
+)
+
+// droppedMetric counts the telemetry dropped before it could be exported
+const droppedMetric = "kokoro_telemetry_dropped"
+
+// RecordDropped counts n spans, metric points, or log records of the signal
+// dropped before they could be exported, e.g. because a queue was full, on
+// the kokoro_telemetry_dropped counter labeled with the signal and reason
+func RecordDropped(ctx context.Context, signal, reason string, n int) {
+	if DefaultFactory == nil || n <= 0 {
+		return
+	}
+
+	counter, err := DefaultFactory.NewCounter(droppedMetric,
+		WithDescription("Telemetry dropped before it could be exported, such as spans over the export queue or metric points over the series limit"),
+		WithLabelNames([]string{"signal", "reason"}),
+	)
+	if err != nil {
+		return
+	}
+
+	_ = counter.Add(context.WithoutCancel(ctx), float64(n),
+		WithLabel("signal", signal),
+		WithLabel("reason", reason),
+	)
+}
+
+// seriesGuard discards the measurements of a metric adding series past the
+// limit set by WithMaxSeries, so a label taking unbounded values can't grow
+// the memory held by the meter without bounds
+type seriesGuard struct {
+	name string
+
+	mu     sync.Mutex
+	series map[attribute.Distinct]struct{}
+	warned bool
+}
+
+// newSeriesGuard creates the guard of the metric named name
+func (mf *defaultMetricsFactory) newSeriesGuard(name string) *seriesGuard {
+	if name == mf.Name(droppedMetric) {
+		// the counter of discarded points must not discard its own
+		return nil
+	}
+
+	return &seriesGuard{name: name, series: make(map[attribute.Distinct]struct{})}
+}
+
+// admit reports whether the measurement of the label set may be recorded,
+// counting it as dropped when it may not
+func (g *seriesGuard) admit(ctx context.Context, set attribute.Set) bool {
+	if g == nil {
+		return true
+	}
+
+	limit := currentPolicy().maxSeries
+	if limit <= 0 {
+		return true
+	}
+
+	g.mu.Lock()
+	_, seen := g.series[set.Equivalent()]
+	admitted := seen || len(g.series) < limit
+	if admitted && !seen {
+		g.series[set.Equivalent()] = struct{}{}
+	}
+	warn := !admitted && !g.warned
+	if warn {
+		g.warned = true
+	}
+	g.mu.Unlock()
+
+	if warn {
+		slog.WarnContext(ctx, "metric reached its series limit, discarding measurements of new label sets",
+			slog.String("metric", g.name),
+			slog.Int("limit", limit),
+		)
+	}
+
+	if !admitted {
+		RecordDropped(ctx, SignalMetrics, "series_limit", 1)
+	}
+
+	return admitted
+}
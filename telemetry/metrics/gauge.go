@@ -2,8 +2,6 @@ package metrics
 
 import (
 	"context"
-	"fmt"
-	"strings"
 
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
@@ -19,26 +17,37 @@ type Gauge interface {
 type defaultGauge struct {
 	gauge        metric.Float64Gauge
 	staticLabels []attribute.KeyValue
+	labels       *labelSet
 	opts         []MeasurementOption
 	labelNames   map[string]struct{}
+	guard        *seriesGuard
 }
 
 func (g *defaultGauge) Measure(ctx context.Context, value float64, opts ...MeasurementOption) error {
 	opt := metricOpts{}
+	for _, o := range g.opts {
+		o(&opt)
+	}
 	for _, o := range opts {
 		o(&opt)
 	}
 
-	labels := g.staticLabels
+	static := g.labels.get()
+	labels := make([]attribute.KeyValue, 0, len(static)+len(g.staticLabels)+len(opt.labels))
+	labels = append(labels, static...)
+	labels = append(labels, g.staticLabels...)
 	for k, v := range opt.labels {
-		if g.labelNames != nil {
-			if _, ok := g.labelNames[k]; ok {
-				labels = append(labels, attribute.Key(k).String(v))
-			}
+		if acceptsLabel(g.labelNames, k) {
+			labels = append(labels, attribute.Key(k).String(SanitizeLabel(k, v)))
 		}
 	}
 
-	g.gauge.Record(ctx, value, metric.WithAttributeSet(attribute.NewSet(labels...)))
+	set := attribute.NewSet(labels...)
+	if !g.guard.admit(ctx, set) {
+		return nil
+	}
+
+	g.gauge.Record(ctx, value, metric.WithAttributeSet(set))
 
 	return nil
 }
@@ -52,6 +61,11 @@ func (g *defaultGauge) Load(opts ...MeasurementOption) {
 // It will create a new gauge on first invocation, or return a cached gauge
 // previously created by name
 func (mf *defaultMetricsFactory) NewGauge(name string, opts ...MetricOption) (Gauge, error) {
+	name = mf.Name(name)
+
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+
 	if g, ok := mf.gauges[name]; ok {
 		return g, nil
 	}
@@ -61,9 +75,7 @@ func (mf *defaultMetricsFactory) NewGauge(name string, opts ...MetricOption) (Ga
 		o(&opt)
 	}
 
-	name = strings.TrimSpace(strings.ReplaceAll(fmt.Sprintf("%s_%s", mf.config.ServiceName, name), "-", "_"))
-
-	gauge := &defaultGauge{}
+	gauge := &defaultGauge{labels: mf.labels, guard: mf.newSeriesGuard(name)}
 
 	otelOpts := make([]metric.Float64GaugeOption, 0)
 	if opt.desc != "" {
@@ -73,7 +85,7 @@ func (mf *defaultMetricsFactory) NewGauge(name string, opts ...MetricOption) (Ga
 		otelOpts = append(otelOpts, metric.WithUnit(opt.unit))
 	}
 	if len(opt.staticLabels) > 0 {
-		attr := make([]attribute.KeyValue, len(opt.staticLabels))
+		attr := make([]attribute.KeyValue, 0, len(opt.staticLabels))
 		for k, v := range opt.staticLabels {
 			attr = append(attr, attribute.Key(k).String(v))
 		}
@@ -88,14 +100,7 @@ func (mf *defaultMetricsFactory) NewGauge(name string, opts ...MetricOption) (Ga
 	gauge.gauge = otelGauge
 	gauge.opts = make([]MeasurementOption, 0)
 
-	labelNames := make(map[string]struct{})
-	if opt.labelNames != nil {
-		for _, label := range opt.labelNames {
-			labelNames[label] = struct{}{}
-		}
-	}
-
-	gauge.labelNames = labelNames
+	gauge.labelNames = labelNameSet(opt)
 
 	if len(gauge.staticLabels) == 0 {
 		gauge.staticLabels = make([]attribute.KeyValue, 0)
@@ -3,7 +3,6 @@ package metrics
 import (
 	"context"
 	"fmt"
-	"strings"
 
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
@@ -19,8 +18,10 @@ type Histogram interface {
 type defaultHistogram struct {
 	histogram    metric.Float64Histogram
 	staticLabels []attribute.KeyValue
+	labels       *labelSet
 	opts         []MeasurementOption
 	labelNames   map[string]struct{}
+	guard        *seriesGuard
 }
 
 func (h *defaultHistogram) Record(ctx context.Context, measurement float64, opts ...MeasurementOption) error {
@@ -29,20 +30,29 @@ func (h *defaultHistogram) Record(ctx context.Context, measurement float64, opts
 	}
 
 	opt := metricOpts{}
+	for _, o := range h.opts {
+		o(&opt)
+	}
 	for _, o := range opts {
 		o(&opt)
 	}
 
-	labels := h.staticLabels
+	static := h.labels.get()
+	labels := make([]attribute.KeyValue, 0, len(static)+len(h.staticLabels)+len(opt.labels))
+	labels = append(labels, static...)
+	labels = append(labels, h.staticLabels...)
 	for k, v := range opt.labels {
-		if h.labelNames != nil {
-			if _, ok := h.labelNames[k]; ok {
-				labels = append(labels, attribute.Key(k).String(v))
-			}
+		if acceptsLabel(h.labelNames, k) {
+			labels = append(labels, attribute.Key(k).String(SanitizeLabel(k, v)))
 		}
 	}
 
-	h.histogram.Record(ctx, measurement, metric.WithAttributeSet(attribute.NewSet(labels...)))
+	set := attribute.NewSet(labels...)
+	if !h.guard.admit(ctx, set) {
+		return nil
+	}
+
+	h.histogram.Record(ctx, measurement, metric.WithAttributeSet(set))
 
 	return nil
 }
@@ -55,6 +65,11 @@ func (h *defaultHistogram) Load(opts ...MeasurementOption) {
 //
 // It will create a new histogram on first invocation, or return a cached histogram
 func (mf *defaultMetricsFactory) NewHistogram(name string, opts ...MetricOption) (Histogram, error) {
+	name = mf.Name(name)
+
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+
 	if h, ok := mf.histograms[name]; ok {
 		return h, nil
 	}
@@ -64,9 +79,7 @@ func (mf *defaultMetricsFactory) NewHistogram(name string, opts ...MetricOption)
 		o(&opt)
 	}
 
-	name = strings.TrimSpace(strings.ReplaceAll(fmt.Sprintf("%s_%s", mf.config.ServiceName, name), "-", "_"))
-
-	histogram := &defaultHistogram{}
+	histogram := &defaultHistogram{labels: mf.labels, guard: mf.newSeriesGuard(name)}
 
 	otelOpts := make([]metric.Float64HistogramOption, 0)
 	if opt.desc != "" {
@@ -79,7 +92,7 @@ func (mf *defaultMetricsFactory) NewHistogram(name string, opts ...MetricOption)
 		otelOpts = append(otelOpts, metric.WithExplicitBucketBoundaries(opt.buckets...))
 	}
 	if len(opt.staticLabels) > 0 {
-		attr := make([]attribute.KeyValue, len(opt.staticLabels))
+		attr := make([]attribute.KeyValue, 0, len(opt.staticLabels))
 		for k, v := range opt.staticLabels {
 			attr = append(attr, attribute.Key(k).String(v))
 		}
@@ -94,14 +107,7 @@ func (mf *defaultMetricsFactory) NewHistogram(name string, opts ...MetricOption)
 	histogram.histogram = otelHistogram
 	histogram.opts = make([]MeasurementOption, 0)
 
-	labelNames := make(map[string]struct{})
-	if opt.labelNames != nil {
-		for _, label := range opt.labelNames {
-			labelNames[label] = struct{}{}
-		}
-	}
-
-	histogram.labelNames = labelNames
+	histogram.labelNames = labelNameSet(opt)
 
 	if len(histogram.staticLabels) == 0 {
 		histogram.staticLabels = make([]attribute.KeyValue, 0)
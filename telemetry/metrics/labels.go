@@ -0,0 +1,223 @@
+package metrics
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// StaticLabeler is implemented by factories whose static labels can be
+// replaced while the process is running
+type StaticLabeler interface {
+	// SetStaticLabels replaces the labels set on every measurement made by the
+	// factory's metrics, in addition to the service and env labels
+	SetStaticLabels(labels map[string]string)
+}
+
+// labelSet holds the labels applied to every measurement made by a factory's
+// metrics so they can be replaced without recreating the metrics
+type labelSet struct {
+	attrs atomic.Pointer[[]attribute.KeyValue]
+}
+
+func newLabelSet(labels map[string]string) *labelSet {
+	s := &labelSet{}
+	s.set(labels)
+
+	return s
+}
+
+func (s *labelSet) set(labels map[string]string) {
+	attrs := make([]attribute.KeyValue, 0, len(labels))
+	for k, v := range labels {
+		attrs = append(attrs, attribute.Key(k).String(v))
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		return attrs[i].Key < attrs[j].Key
+	})
+
+	s.attrs.Store(&attrs)
+}
+
+func (s *labelSet) get() []attribute.KeyValue {
+	if s == nil {
+		return nil
+	}
+
+	attrs := s.attrs.Load()
+	if attrs == nil {
+		return nil
+	}
+
+	return *attrs
+}
+
+// ParseStaticLabels parses labels formatted as k1=v1,k2=v2
+func ParseStaticLabels(labels string) (map[string]string, error) {
+	parsed := make(map[string]string)
+	if strings.TrimSpace(labels) == "" {
+		return parsed, nil
+	}
+
+	for _, pair := range strings.Split(labels, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("static label %q is not formatted as key=value", pair)
+		}
+
+		parsed[k] = strings.TrimSpace(v)
+	}
+
+	return parsed, nil
+}
+
+func (mf *defaultMetricsFactory) SetStaticLabels(labels map[string]string) {
+	merged := make(map[string]string, len(mf.staticLabels)+len(labels))
+	for k, v := range labels {
+		merged[k] = v
+	}
+	for k, v := range mf.staticLabels {
+		merged[k] = v
+	}
+
+	mf.labels.set(merged)
+}
+
+const (
+	defaultMaxLabelLength = 128
+	hashedLabelLength     = 16
+)
+
+type labelPolicy struct {
+	maxLength int
+	maxSeries int
+	hashed    map[string]struct{}
+}
+
+type LabelOption func(*labelPolicy)
+
+// WithMaxLabelLength caps label values to n bytes. Defaults to 128, a
+// negative length leaves values uncapped.
+func WithMaxLabelLength(n int) LabelOption {
+	return func(p *labelPolicy) {
+		p.maxLength = n
+	}
+}
+
+// WithHashedLabels replaces the values of the labels provided with a short
+// hash, for identifiers that must be told apart without being exported
+func WithHashedLabels(keys ...string) LabelOption {
+	return func(p *labelPolicy) {
+		for _, k := range keys {
+			p.hashed[k] = struct{}{}
+		}
+	}
+}
+
+// WithMaxSeries caps the number of label sets each metric is recorded with
+// to n, discarding the measurements of new label sets past it and counting
+// them as dropped, see RecordDropped. Zero or a negative limit leaves series
+// unbounded, which is the default.
+func WithMaxSeries(n int) LabelOption {
+	return func(p *labelPolicy) {
+		p.maxSeries = n
+	}
+}
+
+var policy atomic.Pointer[labelPolicy]
+
+func currentPolicy() *labelPolicy {
+	p := policy.Load()
+	if p == nil {
+		return &labelPolicy{maxLength: defaultMaxLabelLength}
+	}
+
+	return p
+}
+
+// SetLabelPolicy configures how label values are sanitized before they are
+// exported, replacing the policy applied by Init from the config. Control
+// characters and invalid UTF-8 are always stripped.
+func SetLabelPolicy(opts ...LabelOption) {
+	p := &labelPolicy{
+		maxLength: defaultMaxLabelLength,
+		hashed:    make(map[string]struct{}),
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	if p.maxLength == 0 {
+		p.maxLength = defaultMaxLabelLength
+	}
+
+	policy.Store(p)
+}
+
+// SanitizeLabel returns the value of the label k as it is exported, see
+// SetLabelPolicy
+func SanitizeLabel(k, v string) string {
+	p := currentPolicy()
+
+	if _, ok := p.hashed[k]; ok {
+		sum := sha256.Sum256([]byte(v))
+		return hex.EncodeToString(sum[:])[:hashedLabelLength]
+	}
+
+	if !needsSanitizing(v, p.maxLength) {
+		return v
+	}
+
+	v = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(v, ""))
+
+	if p.maxLength > 0 && len(v) > p.maxLength {
+		v = v[:p.maxLength]
+		// drop a rune cut in half by the cap
+		for len(v) > 0 && !utf8.ValidString(v) {
+			v = v[:len(v)-1]
+		}
+	}
+
+	return v
+}
+
+func needsSanitizing(v string, maxLength int) bool {
+	if maxLength > 0 && len(v) > maxLength {
+		return true
+	}
+
+	for _, r := range v {
+		if r == utf8.RuneError || unicode.IsControl(r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// labelOptions returns the label policy configured by the config
+func (config Metrics) labelOptions() []LabelOption {
+	opts := []LabelOption{
+		WithMaxLabelLength(config.LabelMaxLength),
+		WithMaxSeries(config.MaxSeries),
+	}
+	for _, k := range strings.Split(config.HashedLabels, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			opts = append(opts, WithHashedLabels(k))
+		}
+	}
+
+	return opts
+}
@@ -1,29 +1,113 @@
 package metrics
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
+	prom "github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/otel/exporters/prometheus"
 	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
 	api "go.opentelemetry.io/otel/sdk/metric"
 )
 
 var DefaultFactory Factory
 
+var (
+	meterProvider *api.MeterProvider
+	metricsServer *http.Server
+	listener      net.Listener
+	registerer    = &trackingRegisterer{Registerer: prom.DefaultRegisterer}
+)
+
+// trackingRegisterer registers collectors with the default prometheus
+// registry, remembering them so Shutdown can unregister them and a later Init
+// doesn't fail with a duplicate registration
+type trackingRegisterer struct {
+	prom.Registerer
+
+	mu         sync.Mutex
+	collectors []prom.Collector
+}
+
+func (r *trackingRegisterer) Register(c prom.Collector) error {
+	err := r.Registerer.Register(c)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.collectors = append(r.collectors, c)
+	r.mu.Unlock()
+
+	return nil
+}
+
+func (r *trackingRegisterer) MustRegister(cs ...prom.Collector) {
+	for _, c := range cs {
+		err := r.Register(c)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (r *trackingRegisterer) unregister() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range r.collectors {
+		r.Registerer.Unregister(c)
+	}
+	r.collectors = nil
+}
+
 type Metrics struct {
+	// Enabled turns metrics off when false, leaving it unset keeps them on
+	Enabled     *bool  `env:"METRICS_ENABLED"`
+	Disabled    bool   `env:"METRICS_DISABLED" envDefault:"false"`
 	MetricsPort int    `env:"METRICS_PORT" envDefault:"8000"`
 	ServiceName string `env:"SERVICE_NAME" envDefault:"_"`
 	Environment string `env:"ENVIRONMENT" envDefault:"dev"`
+	Exemplars   bool   `env:"METRICS_EXEMPLARS" envDefault:"true"`
+
+	// StaticLabels are set on every measurement, formatted as k1=v1,k2=v2
+	StaticLabels string `env:"METRICS_STATIC_LABELS"`
+	// OperationBuckets overrides the buckets of an operation's duration
+	// histogram, formatted as op1=b1,b2,b3;op2=b1,b2
+	OperationBuckets string `env:"OPERATION_BUCKETS"`
+	// DurationUnit is the unit operation durations are recorded in, millis or
+	// seconds
+	DurationUnit string `env:"OPERATION_DURATION_UNIT" envDefault:"millis"`
+	// LabelMaxLength caps label values to a number of bytes, a negative
+	// length leaves them uncapped. Defaults to 128.
+	LabelMaxLength int `env:"METRICS_LABEL_MAX_LENGTH" envDefault:"128"`
+	// HashedLabels are exported as a short hash of their value, formatted as
+	// k1,k2
+	HashedLabels string `env:"METRICS_HASHED_LABELS"`
+	// MaxSeries caps the number of label sets each metric is recorded with,
+	// discarding measurements past it, see WithMaxSeries. Defaults to 0,
+	// leaving series unbounded.
+	MaxSeries int `env:"METRICS_MAX_SERIES" envDefault:"0"`
+	// RuntimeMetrics exports gauges of the Go runtime, see
+	// EnableRuntimeMetrics
+	RuntimeMetrics bool `env:"METRICS_RUNTIME" envDefault:"false"`
 }
 
 type Factory interface {
 	NewCounter(name string, opts ...MetricOption) (Counter, error)
 	NewHistogram(name string, opts ...MetricOption) (Histogram, error)
 	NewGauge(name string, opts ...MetricOption) (Gauge, error)
+	NewObservableGauge(name string, callback func(ctx context.Context) (float64, []MeasurementOption), opts ...MetricOption) (ObservableGauge, error)
 }
 
 // Loadable is a behavior where measurement options can be loaded prior to
@@ -33,28 +117,61 @@ type Loadable interface {
 	Load(opts ...MeasurementOption)
 }
 
+// Namer is implemented by factories that can report the exported name of a
+// metric created with the provided name
+type Namer interface {
+	Name(name string) string
+}
+
+const defaultNameTemplate = "{service}_{name}"
+
+// defaultScopeName is the instrumentation scope metrics are attributed to
+// unless another is provided WithScope
+const defaultScopeName = "github.com/kzs0/kokoro"
+
 type defaultMetricsFactory struct {
+	mu           sync.Mutex
 	config       Metrics
+	nameTemplate string
 	meter        metric.Meter
 	staticLabels map[string]string
+	labels       *labelSet
 	counters     map[string]Counter
 	histograms   map[string]Histogram
 	gauges       map[string]Gauge
+
+	observableGauges      map[string]ObservableGauge
+	observableInstruments map[string]*observableInstrument
 }
 
-func Init(config Metrics, options ...FactoryOption) error {
-	opts := factoryOpts{}
-	for _, o := range options {
-		o(&opts)
+// enableExemplars turns on exemplar support in the OTel SDK, which is only
+// configurable through the environment. Measurements made within a sampled
+// span will carry the trace and span ID of that span as an exemplar.
+func enableExemplars() {
+	const key = "OTEL_GO_X_EXEMPLAR"
+	if _, ok := os.LookupEnv(key); ok {
+		return
 	}
 
-	exporter, err := prometheus.New()
+	err := os.Setenv(key, "true")
 	if err != nil {
-		return fmt.Errorf("failed to load prometheus exporter: %w", err)
+		slog.Warn("failed to enable exemplars", slog.String("error", err.Error()))
 	}
+}
 
-	provider := api.NewMeterProvider(api.WithReader(exporter))
-	meter := provider.Meter("github.com/kzs0/kokoro")
+// Name returns the exported name of a metric created by the factory
+func (mf *defaultMetricsFactory) Name(name string) string {
+	name = strings.NewReplacer("{service}", mf.config.ServiceName, "{name}", name).Replace(mf.nameTemplate)
+
+	return strings.TrimSpace(strings.ReplaceAll(name, "-", "_"))
+}
+
+// NewFactory creates a Factory producing metrics from the provided meter
+func NewFactory(config Metrics, meter metric.Meter, options ...FactoryOption) Factory {
+	opts := factoryOpts{}
+	for _, o := range options {
+		o(&opts)
+	}
 
 	static := map[string]string{
 		"service": config.ServiceName,
@@ -65,34 +182,154 @@ func Init(config Metrics, options ...FactoryOption) error {
 		static[k] = v
 	}
 
-	DefaultFactory = &defaultMetricsFactory{
+	if opts.nameTemplate == "" {
+		opts.nameTemplate = defaultNameTemplate
+	}
+
+	mf := &defaultMetricsFactory{
 		config:       config,
+		nameTemplate: opts.nameTemplate,
 		meter:        meter,
 		counters:     make(map[string]Counter),
 		histograms:   make(map[string]Histogram),
 		gauges:       make(map[string]Gauge),
 		staticLabels: static,
+		labels:       newLabelSet(static),
+	}
+
+	labels, err := ParseStaticLabels(config.StaticLabels)
+	if err != nil {
+		slog.Warn("ignoring invalid static labels", slog.String("error", err.Error()))
+	} else {
+		mf.SetStaticLabels(labels)
+	}
+
+	return mf
+}
+
+// IsEnabled reports whether metrics are turned on, which they are unless Enabled
+// is false or Disabled is set
+func (config Metrics) IsEnabled() bool {
+	return !config.Disabled && (config.Enabled == nil || *config.Enabled)
+}
+
+// Validate reports whether the config can be used to initialize metrics
+func (config Metrics) Validate() error {
+	if config.MetricsPort < 1 || config.MetricsPort > 65535 {
+		return fmt.Errorf("metrics port %d is not between 1 and 65535", config.MetricsPort)
+	}
+
+	_, err := ParseStaticLabels(config.StaticLabels)
+	if err != nil {
+		return err
+	}
+
+	_, err = ParseOperationBuckets(config.OperationBuckets)
+	if err != nil {
+		return err
+	}
+
+	switch config.DurationUnit {
+	case "", "millis", "seconds":
+	default:
+		return fmt.Errorf("%q is not a duration unit, expected millis or seconds", config.DurationUnit)
+	}
+
+	return nil
+}
+
+// ValidateNameTemplate reports whether the template can be used with
+// WithNameTemplate
+func ValidateNameTemplate(template string) error {
+	if !strings.Contains(template, "{name}") {
+		return fmt.Errorf("metric name template %q has no {name}", template)
 	}
 
+	rest := strings.NewReplacer("{service}", "", "{name}", "").Replace(template)
+	if strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("metric name template %q only supports {service} and {name}", template)
+	}
+
+	return nil
+}
+
+// NewNoopFactory creates a Factory whose metrics discard every measurement
+func NewNoopFactory() Factory {
+	return NewFactory(Metrics{}, noop.NewMeterProvider().Meter(defaultScopeName))
+}
+
+func Init(config Metrics, options ...FactoryOption) error {
+	opts := factoryOpts{}
+	for _, o := range options {
+		o(&opts)
+	}
+
+	if config.Exemplars {
+		enableExemplars()
+	}
+
+	SetLabelPolicy(config.labelOptions()...)
+
+	registerer.unregister()
+
+	exporter, err := prometheus.New(prometheus.WithRegisterer(registerer))
+	if err != nil {
+		return fmt.Errorf("failed to load prometheus exporter: %w", err)
+	}
+
+	provider := api.NewMeterProvider(api.WithReader(exporter))
+	scope := defaultScopeName
+	if opts.scopeName != "" {
+		scope = opts.scopeName
+	}
+	meter := provider.Meter(scope, metric.WithInstrumentationVersion(opts.scopeVersion))
+
+	DefaultFactory = NewFactory(config, meter, options...)
+
 	if opts.factory != nil {
 		DefaultFactory = opts.factory
 	}
 
-	go func() {
-		mux := http.NewServeMux()
-		mux.Handle("/", promhttp.Handler())
-		server := &http.Server{
-			Addr:              fmt.Sprintf(":%d", config.MetricsPort),
-			Handler:           mux,
-			ReadTimeout:       15 * time.Second,
-			WriteTimeout:      15 * time.Second,
-			IdleTimeout:       360 * time.Second,
-			ReadHeaderTimeout: 5 * time.Second,
-			MaxHeaderBytes:    1 << 20, // 1 MB
-		}
+	meterProvider = provider
 
-		err := server.ListenAndServe()
+	if config.RuntimeMetrics {
+		err := EnableRuntimeMetrics()
 		if err != nil {
+			return err
+		}
+	}
+
+	if opts.noServer {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", Handler())
+	for pattern, handler := range opts.handlers {
+		mux.Handle(pattern, handler)
+	}
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", config.MetricsPort),
+		Handler:           mux,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      15 * time.Second,
+		IdleTimeout:       360 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		MaxHeaderBytes:    1 << 20, // 1 MB
+	}
+
+	l, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for metrics server: %w", err)
+	}
+
+	metricsServer = server
+	listener = l
+
+	go func() {
+		err := server.Serve(l)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			slog.Error("failed to serve/failed while serving metrics",
 				slog.String("error", err.Error()), slog.Int("port", config.MetricsPort))
 
@@ -102,3 +339,62 @@ func Init(config Metrics, options ...FactoryOption) error {
 
 	return nil
 }
+
+// Handler serves the metrics in the prometheus exposition format, or in the
+// OpenMetrics format to scrapers that negotiate it, which is the only format
+// exemplars are rendered in
+func Handler() http.Handler {
+	return promhttp.InstrumentMetricHandler(prom.DefaultRegisterer,
+		promhttp.HandlerFor(prom.DefaultGatherer, promhttp.HandlerOpts{
+			EnableOpenMetrics: true,
+		}),
+	)
+}
+
+// Flush exports any measurements not yet collected without stopping the meter
+// provider
+func Flush(ctx context.Context) error {
+	if meterProvider == nil {
+		return nil
+	}
+
+	err := meterProvider.ForceFlush(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to flush meter provider: %w", err)
+	}
+
+	return nil
+}
+
+// Shutdown stops the metrics server and the meter provider started by Init,
+// giving up once ctx is done
+func Shutdown(ctx context.Context) error {
+	var errs error
+
+	if metricsServer != nil {
+		err := metricsServer.Shutdown(ctx)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("failed to shutdown metrics server: %w", err))
+		}
+
+		// the server only closes the listener once it has started serving
+		err = listener.Close()
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = errors.Join(errs, fmt.Errorf("failed to close metrics listener: %w", err))
+		}
+	}
+
+	if meterProvider != nil {
+		err := meterProvider.Shutdown(ctx)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("failed to shutdown meter provider: %w", err))
+		}
+	}
+
+	registerer.unregister()
+	metricsServer = nil
+	listener = nil
+	meterProvider = nil
+
+	return errs
+}
@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// ObservableGauge is a gauge whose value is observed by a callback every time
+// metrics are collected, e.g. the size of a pool, rather than being measured
+// as it changes
+type ObservableGauge interface {
+	// Unregister stops observing the gauge, which is no longer exported
+	Unregister() error
+}
+
+type defaultObservableGauge struct {
+	registration metric.Registration
+	factory      *defaultMetricsFactory
+	name         string
+}
+
+// Unregister stops observing the gauge, so a gauge of the same name can be
+// created again
+func (g *defaultObservableGauge) Unregister() error {
+	g.factory.mu.Lock()
+	delete(g.factory.observableGauges, g.name)
+	g.factory.mu.Unlock()
+
+	return g.registration.Unregister()
+}
+
+// ObservableGaugeSeries is implemented by factories whose observable gauges
+// can be shared by several callbacks, each reporting a series of its own,
+// e.g. one per operation when operations share their metrics
+type ObservableGaugeSeries interface {
+	// NewObservableGaugeSeries registers the callback reporting the series
+	// of the gauge, creating the gauge on first invocation. It returns the
+	// series previously registered by name and series, keeping its callback.
+	NewObservableGaugeSeries(name, series string, callback func(ctx context.Context) (float64, []MeasurementOption), opts ...MetricOption) (ObservableGauge, error)
+}
+
+// observableInstrument is an observable gauge the callbacks of its series
+// report to
+type observableInstrument struct {
+	gauge        metric.Float64ObservableGauge
+	guard        *seriesGuard
+	staticLabels []attribute.KeyValue
+	labelNames   map[string]struct{}
+}
+
+// NewObservableGauge will produce an ObservableGauge whose value is returned
+// by the callback along with the labels of the measurement whenever metrics
+// are collected. The callback must be safe to call concurrently and should
+// return quickly since it delays the collection.
+//
+// It will create a new gauge on first invocation, or return the gauge
+// previously created by name, keeping its callback
+func (mf *defaultMetricsFactory) NewObservableGauge(name string, callback func(ctx context.Context) (float64, []MeasurementOption), opts ...MetricOption) (ObservableGauge, error) {
+	return mf.observe(mf.Name(name), "", callback, opts)
+}
+
+// NewObservableGaugeSeries will register the callback reporting a series of
+// an ObservableGauge shared by the callbacks of other series, creating the
+// gauge on first invocation, see NewObservableGauge
+func (mf *defaultMetricsFactory) NewObservableGaugeSeries(name, series string, callback func(ctx context.Context) (float64, []MeasurementOption), opts ...MetricOption) (ObservableGauge, error) {
+	return mf.observe(mf.Name(name), series, callback, opts)
+}
+
+func (mf *defaultMetricsFactory) observe(name, series string, callback func(ctx context.Context) (float64, []MeasurementOption), opts []MetricOption) (ObservableGauge, error) {
+	key := name
+	if series != "" {
+		key = name + "\x00" + series
+	}
+
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+
+	if g, ok := mf.observableGauges[key]; ok {
+		return g, nil
+	}
+
+	instrument, err := mf.observableInstrument(name, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	registration, err := mf.meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		value, mopts := callback(ctx)
+
+		measurement := metricOpts{}
+		for _, mo := range mopts {
+			mo(&measurement)
+		}
+
+		static := mf.labels.get()
+		labels := make([]attribute.KeyValue, 0, len(static)+len(instrument.staticLabels)+len(measurement.labels))
+		labels = append(labels, static...)
+		labels = append(labels, instrument.staticLabels...)
+		for k, v := range measurement.labels {
+			if acceptsLabel(instrument.labelNames, k) {
+				labels = append(labels, attribute.Key(k).String(SanitizeLabel(k, v)))
+			}
+		}
+
+		set := attribute.NewSet(labels...)
+		if !instrument.guard.admit(ctx, set) {
+			return nil
+		}
+
+		o.ObserveFloat64(instrument.gauge, value, metric.WithAttributeSet(set))
+
+		return nil
+	}, instrument.gauge)
+	if err != nil {
+		return nil, err
+	}
+
+	gauge := &defaultObservableGauge{registration: registration, factory: mf, name: key}
+
+	if mf.observableGauges == nil {
+		mf.observableGauges = make(map[string]ObservableGauge, 1)
+	}
+	mf.observableGauges[key] = gauge
+
+	return gauge, nil
+}
+
+// observableInstrument returns the gauge named name, creating it with the
+// options provided on first invocation, must be called with the lock held
+func (mf *defaultMetricsFactory) observableInstrument(name string, opts []MetricOption) (*observableInstrument, error) {
+	if instrument, ok := mf.observableInstruments[name]; ok {
+		return instrument, nil
+	}
+
+	opt := metricOpts{}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	otelOpts := make([]metric.Float64ObservableGaugeOption, 0)
+	if opt.desc != "" {
+		otelOpts = append(otelOpts, metric.WithDescription(opt.desc))
+	}
+	if opt.unit != "" {
+		otelOpts = append(otelOpts, metric.WithUnit(opt.unit))
+	}
+
+	otelGauge, err := mf.meter.Float64ObservableGauge(name, otelOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	instrument := &observableInstrument{
+		gauge:        otelGauge,
+		guard:        mf.newSeriesGuard(name),
+		staticLabels: make([]attribute.KeyValue, 0, len(opt.staticLabels)),
+		labelNames:   labelNameSet(opt),
+	}
+	for k, v := range opt.staticLabels {
+		instrument.staticLabels = append(instrument.staticLabels, attribute.Key(k).String(v))
+	}
+
+	if mf.observableInstruments == nil {
+		mf.observableInstruments = make(map[string]*observableInstrument, 1)
+	}
+	mf.observableInstruments[name] = instrument
+
+	return instrument, nil
+}
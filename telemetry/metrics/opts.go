@@ -1,12 +1,29 @@
 package metrics
 
+import "net/http"
+
 type factoryOpts struct {
+	nameTemplate string
 	staticLabels map[string]string
 	factory      Factory
+	handlers     map[string]http.Handler
+	noServer     bool
+	scopeName    string
+	scopeVersion string
 }
 
 type FactoryOption func(*factoryOpts)
 
+// WithScope attributes the metrics created by the factory Init creates to the
+// instrumentation scope provided, e.g. the service, instead of
+// github.com/kzs0/kokoro
+func WithScope(name, version string) FactoryOption {
+	return func(f *factoryOpts) {
+		f.scopeName = name
+		f.scopeVersion = version
+	}
+}
+
 // WithStaticLabel allows setting labels that will be set on all metrics
 // created with the factory
 func WithStaticLabel(label, value string) FactoryOption {
@@ -19,6 +36,15 @@ func WithStaticLabel(label, value string) FactoryOption {
 	}
 }
 
+// WithNameTemplate sets how the factory names the metrics it creates from the
+// {service} name and the {name} requested, e.g. {name} to leave out the
+// service. Defaults to {service}_{name}.
+func WithNameTemplate(template string) FactoryOption {
+	return func(f *factoryOpts) {
+		f.nameTemplate = template
+	}
+}
+
 // WithFactory allows providing a custom factory to be used as the DefaultFactory
 func WithFactory(factory Factory) FactoryOption {
 	return func(f *factoryOpts) {
@@ -26,12 +52,32 @@ func WithFactory(factory Factory) FactoryOption {
 	}
 }
 
+// WithHandler mounts an additional handler on the metrics server
+func WithHandler(pattern string, handler http.Handler) FactoryOption {
+	return func(f *factoryOpts) {
+		if f.handlers == nil {
+			f.handlers = make(map[string]http.Handler)
+		}
+
+		f.handlers[pattern] = handler
+	}
+}
+
+// WithoutServer skips starting the metrics server, leaving Handler to be
+// mounted by another server
+func WithoutServer() FactoryOption {
+	return func(f *factoryOpts) {
+		f.noServer = true
+	}
+}
+
 type metricOpts struct {
 	desc         string
 	unit         string
 	staticLabels map[string]string
 	labels       map[string]string
 	labelNames   []string
+	anyLabels    bool
 	buckets      []float64
 	factory      Factory
 }
@@ -72,7 +118,8 @@ func WithHistogramBucketsBounds(buckets ...float64) MetricOption {
 // WithLabelNames sets the labels expected to be provided to the metric.
 //
 // Subsequent WithLabelNames will overwrite the previous set of names passed in.
-// Labels passed in that were not provided as a LabelName will be ignored.
+// Labels passed in that were not provided as a LabelName will be ignored, so a
+// metric declared without label names ignores every label, see WithAnyLabels.
 // Labels not passed in that were expected will result in an error being returned. // TODO <- This could also just fill in -?
 func WithLabelNames(labels []string) MetricOption {
 	return func(opts *metricOpts) {
@@ -80,6 +127,15 @@ func WithLabelNames(labels []string) MetricOption {
 	}
 }
 
+// WithAnyLabels accepts every label passed in rather than only those named
+// WithLabelNames. It is meant for metrics whose labels are chosen by the
+// caller, like those of operations, as any label passed in becomes a series.
+func WithAnyLabels() MetricOption {
+	return func(opts *metricOpts) {
+		opts.anyLabels = true
+	}
+}
+
 // WithLabel applies a label to the measurement being requested
 //
 // If multiple WithLabel are applied with the same key, the last entry will be respected
@@ -92,3 +148,29 @@ func WithLabel(k, v string) MeasurementOption {
 		opts.labels[k] = v
 	}
 }
+
+// labelNameSet returns the set of labels the metric accepts, which is nil when
+// it accepts every label
+func labelNameSet(opt metricOpts) map[string]struct{} {
+	if opt.anyLabels {
+		return nil
+	}
+
+	labelNames := make(map[string]struct{}, len(opt.labelNames))
+	for _, label := range opt.labelNames {
+		labelNames[label] = struct{}{}
+	}
+
+	return labelNames
+}
+
+// acceptsLabel reports whether a label may be applied to a metric accepting
+// the provided label names, see labelNameSet
+func acceptsLabel(labelNames map[string]struct{}, label string) bool {
+	if labelNames == nil {
+		return true
+	}
+
+	_, ok := labelNames[label]
+	return ok
+}
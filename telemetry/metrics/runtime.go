@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+	runtimemetrics "runtime/metrics"
+)
+
+// runtimeGauges are the gauges registered by EnableRuntimeMetrics
+var runtimeGauges = []struct {
+	name    string
+	desc    string
+	unit    string
+	observe func() float64
+}{
+	{
+		name:    "runtime_goroutines",
+		desc:    "number of live goroutines",
+		observe: runtimeSample("/sched/goroutines:goroutines"),
+	},
+	{
+		name:    "runtime_heap_alloc_bytes",
+		desc:    "bytes of heap memory occupied by live and unswept objects",
+		unit:    "By",
+		observe: runtimeSample("/memory/classes/heap/objects:bytes"),
+	},
+	{
+		name:    "runtime_gc_cycles",
+		desc:    "number of completed garbage collection cycles",
+		observe: runtimeSample("/gc/cycles/total:gc-cycles"),
+	},
+	{
+		name: "runtime_gc_pause_seconds",
+		desc: "total time the world was stopped for garbage collection",
+		unit: "s",
+		observe: func() float64 {
+			var stats debug.GCStats
+			debug.ReadGCStats(&stats)
+
+			return stats.PauseTotal.Seconds()
+		},
+	},
+	{
+		name:    "runtime_cpu_seconds",
+		desc:    "CPU time spent by the process in user and system mode",
+		unit:    "s",
+		observe: processCPUSeconds,
+	},
+}
+
+// EnableRuntimeMetrics registers observable gauges of the Go runtime with the
+// DefaultFactory: the number of goroutines, the heap allocated, the number of
+// garbage collections and the time paused for them, and the CPU time used.
+// They are observed whenever metrics are collected. Init enables them when
+// METRICS_RUNTIME is set.
+func EnableRuntimeMetrics() error {
+	if DefaultFactory == nil {
+		return errors.New("failed to enable runtime metrics: metrics have not been initialized")
+	}
+
+	var errs error
+	for _, g := range runtimeGauges {
+		opts := []MetricOption{WithDescription(g.desc)}
+		if g.unit != "" {
+			opts = append(opts, WithUnit(g.unit))
+		}
+
+		observe := g.observe
+		_, err := DefaultFactory.NewObservableGauge(g.name, func(context.Context) (float64, []MeasurementOption) {
+			return observe(), nil
+		}, opts...)
+		errs = errors.Join(errs, err)
+	}
+
+	return errs
+}
+
+// runtimeSample returns a func reading a single metric of the runtime
+func runtimeSample(name string) func() float64 {
+	return func() float64 {
+		samples := []runtimemetrics.Sample{{Name: name}}
+		runtimemetrics.Read(samples)
+
+		return sampleValue(samples[0])
+	}
+}
+
+func sampleValue(s runtimemetrics.Sample) float64 {
+	switch s.Value.Kind() {
+	case runtimemetrics.KindUint64:
+		return float64(s.Value.Uint64())
+	case runtimemetrics.KindFloat64:
+		return s.Value.Float64()
+	default:
+		return 0
+	}
+}
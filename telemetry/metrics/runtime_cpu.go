@@ -0,0 +1,20 @@
+//go:build unix
+
+package metrics
+
+import "syscall"
+
+// processCPUSeconds returns the user and system CPU time of the process
+func processCPUSeconds() float64 {
+	var usage syscall.Rusage
+	err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage)
+	if err != nil {
+		return 0
+	}
+
+	return timevalSeconds(usage.Utime) + timevalSeconds(usage.Stime)
+}
+
+func timevalSeconds(tv syscall.Timeval) float64 {
+	return float64(tv.Sec) + float64(tv.Usec)/1e6
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package metrics
+
+import (
+	runtimemetrics "runtime/metrics"
+)
+
+// processCPUSeconds returns the CPU time of the process as estimated by the
+// runtime, which only updates the estimate on garbage collection
+func processCPUSeconds() float64 {
+	samples := []runtimemetrics.Sample{
+		{Name: "/cpu/classes/total:cpu-seconds"},
+		{Name: "/cpu/classes/idle:cpu-seconds"},
+	}
+	runtimemetrics.Read(samples)
+
+	return sampleValue(samples[0]) - sampleValue(samples[1])
+}
@@ -0,0 +1,178 @@
+// Package profiling serves runtime profiles over http and continuously
+// collects profiles to push them to a profiling backend.
+package profiling
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/pprof"
+	"time"
+
+	"github.com/kzs0/kokoro/diagnostics"
+	"github.com/kzs0/kokoro/internal/clock"
+)
+
+const (
+	defaultInterval = 10 * time.Second
+
+	CPU       = "cpu"
+	Heap      = "heap"
+	Goroutine = "goroutine"
+	Mutex     = "mutex"
+	Block     = "block"
+)
+
+// Profile is a profile in the pprof format collected between Start and End
+type Profile struct {
+	Kind   string
+	Data   []byte
+	Start  time.Time
+	End    time.Time
+	Labels map[string]string
+}
+
+// Pusher sends profiles to a profiling backend
+type Pusher interface {
+	Push(ctx context.Context, profile Profile) error
+}
+
+type profilingOpts struct {
+	interval time.Duration
+	kinds    []string
+	labels   map[string]string
+}
+
+type Option func(*profilingOpts)
+
+// WithInterval sets how often profiles are collected, which is also the
+// duration of each CPU profile. Defaults to 10 seconds.
+func WithInterval(d time.Duration) Option {
+	return func(opts *profilingOpts) {
+		opts.interval = d
+	}
+}
+
+// WithProfiles sets the kinds of profile collected. Defaults to CPU and Heap.
+func WithProfiles(kinds ...string) Option {
+	return func(opts *profilingOpts) {
+		opts.kinds = kinds
+	}
+}
+
+// WithLabels sets labels attached to every profile
+func WithLabels(labels map[string]string) Option {
+	return func(opts *profilingOpts) {
+		if opts.labels == nil {
+			opts.labels = make(map[string]string)
+		}
+
+		for k, v := range labels {
+			opts.labels[k] = v
+		}
+	}
+}
+
+// Start collects profiles every interval and sends them to pusher until ctx is
+// done. Failures to collect or push a profile are logged and the profile is
+// dropped.
+func Start(ctx context.Context, pusher Pusher, options ...Option) {
+	opts := profilingOpts{
+		interval: defaultInterval,
+		kinds:    []string{CPU, Heap},
+	}
+	for _, o := range options {
+		o(&opts)
+	}
+
+	go func() {
+		for ctx.Err() == nil {
+			profiles := collect(ctx, opts)
+
+			for _, p := range profiles {
+				err := pusher.Push(context.WithoutCancel(ctx), p)
+				if err != nil {
+					diagnostics.Report(ctx, "profiling", "failed to push profile", err, slog.String("kind", p.Kind))
+				}
+			}
+		}
+	}()
+}
+
+// collect profiles the CPU for an interval, then snapshots the other kinds
+func collect(ctx context.Context, opts profilingOpts) []Profile {
+	start := clock.Now()
+	profiles := make([]Profile, 0, len(opts.kinds))
+
+	cpu := false
+	var buf bytes.Buffer
+	for _, kind := range opts.kinds {
+		if kind != CPU {
+			continue
+		}
+
+		err := pprof.StartCPUProfile(&buf)
+		if err != nil {
+			// the CPU profiler is in use, e.g. by /debug/pprof/profile
+			slog.Debug("skipping cpu profile", slog.String("error", err.Error()))
+			break
+		}
+		cpu = true
+	}
+
+	timer := clock.NewTimer(opts.interval)
+	select {
+	case <-ctx.Done():
+		timer.Stop()
+	case <-timer.C():
+	}
+
+	if cpu {
+		pprof.StopCPUProfile()
+		profiles = append(profiles, Profile{
+			Kind:   CPU,
+			Data:   buf.Bytes(),
+			Start:  start,
+			End:    clock.Now(),
+			Labels: opts.labels,
+		})
+	}
+
+	for _, kind := range opts.kinds {
+		if kind == CPU {
+			continue
+		}
+
+		p, err := snapshot(kind)
+		if err != nil {
+			diagnostics.Report(ctx, "profiling", "failed to collect profile", err, slog.String("kind", kind))
+			continue
+		}
+
+		profiles = append(profiles, Profile{
+			Kind:   kind,
+			Data:   p,
+			Start:  start,
+			End:    clock.Now(),
+			Labels: opts.labels,
+		})
+	}
+
+	return profiles
+}
+
+func snapshot(kind string) ([]byte, error) {
+	p := pprof.Lookup(kind)
+	if p == nil {
+		return nil, fmt.Errorf("%s is not a known profile", kind)
+	}
+
+	var buf bytes.Buffer
+	err := p.WriteTo(&buf, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,110 @@
+package profiling
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type pyroscopeOpts struct {
+	client *http.Client
+	token  string
+}
+
+type PyroscopeOption func(*pyroscopeOpts)
+
+// WithHTTPClient sets the client profiles are pushed with
+func WithHTTPClient(client *http.Client) PyroscopeOption {
+	return func(opts *pyroscopeOpts) {
+		opts.client = client
+	}
+}
+
+// WithAuthToken authenticates pushes with a bearer token
+func WithAuthToken(token string) PyroscopeOption {
+	return func(opts *pyroscopeOpts) {
+		opts.token = token
+	}
+}
+
+// Pyroscope pushes profiles to the /ingest endpoint of a Pyroscope server,
+// or any backend compatible with its HTTP API
+type Pyroscope struct {
+	url    string
+	app    string
+	client *http.Client
+	token  string
+}
+
+// NewPyroscope creates a pusher sending profiles for app to the server at
+// serverURL, e.g. http://pyroscope:4040
+func NewPyroscope(serverURL, app string, options ...PyroscopeOption) *Pyroscope {
+	opts := pyroscopeOpts{
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, o := range options {
+		o(&opts)
+	}
+
+	return &Pyroscope{
+		url:    strings.TrimSuffix(serverURL, "/") + "/ingest",
+		app:    app,
+		client: opts.client,
+		token:  opts.token,
+	}
+}
+
+// Push sends a profile in the pprof format
+func (p *Pyroscope) Push(ctx context.Context, profile Profile) error {
+	query := url.Values{}
+	query.Set("name", p.name(profile.Labels))
+	query.Set("from", strconv.FormatInt(profile.Start.Unix(), 10))
+	query.Set("until", strconv.FormatInt(profile.End.Unix(), 10))
+	query.Set("format", "pprof")
+	query.Set("spyName", "gospy")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url+"?"+query.Encode(), bytes.NewReader(profile.Data))
+	if err != nil {
+		return fmt.Errorf("failed to create profile request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push %s profile: %w", profile.Kind, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to push %s profile: %s: %s", profile.Kind, resp.Status, bytes.TrimSpace(body))
+	}
+
+	return nil
+}
+
+// name formats the application name with its labels, e.g. app{env=prod}
+func (p *Pyroscope) name(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, labels[k]))
+	}
+
+	return fmt.Sprintf("%s{%s}", p.app, strings.Join(pairs, ","))
+}
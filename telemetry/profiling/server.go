@@ -0,0 +1,105 @@
+package profiling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"time"
+)
+
+// HandlerPattern is the pattern Handler is mounted on by servers that serve
+// it along with other endpoints
+const HandlerPattern = "/debug/pprof/"
+
+type Profiling struct {
+	Enabled bool `env:"PROFILING_ENABLED" envDefault:"false"`
+	// Port serves the profiling endpoints on a dedicated port rather than on
+	// the metrics port, which is used when it is 0
+	Port int `env:"PROFILING_PORT" envDefault:"0"`
+	// PyroscopeURL continuously pushes profiles to the Pyroscope server at
+	// the URL, e.g. http://pyroscope:4040, when set
+	PyroscopeURL string `env:"PROFILING_PYROSCOPE_URL"`
+	// Interval is how often profiles are pushed, see WithInterval
+	Interval time.Duration `env:"PROFILING_INTERVAL" envDefault:"10s"`
+}
+
+// Validate reports whether the config can be used to serve and push profiles
+func (config Profiling) Validate() error {
+	var errs error
+
+	if config.Port < 0 || config.Port > 65535 {
+		errs = errors.Join(errs, fmt.Errorf("profiling port %d is not between 0 and 65535", config.Port))
+	}
+
+	if config.PyroscopeURL != "" {
+		u, err := url.Parse(config.PyroscopeURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			errs = errors.Join(errs, fmt.Errorf("pyroscope url %q is not an absolute url", config.PyroscopeURL))
+		}
+	}
+
+	if config.Interval <= 0 {
+		errs = errors.Join(errs, fmt.Errorf("profiling interval %v is not positive", config.Interval))
+	}
+
+	return errs
+}
+
+// Handler serves the runtime profiles of net/http/pprof under /debug/pprof/
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(HandlerPattern, pprof.Index)
+	mux.HandleFunc(HandlerPattern+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(HandlerPattern+"profile", pprof.Profile)
+	mux.HandleFunc(HandlerPattern+"symbol", pprof.Symbol)
+	mux.HandleFunc(HandlerPattern+"trace", pprof.Trace)
+
+	return mux
+}
+
+// Serve listens on port and serves Handler in the background until the
+// returned shutdown func is called
+func Serve(port int) (func(context.Context) error, error) {
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           Handler(),
+		ReadTimeout:       15 * time.Second,
+		IdleTimeout:       360 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		MaxHeaderBytes:    1 << 20, // 1 MB
+	}
+
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for profiling server: %w", err)
+	}
+
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("failed to serve/failed while serving profiles",
+				slog.String("error", err.Error()), slog.Int("port", port))
+		}
+	}()
+
+	shutdown := func(ctx context.Context) error {
+		err := server.Shutdown(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to shutdown profiling server: %w", err)
+		}
+
+		err = listener.Close()
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			return fmt.Errorf("failed to close profiling listener: %w", err)
+		}
+
+		return nil
+	}
+
+	return shutdown, nil
+}
@@ -0,0 +1,74 @@
+package traces
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/kzs0/kokoro/diagnostics"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+	api "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// maxQueuedSpans is the number of spans waiting to be exported past which
+// ended spans are dropped, the size of the batch span processor's queue
+const maxQueuedSpans = api.DefaultMaxQueueSize
+
+// queue counts the spans of a destination waiting to be exported. The batch
+// span processor drops spans when its queue is full without reporting it, so
+// spans are dropped and counted before reaching it instead, holding their
+// place in the queue until exported.
+type queue struct {
+	queued atomic.Int64
+}
+
+// reserve reports whether there is room for another span, taking it
+func (q *queue) reserve() bool {
+	for {
+		n := q.queued.Load()
+		if n >= maxQueuedSpans {
+			return false
+		}
+
+		if q.queued.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+func (q *queue) release(n int) {
+	q.queued.Add(-int64(n))
+}
+
+// queueingProcessor drops the spans ended while the queue is full
+type queueingProcessor struct {
+	api.SpanProcessor
+	queue *queue
+}
+
+func (p queueingProcessor) OnEnd(s api.ReadOnlySpan) {
+	// unsampled spans are never exported, so they don't take a place
+	if s.SpanContext().IsSampled() && !p.queue.reserve() {
+		diagnostics.Dropped(context.Background(), metrics.SignalSpans, "queue_full", 1)
+		return
+	}
+
+	p.SpanProcessor.OnEnd(s)
+}
+
+// queueingExporter releases the places of the spans exported, counting them
+// as dropped when the export fails
+type queueingExporter struct {
+	api.SpanExporter
+	queue *queue
+}
+
+func (e queueingExporter) ExportSpans(ctx context.Context, spans []api.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	e.queue.release(len(spans))
+
+	if err != nil {
+		diagnostics.Dropped(ctx, metrics.SignalSpans, "export_failed", len(spans))
+	}
+
+	return err
+}
@@ -0,0 +1,81 @@
+package traces
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	api "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Filter reports whether an ended span is exported
+type Filter func(api.ReadOnlySpan) bool
+
+// ErrorsOnly exports the spans that ended in error
+func ErrorsOnly() Filter {
+	return func(s api.ReadOnlySpan) bool {
+		return s.Status().Code == codes.Error
+	}
+}
+
+// MinDuration exports the spans lasting at least d
+func MinDuration(d time.Duration) Filter {
+	return func(s api.ReadOnlySpan) bool {
+		return s.EndTime().Sub(s.StartTime()) >= d
+	}
+}
+
+type destination struct {
+	exporter api.SpanExporter
+	filters  []Filter
+}
+
+// WithExporter exports spans to an additional destination, alongside the
+// exporter configured by TRACES_EXPORTER. Only the spans passing every filter
+// are exported to it.
+func WithExporter(exporter api.SpanExporter, filters ...Filter) Option {
+	return func(opts *traceOpts) {
+		opts.destinations = append(opts.destinations, destination{exporter: exporter, filters: filters})
+	}
+}
+
+// WithExporterFilter only exports the spans passing every filter to the
+// exporter configured by TRACES_EXPORTER, e.g. ErrorsOnly to keep the console
+// quiet while another exporter receives every span
+func WithExporterFilter(filters ...Filter) Option {
+	return func(opts *traceOpts) {
+		opts.filters = append(opts.filters, filters...)
+	}
+}
+
+// filteringProcessor only passes the spans passing every filter on to the
+// processor it wraps
+type filteringProcessor struct {
+	api.SpanProcessor
+	filters []Filter
+}
+
+func (p filteringProcessor) OnEnd(s api.ReadOnlySpan) {
+	for _, f := range p.filters {
+		if !f(s) {
+			return
+		}
+	}
+
+	p.SpanProcessor.OnEnd(s)
+}
+
+// processor batches the spans exported to the destination, counting the
+// spans dropped because the queue was full or the export failed
+func (d destination) processor() api.SpanProcessor {
+	q := &queue{}
+	bsp := api.NewBatchSpanProcessor(queueingExporter{SpanExporter: d.exporter, queue: q},
+		api.WithMaxQueueSize(maxQueuedSpans),
+	)
+
+	var p api.SpanProcessor = queueingProcessor{SpanProcessor: bsp, queue: q}
+	if len(d.filters) == 0 {
+		return p
+	}
+
+	return filteringProcessor{SpanProcessor: p, filters: d.filters}
+}
@@ -0,0 +1,436 @@
+package traces
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	api "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	protocolHTTPJSON     = "http/json"
+	protocolHTTPProtobuf = "http/protobuf"
+	tracesPath           = "/v1/traces"
+)
+
+var ErrExporterStopped = errors.New("otlp exporter has been shut down")
+
+// otlpExporter exports spans to an OpenTelemetry collector with the OTLP/HTTP
+// protocol, encoding them as JSON or protobuf
+type otlpExporter struct {
+	url      string
+	protobuf bool
+	headers  map[string]string
+	client   *http.Client
+	stopped  atomic.Bool
+}
+
+// newOTLPExporter creates an exporter sending spans to the endpoint of the
+// config
+func newOTLPExporter(config Traces) (*otlpExporter, error) {
+	headers, err := ParseHeaders(config.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := config.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &otlpExporter{
+		url:      strings.TrimSuffix(config.Endpoint, "/") + tracesPath,
+		protobuf: config.Protocol == protocolHTTPProtobuf,
+		headers:  headers,
+		client: &http.Client{
+			Timeout:   config.Timeout,
+			Transport: transport,
+		},
+	}, nil
+}
+
+// TLSConfig returns the TLS config the collector is verified with, honoring
+// Insecure and CAFile
+func (config Traces) TLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.Insecure}
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trace exporter CA: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("trace exporter CA %s has no certificates", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// OTLPExporterFunc creates the exporter of an OTLP protocol from the config
+type OTLPExporterFunc func(config Traces) (api.SpanExporter, error)
+
+var otlpProtocols sync.Map
+
+// RegisterOTLPProtocol makes the protocol available as TRACES_PROTOCOL,
+// exporting spans with the exporter fn creates. kokoro does not depend on
+// gRPC, the grpc protocol is registered by importing the otlpgrpc module:
+//
+//	import _ "github.com/kzs0/kokoro/telemetry/traces/otlpgrpc"
+func RegisterOTLPProtocol(protocol string, fn OTLPExporterFunc) {
+	otlpProtocols.Store(protocol, fn)
+}
+
+// registeredProtocol returns the exporter func registered for the protocol
+func registeredProtocol(protocol string) (OTLPExporterFunc, bool) {
+	fn, ok := otlpProtocols.Load(protocol)
+	if !ok {
+		return nil, false
+	}
+
+	return fn.(OTLPExporterFunc), true
+}
+
+// ParseHeaders parses the headers sent to the OTLP endpoint, formatted as
+// k1=v1,k2=v2
+func ParseHeaders(headers string) (map[string]string, error) {
+	parsed := make(map[string]string)
+	if strings.TrimSpace(headers) == "" {
+		return parsed, nil
+	}
+
+	for _, pair := range strings.Split(headers, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("trace exporter header %q is not formatted as key=value", pair)
+		}
+
+		parsed[k] = strings.TrimSpace(v)
+	}
+
+	return parsed, nil
+}
+
+func (e *otlpExporter) ExportSpans(ctx context.Context, spans []api.ReadOnlySpan) error {
+	if e.stopped.Load() {
+		return ErrExporterStopped
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, contentType, err := e.encode(spans)
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create export request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to export %d spans: %w", len(spans), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to export %d spans: %s: %s", len(spans), resp.Status, bytes.TrimSpace(body))
+	}
+
+	return nil
+}
+
+// encode returns the request body exporting spans and its content type
+func (e *otlpExporter) encode(spans []api.ReadOnlySpan) ([]byte, string, error) {
+	req := encodeSpans(spans)
+	if e.protobuf {
+		return req.marshalProto(), "application/x-protobuf", nil
+	}
+
+	body, err := json.Marshal(req)
+	return body, "application/json", err
+}
+
+func (e *otlpExporter) Shutdown(ctx context.Context) error {
+	e.stopped.Store(true)
+	e.client.CloseIdleConnections()
+
+	return nil
+}
+
+// The types below are the JSON encoding of the OTLP trace service request,
+// see opentelemetry-proto/opentelemetry/proto/trace/v1/trace.proto. Integers
+// of 64 bits are encoded as strings and IDs as hex, as OTLP/JSON requires.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	SchemaURL  string           `json:"schemaUrl,omitempty"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope     otlpScope  `json:"scope"`
+	Spans     []otlpSpan `json:"spans"`
+	SchemaURL string     `json:"schemaUrl,omitempty"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID                string         `json:"traceId"`
+	SpanID                 string         `json:"spanId"`
+	TraceState             string         `json:"traceState,omitempty"`
+	ParentSpanID           string         `json:"parentSpanId,omitempty"`
+	Name                   string         `json:"name"`
+	Kind                   int            `json:"kind"`
+	StartTimeUnixNano      string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano        string         `json:"endTimeUnixNano"`
+	Attributes             []otlpKeyValue `json:"attributes,omitempty"`
+	DroppedAttributesCount int            `json:"droppedAttributesCount,omitempty"`
+	Events                 []otlpEvent    `json:"events,omitempty"`
+	DroppedEventsCount     int            `json:"droppedEventsCount,omitempty"`
+	Links                  []otlpLink     `json:"links,omitempty"`
+	DroppedLinksCount      int            `json:"droppedLinksCount,omitempty"`
+	Status                 otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpLink struct {
+	TraceID    string         `json:"traceId"`
+	SpanID     string         `json:"spanId"`
+	TraceState string         `json:"traceState,omitempty"`
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Message string `json:"message,omitempty"`
+	Code    int    `json:"code"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string         `json:"stringValue,omitempty"`
+	BoolValue   *bool           `json:"boolValue,omitempty"`
+	IntValue    *string         `json:"intValue,omitempty"`
+	DoubleValue *otlpDouble     `json:"doubleValue,omitempty"`
+	ArrayValue  *otlpArrayValue `json:"arrayValue,omitempty"`
+}
+
+type otlpArrayValue struct {
+	Values []otlpAnyValue `json:"values"`
+}
+
+// otlpDouble encodes NaN and infinities as the strings OTLP/JSON expects, as
+// JSON numbers cannot represent them
+type otlpDouble float64
+
+func (d otlpDouble) MarshalJSON() ([]byte, error) {
+	f := float64(d)
+	switch {
+	case math.IsNaN(f):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(f, 1):
+		return []byte(`"Infinity"`), nil
+	case math.IsInf(f, -1):
+		return []byte(`"-Infinity"`), nil
+	}
+
+	return json.Marshal(f)
+}
+
+// encodeSpans groups spans by their resource and instrumentation scope
+func encodeSpans(spans []api.ReadOnlySpan) otlpRequest {
+	type scopeKey struct {
+		resource *resource.Resource
+		scope    instrumentation.Scope
+	}
+
+	resources := make([]*resource.Resource, 0, 1)
+	scopes := make(map[*resource.Resource][]instrumentation.Scope)
+	grouped := make(map[scopeKey][]otlpSpan)
+	for _, s := range spans {
+		res, scope := s.Resource(), s.InstrumentationScope()
+		if _, ok := scopes[res]; !ok {
+			resources = append(resources, res)
+		}
+
+		k := scopeKey{resource: res, scope: scope}
+		if _, ok := grouped[k]; !ok {
+			scopes[res] = append(scopes[res], scope)
+		}
+		grouped[k] = append(grouped[k], encodeSpan(s))
+	}
+
+	req := otlpRequest{ResourceSpans: make([]otlpResourceSpans, 0, len(resources))}
+	for _, res := range resources {
+		rs := otlpResourceSpans{
+			Resource:  otlpResource{Attributes: encodeAttributes(res.Attributes())},
+			SchemaURL: res.SchemaURL(),
+		}
+		for _, scope := range scopes[res] {
+			rs.ScopeSpans = append(rs.ScopeSpans, otlpScopeSpans{
+				Scope:     otlpScope{Name: scope.Name, Version: scope.Version},
+				Spans:     grouped[scopeKey{resource: res, scope: scope}],
+				SchemaURL: scope.SchemaURL,
+			})
+		}
+
+		req.ResourceSpans = append(req.ResourceSpans, rs)
+	}
+
+	return req
+}
+
+func encodeSpan(s api.ReadOnlySpan) otlpSpan {
+	sc := s.SpanContext()
+	span := otlpSpan{
+		TraceID:                sc.TraceID().String(),
+		SpanID:                 sc.SpanID().String(),
+		TraceState:             sc.TraceState().String(),
+		Name:                   s.Name(),
+		Kind:                   int(s.SpanKind()),
+		StartTimeUnixNano:      unixNano(s.StartTime()),
+		EndTimeUnixNano:        unixNano(s.EndTime()),
+		Attributes:             encodeAttributes(s.Attributes()),
+		DroppedAttributesCount: s.DroppedAttributes(),
+		DroppedEventsCount:     s.DroppedEvents(),
+		DroppedLinksCount:      s.DroppedLinks(),
+		Status:                 otlpStatus{Message: s.Status().Description},
+	}
+
+	if parent := s.Parent(); parent.HasSpanID() {
+		span.ParentSpanID = parent.SpanID().String()
+	}
+
+	// OTLP numbers the status codes differently than the API
+	switch s.Status().Code {
+	case codes.Ok:
+		span.Status.Code = 1
+	case codes.Error:
+		span.Status.Code = 2
+	}
+
+	for _, e := range s.Events() {
+		span.Events = append(span.Events, otlpEvent{
+			TimeUnixNano: unixNano(e.Time),
+			Name:         e.Name,
+			Attributes:   encodeAttributes(e.Attributes),
+		})
+	}
+
+	for _, l := range s.Links() {
+		span.Links = append(span.Links, otlpLink{
+			TraceID:    l.SpanContext.TraceID().String(),
+			SpanID:     l.SpanContext.SpanID().String(),
+			TraceState: l.SpanContext.TraceState().String(),
+			Attributes: encodeAttributes(l.Attributes),
+		})
+	}
+
+	return span
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func encodeAttributes(attrs []attribute.KeyValue) []otlpKeyValue {
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		kvs = append(kvs, otlpKeyValue{Key: string(attr.Key), Value: encodeValue(attr.Value)})
+	}
+
+	return kvs
+}
+
+func encodeValue(v attribute.Value) otlpAnyValue {
+	switch v.Type() {
+	case attribute.BOOL:
+		b := v.AsBool()
+		return otlpAnyValue{BoolValue: &b}
+	case attribute.INT64:
+		i := strconv.FormatInt(v.AsInt64(), 10)
+		return otlpAnyValue{IntValue: &i}
+	case attribute.FLOAT64:
+		f := otlpDouble(v.AsFloat64())
+		return otlpAnyValue{DoubleValue: &f}
+	case attribute.BOOLSLICE:
+		values := make([]otlpAnyValue, 0)
+		for _, b := range v.AsBoolSlice() {
+			values = append(values, encodeValue(attribute.BoolValue(b)))
+		}
+		return otlpAnyValue{ArrayValue: &otlpArrayValue{Values: values}}
+	case attribute.INT64SLICE:
+		values := make([]otlpAnyValue, 0)
+		for _, i := range v.AsInt64Slice() {
+			values = append(values, encodeValue(attribute.Int64Value(i)))
+		}
+		return otlpAnyValue{ArrayValue: &otlpArrayValue{Values: values}}
+	case attribute.FLOAT64SLICE:
+		values := make([]otlpAnyValue, 0)
+		for _, f := range v.AsFloat64Slice() {
+			values = append(values, encodeValue(attribute.Float64Value(f)))
+		}
+		return otlpAnyValue{ArrayValue: &otlpArrayValue{Values: values}}
+	case attribute.STRINGSLICE:
+		values := make([]otlpAnyValue, 0)
+		for _, s := range v.AsStringSlice() {
+			values = append(values, encodeValue(attribute.StringValue(s)))
+		}
+		return otlpAnyValue{ArrayValue: &otlpArrayValue{Values: values}}
+	default:
+		s := v.Emit()
+		return otlpAnyValue{StringValue: &s}
+	}
+}
@@ -0,0 +1,204 @@
+package traces
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	api "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestEncodeValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value attribute.Value
+		want  string
+	}{
+		{"string", attribute.StringValue("a"), `{"stringValue":"a"}`},
+		{"bool", attribute.BoolValue(true), `{"boolValue":true}`},
+		{"int", attribute.Int64Value(math.MaxInt64), `{"intValue":"9223372036854775807"}`},
+		{"double", attribute.Float64Value(1.5), `{"doubleValue":1.5}`},
+		{"NaN", attribute.Float64Value(math.NaN()), `{"doubleValue":"NaN"}`},
+		{"infinity", attribute.Float64Value(math.Inf(1)), `{"doubleValue":"Infinity"}`},
+		{"negative infinity", attribute.Float64Value(math.Inf(-1)), `{"doubleValue":"-Infinity"}`},
+		{"array", attribute.Float64SliceValue([]float64{1, math.Inf(-1)}), `{"arrayValue":{"values":[{"doubleValue":1},{"doubleValue":"-Infinity"}]}}`},
+		{"empty array", attribute.StringSliceValue(nil), `{"arrayValue":{"values":[]}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(encodeValue(tt.value))
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("encodeValue() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportSpans(t *testing.T) {
+	traceID := trace.TraceID{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10}
+	spanID := trace.SpanID{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+	start := time.Unix(1700000000, 0)
+
+	span := tracetest.SpanStub{
+		Name: "checkout",
+		SpanContext: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: traceID,
+			SpanID:  spanID,
+		}),
+		SpanKind:               trace.SpanKindServer,
+		StartTime:              start,
+		EndTime:                start.Add(time.Second),
+		Attributes:             []attribute.KeyValue{attribute.Float64("ratio", math.NaN())},
+		Status:                 api.Status{Code: codes.Error, Description: "boom"},
+		Resource:               resource.NewSchemaless(attribute.String("service.name", "shop")),
+		InstrumentationLibrary: instrumentation.Library{Name: "kokoro"},
+	}.Snapshot()
+
+	tests := []struct {
+		name            string
+		protocol        string
+		wantContentType string
+		check           func(t *testing.T, body []byte)
+	}{
+		{
+			name:            "json",
+			protocol:        protocolHTTPJSON,
+			wantContentType: "application/json",
+			check: func(t *testing.T, body []byte) {
+				var req struct {
+					ResourceSpans []struct {
+						ScopeSpans []struct {
+							Spans []struct {
+								TraceID           string `json:"traceId"`
+								Name              string `json:"name"`
+								Kind              int    `json:"kind"`
+								StartTimeUnixNano string `json:"startTimeUnixNano"`
+								Attributes        []struct {
+									Value struct {
+										DoubleValue string `json:"doubleValue"`
+									} `json:"value"`
+								} `json:"attributes"`
+								Status struct {
+									Code int `json:"code"`
+								} `json:"status"`
+							} `json:"spans"`
+						} `json:"scopeSpans"`
+					} `json:"resourceSpans"`
+				}
+				if err := json.Unmarshal(body, &req); err != nil {
+					t.Fatalf("json.Unmarshal() error = %v", err)
+				}
+
+				s := req.ResourceSpans[0].ScopeSpans[0].Spans[0]
+				if s.TraceID != traceID.String() || s.Name != "checkout" || s.Kind != int(trace.SpanKindServer) {
+					t.Errorf("span = %+v", s)
+				}
+				if s.StartTimeUnixNano != "1700000000000000000" {
+					t.Errorf("startTimeUnixNano = %s", s.StartTimeUnixNano)
+				}
+				if s.Attributes[0].Value.DoubleValue != "NaN" {
+					t.Errorf("doubleValue = %s, want NaN", s.Attributes[0].Value.DoubleValue)
+				}
+				if s.Status.Code != 2 {
+					t.Errorf("status code = %d, want 2", s.Status.Code)
+				}
+			},
+		},
+		{
+			name:            "protobuf",
+			protocol:        protocolHTTPProtobuf,
+			wantContentType: "application/x-protobuf",
+			check: func(t *testing.T, body []byte) {
+				resourceSpans := field(t, body, 1)
+				if key := field(t, field(t, field(t, resourceSpans, 1), 1), 1); string(key) != "service.name" {
+					t.Errorf("resource attribute = %q, want service.name", key)
+				}
+
+				s := field(t, field(t, resourceSpans, 2), 2)
+				if got := field(t, s, 1); string(got) != string(traceID[:]) {
+					t.Errorf("trace id = %x, want %x", got, traceID)
+				}
+				if got := field(t, s, 5); string(got) != "checkout" {
+					t.Errorf("name = %q, want checkout", got)
+				}
+				if got := field(t, s, 15); string(field(t, got, 2)) != "boom" {
+					t.Errorf("status = %x", got)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var contentType string
+			var body []byte
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contentType = r.Header.Get("Content-Type")
+				body, _ = io.ReadAll(r.Body)
+			}))
+			defer srv.Close()
+
+			exporter, err := newOTLPExporter(Traces{Endpoint: srv.URL, Protocol: tt.protocol, Timeout: time.Second})
+			if err != nil {
+				t.Fatalf("newOTLPExporter() error = %v", err)
+			}
+
+			if err := exporter.ExportSpans(context.Background(), []api.ReadOnlySpan{span}); err != nil {
+				t.Fatalf("ExportSpans() error = %v", err)
+			}
+
+			if contentType != tt.wantContentType {
+				t.Errorf("Content-Type = %s, want %s", contentType, tt.wantContentType)
+			}
+			tt.check(t, body)
+		})
+	}
+}
+
+// field returns the value of the first length-delimited field num of the
+// protobuf message b
+func field(t *testing.T, b []byte, num protowire.Number) []byte {
+	t.Helper()
+
+	for len(b) > 0 {
+		n, typ, l := protowire.ConsumeTag(b)
+		if l < 0 {
+			t.Fatalf("invalid tag: %v", protowire.ParseError(l))
+		}
+		b = b[l:]
+
+		if n == num && typ == protowire.BytesType {
+			v, l := protowire.ConsumeBytes(b)
+			if l < 0 {
+				t.Fatalf("invalid field %d: %v", num, protowire.ParseError(l))
+			}
+			return v
+		}
+
+		l = protowire.ConsumeFieldValue(n, typ, b)
+		if l < 0 {
+			t.Fatalf("invalid field %d: %v", n, protowire.ParseError(l))
+		}
+		b = b[l:]
+	}
+
+	t.Fatalf("field %d not found", num)
+	return nil
+}
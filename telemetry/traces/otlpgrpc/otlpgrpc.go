@@ -0,0 +1,60 @@
+// Package otlpgrpc registers the grpc protocol of OTLP trace exports, so
+// TRACES_PROTOCOL=grpc can be used once it is imported:
+//
+//	import _ "github.com/kzs0/kokoro/telemetry/traces/otlpgrpc"
+//
+// It is a module of its own so kokoro does not depend on gRPC. The endpoint,
+// headers, timeout, and TLS settings of the trace config are honored. The
+// endpoint is the URL of the gRPC port of the collector, usually 4317, and is
+// connected to without TLS when its scheme is http.
+package otlpgrpc
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/kzs0/kokoro/telemetry/traces"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	api "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/credentials"
+)
+
+// Protocol is the TRACES_PROTOCOL the exporter is registered as
+const Protocol = "grpc"
+
+func init() {
+	traces.RegisterOTLPProtocol(Protocol, New)
+}
+
+// New creates an exporter sending spans to the endpoint of the config over
+// gRPC
+func New(config traces.Traces) (api.SpanExporter, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("trace endpoint %q is not a URL: %w", config.Endpoint, err)
+	}
+
+	headers, err := traces.ParseHeaders(config.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []otlptracegrpc.Option{
+		otlptracegrpc.WithEndpointURL(config.Endpoint),
+		otlptracegrpc.WithHeaders(headers),
+		otlptracegrpc.WithTimeout(config.Timeout),
+	}
+	if endpoint.Scheme != "http" {
+		tlsConfig, err := config.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+	}
+
+	// the connection is established lazily, so this doesn't block on the
+	// collector being reachable
+	return otlptracegrpc.New(context.Background(), opts...)
+}
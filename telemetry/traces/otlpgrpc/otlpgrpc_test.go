@@ -0,0 +1,87 @@
+package otlpgrpc_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/kzs0/kokoro/telemetry/traces"
+	_ "github.com/kzs0/kokoro/telemetry/traces/otlpgrpc"
+	"go.opentelemetry.io/otel"
+	collector "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type collectorServer struct {
+	collector.UnimplementedTraceServiceServer
+
+	mu      sync.Mutex
+	spans   []string
+	headers metadata.MD
+}
+
+func (s *collectorServer) Export(ctx context.Context, req *collector.ExportTraceServiceRequest) (*collector.ExportTraceServiceResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.headers, _ = metadata.FromIncomingContext(ctx)
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				s.spans = append(s.spans, span.Name)
+			}
+		}
+	}
+
+	return &collector.ExportTraceServiceResponse{}, nil
+}
+
+func TestExport(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &collectorServer{}
+	server := grpc.NewServer()
+	collector.RegisterTraceServiceServer(server, srv)
+	go server.Serve(l)
+	defer server.Stop()
+
+	config := traces.Traces{
+		Style:       "OTLP",
+		Protocol:    "grpc",
+		ServiceName: "otlpgrpc_test",
+		SampleRatio: 1,
+		Endpoint:    "http://" + l.Addr().String(),
+		Headers:     "x-tenant=acme",
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	ctx := context.Background()
+	if err := traces.Init(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	defer traces.Shutdown(ctx)
+
+	_, span := otel.Tracer("otlpgrpc_test").Start(ctx, "checkout")
+	span.End()
+
+	if err := traces.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if len(srv.spans) != 1 || srv.spans[0] != "checkout" {
+		t.Errorf("exported spans = %v, want [checkout]", srv.spans)
+	}
+	if got := srv.headers.Get("x-tenant"); len(got) != 1 || got[0] != "acme" {
+		t.Errorf("x-tenant header = %v, want [acme]", got)
+	}
+}
@@ -0,0 +1,175 @@
+package traces
+
+import (
+	"encoding/hex"
+	"math"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The functions below encode the OTLP trace service request as protobuf for
+// the http/protobuf protocol, from the same types as the JSON encoding. The
+// field numbers are those of opentelemetry-proto/opentelemetry/proto/trace/v1
+// and common/v1. Fields holding their zero value are omitted, as proto3 does.
+
+func (r otlpRequest) marshalProto() []byte {
+	var b []byte
+	for _, rs := range r.ResourceSpans {
+		b = appendMessage(b, 1, rs.marshalProto())
+	}
+
+	return b
+}
+
+func (rs otlpResourceSpans) marshalProto() []byte {
+	var b []byte
+	b = appendMessage(b, 1, marshalAttributes(nil, 1, rs.Resource.Attributes))
+	for _, ss := range rs.ScopeSpans {
+		b = appendMessage(b, 2, ss.marshalProto())
+	}
+	b = appendString(b, 3, rs.SchemaURL)
+
+	return b
+}
+
+func (ss otlpScopeSpans) marshalProto() []byte {
+	var scope []byte
+	scope = appendString(scope, 1, ss.Scope.Name)
+	scope = appendString(scope, 2, ss.Scope.Version)
+
+	var b []byte
+	b = appendMessage(b, 1, scope)
+	for _, s := range ss.Spans {
+		b = appendMessage(b, 2, s.marshalProto())
+	}
+	b = appendString(b, 3, ss.SchemaURL)
+
+	return b
+}
+
+func (s otlpSpan) marshalProto() []byte {
+	var b []byte
+	b = appendHex(b, 1, s.TraceID)
+	b = appendHex(b, 2, s.SpanID)
+	b = appendString(b, 3, s.TraceState)
+	b = appendHex(b, 4, s.ParentSpanID)
+	b = appendString(b, 5, s.Name)
+	b = appendVarint(b, 6, uint64(s.Kind))
+	b = appendTime(b, 7, s.StartTimeUnixNano)
+	b = appendTime(b, 8, s.EndTimeUnixNano)
+	b = marshalAttributes(b, 9, s.Attributes)
+	b = appendVarint(b, 10, uint64(s.DroppedAttributesCount))
+	for _, e := range s.Events {
+		var event []byte
+		event = appendTime(event, 1, e.TimeUnixNano)
+		event = appendString(event, 2, e.Name)
+		event = marshalAttributes(event, 3, e.Attributes)
+		b = appendMessage(b, 11, event)
+	}
+	b = appendVarint(b, 12, uint64(s.DroppedEventsCount))
+	for _, l := range s.Links {
+		var link []byte
+		link = appendHex(link, 1, l.TraceID)
+		link = appendHex(link, 2, l.SpanID)
+		link = appendString(link, 3, l.TraceState)
+		link = marshalAttributes(link, 4, l.Attributes)
+		b = appendMessage(b, 13, link)
+	}
+	b = appendVarint(b, 14, uint64(s.DroppedLinksCount))
+
+	var status []byte
+	status = appendString(status, 2, s.Status.Message)
+	status = appendVarint(status, 3, uint64(s.Status.Code))
+	b = appendMessage(b, 15, status)
+
+	return b
+}
+
+func marshalAttributes(b []byte, num protowire.Number, kvs []otlpKeyValue) []byte {
+	for _, kv := range kvs {
+		var m []byte
+		m = appendString(m, 1, kv.Key)
+		m = appendMessage(m, 2, kv.Value.marshalProto())
+		b = appendMessage(b, num, m)
+	}
+
+	return b
+}
+
+func (v otlpAnyValue) marshalProto() []byte {
+	var b []byte
+	switch {
+	case v.StringValue != nil:
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, *v.StringValue)
+	case v.BoolValue != nil:
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(*v.BoolValue))
+	case v.IntValue != nil:
+		i, _ := strconv.ParseInt(*v.IntValue, 10, 64)
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(i))
+	case v.DoubleValue != nil:
+		b = protowire.AppendTag(b, 4, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(float64(*v.DoubleValue)))
+	case v.ArrayValue != nil:
+		var array []byte
+		for _, value := range v.ArrayValue.Values {
+			array = protowire.AppendTag(array, 1, protowire.BytesType)
+			array = protowire.AppendBytes(array, value.marshalProto())
+		}
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendBytes(b, array)
+	}
+
+	return b
+}
+
+// appendMessage appends the embedded message m, even when empty, as the
+// resource and status of a span are always sent
+func appendMessage(b []byte, num protowire.Number, m []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// appendHex appends the ID encoded as hex by the JSON encoding as bytes
+func appendHex(b []byte, num protowire.Number, id string) []byte {
+	raw, err := hex.DecodeString(id)
+	if err != nil || len(raw) == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, raw)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// appendTime appends the time encoded as a decimal string by the JSON
+// encoding as fixed64 nanoseconds
+func appendTime(b []byte, num protowire.Number, nanos string) []byte {
+	t, err := strconv.ParseUint(nanos, 10, 64)
+	if err != nil || t == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, t)
+}
@@ -0,0 +1,171 @@
+package traces
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kzs0/kokoro/internal/clock"
+	"go.opentelemetry.io/otel/attribute"
+	api "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SamplingHintKey is the span start attribute used to request that a span is
+// always or never sampled, regardless of the configured sampler
+const SamplingHintKey = attribute.Key("kokoro.sampling.hint")
+
+const (
+	SamplingHintAlways = "always"
+	SamplingHintNever  = "never"
+)
+
+// The samplers selectable with TRACES_SAMPLER, named as OTEL_TRACES_SAMPLER
+// names them where they overlap
+const (
+	SamplerAlwaysOn            = "always_on"
+	SamplerAlwaysOff           = "always_off"
+	SamplerRatio               = "traceidratio"
+	SamplerParentBasedAlwaysOn = "parentbased_always_on"
+	SamplerParentBasedRatio    = "parentbased_traceidratio"
+	// SamplerRateLimited samples up to TRACES_SAMPLE_RATE new traces per
+	// second, following the decision of the parent otherwise
+	SamplerRateLimited = "ratelimited"
+)
+
+// ratioSampler samples a ratio of traces by trace ID, allowing the ratio to be
+// changed while the process is running
+type ratioSampler struct {
+	sampler atomic.Pointer[api.Sampler]
+}
+
+var sampleRatio = newRatioSampler(1)
+
+func newRatioSampler(ratio float64) *ratioSampler {
+	s := &ratioSampler{}
+	s.set(ratio)
+
+	return s
+}
+
+func (s *ratioSampler) set(ratio float64) {
+	sampler := api.TraceIDRatioBased(ratio)
+	s.sampler.Store(&sampler)
+}
+
+func (s *ratioSampler) ShouldSample(p api.SamplingParameters) api.SamplingResult {
+	return (*s.sampler.Load()).ShouldSample(p)
+}
+
+func (s *ratioSampler) Description() string {
+	return (*s.sampler.Load()).Description()
+}
+
+// SetSampleRatio changes the ratio of traces sampled by the provider started
+// by Init, when it samples with one of the ratio samplers
+func SetSampleRatio(ratio float64) {
+	sampleRatio.set(ratio)
+}
+
+type hintSampler struct {
+	base api.Sampler
+}
+
+// HintSampler wraps a sampler so spans started with a SamplingHintKey
+// attribute are always or never sampled as requested. Spans without a hint are
+// sampled by the base sampler.
+func HintSampler(base api.Sampler) api.Sampler {
+	return hintSampler{base: base}
+}
+
+func (s hintSampler) ShouldSample(p api.SamplingParameters) api.SamplingResult {
+	for _, attr := range p.Attributes {
+		if attr.Key != SamplingHintKey {
+			continue
+		}
+
+		state := trace.SpanContextFromContext(p.ParentContext).TraceState()
+		switch attr.Value.AsString() {
+		case SamplingHintAlways:
+			return api.SamplingResult{Decision: api.RecordAndSample, Tracestate: state}
+		case SamplingHintNever:
+			return api.SamplingResult{Decision: api.Drop, Tracestate: state}
+		}
+	}
+
+	return s.base.ShouldSample(p)
+}
+
+func (s hintSampler) Description() string {
+	return fmt.Sprintf("HintSampler{%s}", s.base.Description())
+}
+
+// rateLimitedSampler samples up to a number of spans per second, allowing
+// bursts of up to a second's worth
+type rateLimitedSampler struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// RateLimitedSampler samples up to rate spans per second. Wrapped with
+// api.ParentBased, as the ratelimited sampler is, it limits the number of
+// traces started per second.
+func RateLimitedSampler(rate float64) api.Sampler {
+	return &rateLimitedSampler{
+		rate:   rate,
+		tokens: math.Max(rate, 1),
+		last:   clock.Now(),
+	}
+}
+
+func (s *rateLimitedSampler) ShouldSample(p api.SamplingParameters) api.SamplingResult {
+	state := trace.SpanContextFromContext(p.ParentContext).TraceState()
+	if s.take() {
+		return api.SamplingResult{Decision: api.RecordAndSample, Tracestate: state}
+	}
+
+	return api.SamplingResult{Decision: api.Drop, Tracestate: state}
+}
+
+func (s *rateLimitedSampler) take() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := clock.Now()
+	s.tokens = math.Min(s.tokens+now.Sub(s.last).Seconds()*s.rate, math.Max(s.rate, 1))
+	s.last = now
+
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+
+	return true
+}
+
+func (s *rateLimitedSampler) Description() string {
+	return fmt.Sprintf("RateLimitedSampler{%g}", s.rate)
+}
+
+// sampler returns the sampler configured by the config
+func (config Traces) sampler() api.Sampler {
+	switch strings.ToLower(config.Sampler) {
+	case SamplerAlwaysOn:
+		return api.AlwaysSample()
+	case SamplerAlwaysOff:
+		return api.NeverSample()
+	case SamplerParentBasedAlwaysOn:
+		return api.ParentBased(api.AlwaysSample())
+	case SamplerParentBasedRatio:
+		return api.ParentBased(sampleRatio)
+	case SamplerRateLimited:
+		return api.ParentBased(RateLimitedSampler(config.SampleRate))
+	default:
+		return sampleRatio
+	}
+}
@@ -3,24 +3,145 @@ package traces
 import (
 	"context"
 	"fmt"
-	"log/slog"
+	"net/url"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
 	api "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
-// TODO endpoint for pushing traces and whether to use stdouttrace
 type Traces struct {
-	Style string `env:"TRACES_EXPORTER" envDefault:"CONSOLE"`
+	// Enabled turns traces off when false, leaving it unset keeps them on
+	Enabled     *bool   `env:"TRACES_ENABLED"`
+	Disabled    bool    `env:"TRACES_DISABLED" envDefault:"false"`
+	Style       string  `env:"TRACES_EXPORTER" envDefault:"CONSOLE"`
+	ServiceName string  `env:"SERVICE_NAME" envDefault:"_"`
+	SampleRatio float64 `env:"TRACES_SAMPLE_RATIO" envDefault:"1"`
+	// Sampler selects how spans are sampled, see SamplerRatio and the other
+	// samplers. The ratio samplers sample SampleRatio of traces.
+	Sampler string `env:"TRACES_SAMPLER" envDefault:"traceidratio"`
+	// SampleRate is the number of traces started per second by the
+	// ratelimited sampler
+	SampleRate float64 `env:"TRACES_SAMPLE_RATE" envDefault:"100"`
+
+	// Endpoint is the base URL of the OTLP collector spans are exported to
+	// when the exporter is OTLP, e.g. http://tempo:4318
+	Endpoint string `env:"TRACES_ENDPOINT" envDefault:"http://localhost:4318"`
+	// Protocol is http/json, http/protobuf, or a protocol registered with
+	// RegisterOTLPProtocol, such as grpc by the otlpgrpc module.
+	Protocol string `env:"TRACES_PROTOCOL" envDefault:"http/json"`
+	// Headers are sent with every export, formatted as k1=v1,k2=v2
+	Headers string `env:"TRACES_HEADERS"`
+	// Insecure skips verifying the certificate of the collector
+	Insecure bool `env:"TRACES_INSECURE"`
+	// CAFile is a PEM file of the certificates the collector is verified with
+	// instead of the system roots
+	CAFile  string        `env:"TRACES_CA_FILE"`
+	Timeout time.Duration `env:"TRACES_TIMEOUT" envDefault:"10s"`
+}
+
+type traceOpts struct {
+	attrs        []attribute.KeyValue
+	sampler      api.Sampler
+	filters      []Filter
+	destinations []destination
+}
+
+type Option func(*traceOpts)
+
+// WithSampler samples spans with the sampler provided instead of the one
+// configured by TRACES_SAMPLER. Sampling hints are still respected.
+func WithSampler(sampler api.Sampler) Option {
+	return func(opts *traceOpts) {
+		opts.sampler = sampler
+	}
+}
+
+// WithAttributes adds attributes to the resource every span is exported with
+func WithAttributes(attrs ...attribute.KeyValue) Option {
+	return func(opts *traceOpts) {
+		opts.attrs = append(opts.attrs, attrs...)
+	}
+}
+
+// tracerProvider is the provider started by Init, read by Flush from crash
+// handlers while Init or Shutdown may be running
+var tracerProvider atomic.Pointer[api.TracerProvider]
+
+// IsEnabled reports whether traces are turned on, which they are unless Enabled
+// is false or Disabled is set
+func (config Traces) IsEnabled() bool {
+	return !config.Disabled && (config.Enabled == nil || *config.Enabled)
+}
+
+// Validate reports whether the config can be used to initialize traces
+func (config Traces) Validate() error {
+	switch strings.ToUpper(config.Style) {
+	case "", "CONSOLE", "NONE":
+	case "OTLP":
+		switch config.Protocol {
+		case "", protocolHTTPJSON, protocolHTTPProtobuf:
+		default:
+			if _, ok := registeredProtocol(config.Protocol); !ok {
+				return fmt.Errorf("%s is not a supported OTLP protocol, only %s, %s, and registered protocols are, import the otlpgrpc module for grpc",
+					config.Protocol, protocolHTTPJSON, protocolHTTPProtobuf)
+			}
+		}
+
+		_, err := url.Parse(config.Endpoint)
+		if err != nil || config.Endpoint == "" {
+			return fmt.Errorf("trace endpoint %q is not a URL", config.Endpoint)
+		}
+
+		_, err = ParseHeaders(config.Headers)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%s is not a supported trace exporter", config.Style)
+	}
+
+	if config.SampleRatio < 0 || config.SampleRatio > 1 {
+		return fmt.Errorf("sample ratio %v is not between 0 and 1", config.SampleRatio)
+	}
+
+	switch strings.ToLower(config.Sampler) {
+	case "", SamplerAlwaysOn, SamplerAlwaysOff, SamplerRatio, SamplerParentBasedAlwaysOn, SamplerParentBasedRatio:
+	case SamplerRateLimited:
+		if config.SampleRate <= 0 {
+			return fmt.Errorf("sample rate %v is not positive", config.SampleRate)
+		}
+	default:
+		return fmt.Errorf("%s is not a supported trace sampler", config.Sampler)
+	}
+
+	return nil
 }
 
-func Init(ctx context.Context, config Traces) error {
+func Init(ctx context.Context, config Traces, options ...Option) error {
+	opts := traceOpts{}
+	for _, o := range options {
+		o(&opts)
+	}
+
 	var exporter api.SpanExporter
 	var err error
 
 	switch strings.ToUpper(config.Style) {
+	case "NONE":
+	case "OTLP":
+		if fn, ok := registeredProtocol(config.Protocol); ok {
+			exporter, err = fn(config)
+		} else {
+			exporter, err = newOTLPExporter(config)
+		}
 	case "CONSOLE":
 		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
 	default:
@@ -31,23 +152,83 @@ func Init(ctx context.Context, config Traces) error {
 		return fmt.Errorf("failed to load trace exporter: %w", err)
 	}
 
-	bsp := api.NewBatchSpanProcessor(exporter)
-	provider := api.NewTracerProvider(
-		api.WithSampler(api.AlwaysSample()),
-		api.WithSpanProcessor(bsp),
-	)
+	destinations := opts.destinations
+	if exporter != nil {
+		destinations = append([]destination{{exporter: exporter, filters: opts.filters}}, destinations...)
+	}
+
+	attrs := append([]attribute.KeyValue{semconv.ServiceName(config.ServiceName)}, opts.attrs...)
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, attrs...))
+	if err != nil {
+		return fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	SetSampleRatio(config.SampleRatio)
+
+	sampler := opts.sampler
+	if sampler == nil {
+		sampler = config.sampler()
+	}
+
+	providerOpts := []api.TracerProviderOption{
+		api.WithResource(res),
+		api.WithSampler(HintSampler(sampler)),
+	}
+	for _, d := range destinations {
+		providerOpts = append(providerOpts, api.WithSpanProcessor(d.processor()))
+	}
+
+	provider := api.NewTracerProvider(providerOpts...)
 	otel.SetTracerProvider(provider)
+	tracerProvider.Store(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
 
-	go func() {
-		select {
-		case <-ctx.Done():
-			err = provider.Shutdown(ctx)
-			if err != nil {
-				slog.Error("faield to shutdown trace provider",
-					slog.String("error", err.Error()))
-			}
-		}
-	}()
+	return nil
+}
+
+// RegisterProcessor adds p to the trace provider started by Init, returning a
+// func removing it. It reports false when traces have not been initialized.
+func RegisterProcessor(p api.SpanProcessor) (func(), bool) {
+	provider := tracerProvider.Load()
+	if provider == nil {
+		return func() {}, false
+	}
+
+	provider.RegisterSpanProcessor(p)
+
+	return func() { provider.UnregisterSpanProcessor(p) }, true
+}
+
+// Flush exports any buffered spans without stopping the trace provider
+func Flush(ctx context.Context) error {
+	provider := tracerProvider.Load()
+	if provider == nil {
+		return nil
+	}
+
+	err := provider.ForceFlush(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to flush trace provider: %w", err)
+	}
+
+	return nil
+}
+
+// Shutdown flushes any buffered spans and stops the trace provider started by
+// Init, giving up once ctx is done
+func Shutdown(ctx context.Context) error {
+	provider := tracerProvider.Swap(nil)
+	if provider == nil {
+		return nil
+	}
+
+	err := provider.Shutdown(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to shutdown trace provider: %w", err)
+	}
 
 	return nil
 }
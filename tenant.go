@@ -0,0 +1,25 @@
+package kokoro
+
+import (
+	"context"
+
+	"github.com/kzs0/kokoro/koko"
+)
+
+// WithTenantAttribute designates the attribute identifying the tenant of a
+// request, which every operation of the request registers on its logs and
+// span, and labels its metrics with when it is one of the allowed tenants,
+// see koko.SetTenantAttribute. The tenant is set with WithTenant.
+func WithTenantAttribute(key string, allowed ...string) Option {
+	return func(o *options) {
+		o.tenantKey = key
+		o.tenants = allowed
+		o.partitioned = true
+	}
+}
+
+// WithTenant returns a context whose operations report the tenant provided,
+// e.g. from an authentication middleware, see koko.WithTenant
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return koko.WithTenant(ctx, tenant)
+}
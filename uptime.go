@@ -0,0 +1,117 @@
+package kokoro
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"time"
+
+	"github.com/kzs0/kokoro/internal/clock"
+	"github.com/kzs0/kokoro/telemetry/metrics"
+)
+
+// uptimeInterval is how often the uptime gauge is updated when no heartbeat
+// is configured
+const uptimeInterval = 15 * time.Second
+
+// processStart approximates the start of the process as the initialization of
+// the package
+var processStart = clock.Now()
+
+// WithHeartbeat logs basic runtime stats and increments the heartbeats
+// counter every interval, so a service that has stopped making progress
+// without crashing can be detected by their absence. The uptime gauge is
+// updated on the same interval.
+func WithHeartbeat(interval time.Duration) Option {
+	return func(o *options) {
+		o.heartbeat = interval
+	}
+}
+
+// watchUptime exports the process_start_time_seconds gauge and keeps the
+// uptime_seconds gauge current until ctx is done. The closer it returns waits
+// for the loop to exit, so it does not outlive the metrics it records to.
+func watchUptime(ctx context.Context, heartbeat time.Duration) func(context.Context) error {
+	stopped := make(chan struct{})
+	closer := func(ctx context.Context) error {
+		select {
+		case <-stopped:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if Default().Metrics() == nil {
+		close(stopped)
+		return closer
+	}
+
+	start, err := Default().Metrics().NewGauge("process_start_time_seconds",
+		metrics.WithDescription("Start time of the process since unix epoch in seconds."),
+	)
+	if err == nil {
+		_ = start.Measure(ctx, float64(processStart.UnixNano())/float64(time.Second))
+	}
+
+	interval := uptimeInterval
+	if heartbeat > 0 {
+		interval = heartbeat
+	}
+
+	go func() {
+		defer close(stopped)
+
+		ticker := clock.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			uptime := clock.Since(processStart)
+			recordUptime(ctx, uptime)
+			if heartbeat > 0 {
+				beat(ctx, uptime)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+			}
+		}
+	}()
+
+	return closer
+}
+
+func recordUptime(ctx context.Context, uptime time.Duration) {
+	gauge, err := Default().Metrics().NewGauge("uptime_seconds",
+		metrics.WithDescription("Seconds since the process started"),
+	)
+	if err != nil {
+		return
+	}
+
+	_ = gauge.Measure(ctx, uptime.Seconds())
+}
+
+func beat(ctx context.Context, uptime time.Duration) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	slog.InfoContext(ctx, "heartbeat",
+		slog.Duration("uptime", uptime),
+		slog.Int("goroutines", runtime.NumGoroutine()),
+		slog.Uint64("heap_alloc_bytes", mem.HeapAlloc),
+		slog.Uint64("heap_objects", mem.HeapObjects),
+		slog.Uint64("gc_cycles", uint64(mem.NumGC)),
+	)
+
+	counter, err := Default().Metrics().NewCounter("heartbeats",
+		metrics.WithDescription("Incremented on every heartbeat"),
+	)
+	if err != nil {
+		return
+	}
+
+	_ = counter.Incr(ctx)
+}
@@ -0,0 +1,108 @@
+package kokoro
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/kzs0/kokoro/telemetry/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+type build struct {
+	version string
+	commit  string
+	date    string
+}
+
+// WithVersion identifies the running build on every signal. Fields left empty
+// are filled from the build info embedded by the go toolchain when available.
+func WithVersion(version, commit, date string) Option {
+	return func(o *options) {
+		o.build = build{
+			version: version,
+			commit:  commit,
+			date:    date,
+		}
+	}
+}
+
+// resolve fills any missing fields from the module version and the vcs
+// settings stamped into the binary
+func (b build) resolve() build {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+
+	if b.version == "" && info.Main.Version != "(devel)" {
+		b.version = info.Main.Version
+	}
+
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if b.commit == "" {
+				b.commit = setting.Value
+			}
+		case "vcs.time":
+			if b.date == "" {
+				b.date = setting.Value
+			}
+		}
+	}
+
+	return b
+}
+
+func (b build) logAttrs() []slog.Attr {
+	attrs := make([]slog.Attr, 0, 2)
+	if b.version != "" {
+		attrs = append(attrs, slog.String("version", b.version))
+	}
+	if b.commit != "" {
+		attrs = append(attrs, slog.String("commit", b.commit))
+	}
+
+	return attrs
+}
+
+func (b build) traceAttrs() []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, 3)
+	if b.version != "" {
+		attrs = append(attrs, semconv.ServiceVersion(b.version))
+	}
+	if b.commit != "" {
+		attrs = append(attrs, attribute.String("service.commit", b.commit))
+	}
+	if b.date != "" {
+		attrs = append(attrs, attribute.String("service.build_date", b.date))
+	}
+
+	return attrs
+}
+
+// record publishes the build as a build_info gauge that is always 1, allowing
+// the version to be joined onto other metrics
+func (b build) record(ctx context.Context) error {
+	if Default().Metrics() == nil {
+		return nil
+	}
+
+	gauge, err := Default().Metrics().NewGauge("build_info",
+		metrics.WithDescription("The build of the running service, always 1"),
+		metrics.WithLabelNames([]string{"version", "commit", "date", "go_version"}),
+	)
+	if err != nil {
+		return err
+	}
+
+	return gauge.Measure(ctx, 1,
+		metrics.WithLabel("version", b.version),
+		metrics.WithLabel("commit", b.commit),
+		metrics.WithLabel("date", b.date),
+		metrics.WithLabel("go_version", runtime.Version()),
+	)
+}